@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/badge"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// unsafeFileChars matches characters replaced in badge file names
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// runBadges exports the SVG badges of monitors computed from the history stored by monitoring with `-data`
+// e.g. `iseeu badges -config iseeu.json -out ./badges` writes `./badges/<monitor>-uptime-7d.svg` and so on
+func runBadges(args []string) error {
+	flags := flag.NewFlagSet("badges", flag.ExitOnError)
+	out := flags.String("out", "badges", "Directory the badges are written to")
+	flags.StringVar(&config.DataDir, "data", "", "Directory where reports and alert events were stored (defaults to data_dir of the configuration file)")
+	flags.StringVar(&configFile, "config", "", "JSON configuration file defining the monitors badges are exported for (defaults to every stored website)")
+	flags.Parse(args)
+
+	// monitors are named by their name if they have one, by their url otherwise
+	names := make(map[string]string)
+	if configFile != "" {
+		if err := config.Load(configFile); err != nil {
+			return err
+		}
+		if err := parseMonitors(); err != nil {
+			return err
+		}
+		for _, m := range config.Monitors {
+			url, _ := inspect.ParseConfigURL(m.URL)
+			names[url] = url
+			if m.Name != "" {
+				names[url] = m.Name
+			}
+		}
+	}
+	if config.DataDir == "" {
+		return errors.New("no data directory, set it with -data or data_dir in the configuration file")
+	}
+	store, err := storage.Open(config.DataDir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	counters := make(map[string]*badge.Counter)
+	for url := range names {
+		counters[url] = badge.NewCounter(now)
+	}
+	// uptimes are counted from hourly rollups, for their periods of up to 30 days
+	err = store.Rollups(badge.NewCounter(now).From(), now, time.Hour, func(r *storage.Rollup) error {
+		counter, ok := counters[r.Url]
+		if !ok {
+			if configFile != "" {
+				return nil
+			}
+			counter = badge.NewCounter(now)
+			counters[r.Url] = counter
+			names[r.Url] = r.Url
+		}
+		counter.AddRollup(r)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+	for url, counter := range counters {
+		stats := counter.Stats()
+		for _, kind := range badge.Kinds() {
+			name := unsafeFileChars.ReplaceAllString(names[url], "_") + "-" + kind + ".svg"
+			if err := ioutil.WriteFile(filepath.Join(*out, name), stats.Badge(kind).SVG(), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
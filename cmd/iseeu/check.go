@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/check"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+)
+
+// runCheck probes each target once (or `-n` times), prints the results and fails if any check fails
+// e.g. `iseeu check -n 3 -latency 800ms google.com api.example.com/health`
+func runCheck(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.StringVar(&configFile, "config", "", "JSON configuration file whose monitors are checked with their assertions (when no URL is given)")
+	opts := check.Options{}
+	flags.IntVar(&opts.Probes, "n", 1, "Number of probes of each target")
+	flags.DurationVar(&opts.Interval, "interval", time.Second, "Interval between probes of a target")
+	flags.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "Request timeout")
+	flags.Float64Var(&opts.MinSuccess, "min-success", 1, "Ratio of passed probes below which a check fails")
+	status := flags.String("status", "200", "Comma-separated status codes accepted for targets without assertions in the configuration file")
+	latency := flags.Duration("latency", 0, "Maximum total request duration for targets without assertions in the configuration file (0 disables)")
+	asJSON := flags.Bool("json", false, "Print results as JSON instead of a table")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s check [OPTIONS] [URL...]\n\nOPTIONS:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// assertions given on the command line are the defaults of every target
+	defaults := config.CheckConfig{MaxLatency: config.Duration(*latency)}
+	for _, code := range strings.Split(*status, ",") {
+		c, err := strconv.Atoi(strings.TrimSpace(code))
+		if err != nil {
+			return fmt.Errorf("invalid status code %q", code)
+		}
+		defaults.Status = append(defaults.Status, c)
+	}
+	if opts.Probes <= 0 {
+		return fmt.Errorf("invalid number of probes %d", opts.Probes)
+	}
+
+	targets, err := checkTargets(flags.Args(), defaults)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		flags.Usage()
+		return errors.New("no targets to check, give urls or a configuration file")
+	}
+
+	results := check.Run(targets, opts)
+	if *asJSON {
+		printCheckJSON(results)
+	} else {
+		printCheckTable(results)
+	}
+
+	failed := 0
+	for _, r := range results {
+		if !r.Passed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// checkTargets resolves `args` (names or urls of monitors of the configuration file, or any url) into targets,
+// or returns all monitors of the configuration file if there's no argument
+func checkTargets(args []string, defaults config.CheckConfig) ([]check.Target, error) {
+	var monitors []check.Target
+	if configFile != "" {
+		if err := config.Load(configFile); err != nil {
+			return nil, err
+		}
+		if err := parseMonitors(); err != nil {
+			return nil, err
+		}
+		for _, m := range config.Monitors {
+			url, _ := inspect.ParseConfigURL(m.URL)
+			target := check.Target{Name: m.Name, Url: url, Check: defaults}
+			if len(m.Check.Status) > 0 {
+				target.Check.Status = m.Check.Status
+			}
+			if m.Check.MaxLatency > 0 {
+				target.Check.MaxLatency = m.Check.MaxLatency
+			}
+			monitors = append(monitors, target)
+		}
+	}
+	if len(args) == 0 {
+		return monitors, nil
+	}
+
+	var targets []check.Target
+	for _, arg := range args {
+		url, err := inspect.ParseURL(arg)
+		target := check.Target{Url: url, Check: defaults}
+		for _, m := range monitors {
+			if m.Name == arg || m.Url == url {
+				target, err = m, nil
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// printCheckTable prints a line per target with its average timings, and the reason of its last failed probe
+func printCheckTable(results []*check.Result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tRESULT\tPASSED\tSTATUS\tCONNECT\tFIRST BYTE\tTOTAL\tREASON")
+	for _, r := range results {
+		name := r.Url
+		if r.Name != "" {
+			name = r.Name
+		}
+		result := "ok"
+		if !r.Passed {
+			result = "FAIL"
+		}
+		var connect, firstByte, total []time.Duration
+		last, reason := r.Probes[len(r.Probes)-1].Report, ""
+		for _, p := range r.Probes {
+			connect = append(connect, p.Report.ConnectDuration)
+			firstByte = append(firstByte, p.Report.FirstByteDuration)
+			total = append(total, p.Report.TotalDuration)
+			if !p.Passed {
+				reason = p.Reason
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d\t%s\t%s\t%s\t%s\n", name, result, r.Successes(), len(r.Probes), last.StatusCode,
+			average(connect), average(firstByte), average(total), reason)
+	}
+	w.Flush()
+}
+
+// average formats the average of the durations of traced requests (-1 means there has been an error)
+func average(durations []time.Duration) string {
+	var sum time.Duration
+	n := 0
+	for _, d := range durations {
+		if d != -1 {
+			sum += d
+			n++
+		}
+	}
+	if n == 0 {
+		return "-"
+	}
+	return (sum / time.Duration(n)).Round(time.Millisecond).String()
+}
+
+// checkResult is the JSON representation of the check of a target
+type checkResult struct {
+	Name      string        `json:"name,omitempty"`
+	URL       string        `json:"url"`
+	Passed    bool          `json:"passed"`
+	Successes int           `json:"successes"`
+	Probes    []*checkProbe `json:"probes"`
+}
+
+// checkProbe is the JSON representation of a probe, durations are in milliseconds (-1 when the request failed)
+type checkProbe struct {
+	Passed            bool    `json:"passed"`
+	Reason            string  `json:"reason,omitempty"`
+	StatusCode        int     `json:"status_code"`
+	ConnectDuration   float64 `json:"connect_ms"`
+	FirstByteDuration float64 `json:"first_byte_ms"`
+	TotalDuration     float64 `json:"total_ms"`
+}
+
+func printCheckJSON(results []*check.Result) {
+	var res []*checkResult
+	for _, r := range results {
+		cr := &checkResult{Name: r.Name, URL: r.Url, Passed: r.Passed, Successes: r.Successes()}
+		for _, p := range r.Probes {
+			cr.Probes = append(cr.Probes, &checkProbe{
+				Passed:            p.Passed,
+				Reason:            p.Reason,
+				StatusCode:        p.Report.StatusCode,
+				ConnectDuration:   milliseconds(p.Report.ConnectDuration),
+				FirstByteDuration: milliseconds(p.Report.FirstByteDuration),
+				TotalDuration:     milliseconds(p.Report.TotalDuration),
+			})
+		}
+		res = append(res, cr)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(res)
+}
+
+// milliseconds converts a duration to milliseconds, keeping -1 for failed requests
+func milliseconds(d time.Duration) float64 {
+	if d == -1 {
+		return -1
+	}
+	return float64(d) / float64(time.Millisecond)
+}
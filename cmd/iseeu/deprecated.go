@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+)
+
+// defineDeprecatedFlags defines the flags replaced by -refresh and -windows in `flags`, so that existing command lines
+// keep working, or fail with how to migrate when there's no equivalent
+func defineDeprecatedFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&config.UIRefreshInterval, "sui", 2*time.Second, "Deprecated: use -refresh")
+	flags.Var(removedFlag("-lui was removed, the stats of every window are refreshed every -refresh (switch windows with w)"),
+		"lui", "Removed: the stats of every window are refreshed every -refresh")
+	flags.Var(&windowAlias{"short"}, "sstats", "Deprecated: use -windows short=`duration`")
+	flags.Var(&windowAlias{"long"}, "lstats", "Deprecated: use -windows long=`duration`")
+}
+
+// windowAlias is a deprecated flag setting the duration of a window of -windows, e.g. -sstats of the short one
+type windowAlias struct {
+	window string
+}
+
+func (a *windowAlias) String() string {
+	return ""
+}
+
+func (a *windowAlias) Set(s string) error {
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	for i := range config.StatsWindows {
+		if config.StatsWindows[i].Name == a.window {
+			config.StatsWindows[i].Duration = duration
+			return config.StatsWindows.Validate()
+		}
+	}
+	return fmt.Errorf("there's no %s window in -windows, set its duration there instead", a.window)
+}
+
+// removedFlag is a flag which was removed without equivalent, it fails with its migration message
+type removedFlag string
+
+func (r removedFlag) String() string {
+	return ""
+}
+
+func (r removedFlag) Set(string) error {
+	return errors.New(string(r))
+}
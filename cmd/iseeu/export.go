@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/export"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// runExport exports the reports, rollups and alert events stored by monitoring with `-data`, for the monitors given
+// by name or url (defaults to every monitor of the configuration file, or every stored website)
+// e.g. `iseeu export -config iseeu.json -from 2026-09-01 -to 2026-09-30 -format csv api` writes `./export/reports.csv` and so on
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("out", "export", "Directory the reports, rollups and events files are written to")
+	flags.StringVar(&config.DataDir, "data", "", "Directory where reports and alert events were stored (defaults to data_dir of the configuration file)")
+	flags.StringVar(&configFile, "config", "", "JSON configuration file defining the exported monitors and their names (defaults to every stored website)")
+	format := flags.String("format", "csv", "Format of the exported files: "+strings.Join(export.Formats, ", "))
+	from := flags.String("from", "", "Start of the exported history, as a day like 2026-09-01 or an RFC 3339 time (defaults to the oldest history)")
+	to := flags.String("to", "", "End of the exported history, as a day (included) or an RFC 3339 time (defaults to now)")
+	opts := export.Options{}
+	flags.DurationVar(&opts.Interval, "interval", time.Hour, "Interval of rollups")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s export [OPTIONS] [MONITOR...]\n\nOPTIONS:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	var err error
+	if opts.From, err = parseTime(*from, false); err != nil {
+		return fmt.Errorf("invalid -from: %v", err)
+	}
+	if opts.To, err = parseTime(*to, true); err != nil {
+		return fmt.Errorf("invalid -to: %v", err)
+	}
+	if opts.To.IsZero() {
+		opts.To = time.Now()
+	}
+
+	var monitors []export.Monitor
+	if configFile != "" {
+		if err := config.Load(configFile); err != nil {
+			return err
+		}
+		if err := parseMonitors(); err != nil {
+			return err
+		}
+		for _, m := range config.Monitors {
+			url, _ := inspect.ParseConfigURL(m.URL)
+			monitors = append(monitors, export.Monitor{Url: url, Name: m.Name})
+		}
+	}
+	opts.Monitors = monitors
+	if flags.NArg() > 0 {
+		opts.Monitors = nil
+		for _, arg := range flags.Args() {
+			url, err := inspect.ParseConfigURL(arg)
+			monitor := export.Monitor{Url: url}
+			for _, m := range monitors {
+				if m.Name == arg || m.Url == url {
+					monitor, err = m, nil
+				}
+			}
+			if err != nil {
+				return err
+			}
+			opts.Monitors = append(opts.Monitors, monitor)
+		}
+	}
+
+	if config.DataDir == "" {
+		return errors.New("no data directory, set it with -data or data_dir in the configuration file")
+	}
+	store, err := storage.Open(config.DataDir)
+	if err != nil {
+		return err
+	}
+	return export.Export(store, *out, *format, opts)
+}
+
+// parseTime parses a day like 2006-01-02 (UTC) or an RFC 3339 time, the end of the day if `end` is set
+// an empty string is the zero time
+func parseTime(s string, end bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.Parse("2006-01-02", s); err == nil {
+		if end {
+			return day.Add(24*time.Hour - time.Nanosecond), nil
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
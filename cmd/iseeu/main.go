@@ -1,106 +1,231 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net/url"
+	"net"
+	"net/http"
 	"os"
-	"strconv"
-	"strings"
+	"os/signal"
+	"sort"
+	"syscall"
 	"time"
 
+	"github.com/NouamaneTazi/website-monitor/internal/api"
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
 	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/core"
 	"github.com/NouamaneTazi/website-monitor/internal/cui"
-	"github.com/NouamaneTazi/website-monitor/internal/inspect"
 	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/notify"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
 )
 
+// commands maps subcommands to their implementation, which parses their own arguments
+var commands = map[string]func(args []string) error{
+	"statuspage": runStatuspage,
+	"badges":     runBadges,
+	"check":      runCheck,
+	"validate":   runValidate,
+	"export":     runExport,
+	"replay":     runReplay,
+	"report":     runReport,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
 	// Parse urls and polling intervals and options
-	flag.DurationVar(&config.ShortUIRefreshInterval, "sui", 2*time.Second, "Short refreshing UI interval (in seconds)")
-	flag.DurationVar(&config.LongUIRefreshInterval, "lui", 10*time.Second, "Long refreshing UI interval (in seconds)")
-	flag.DurationVar(&config.ShortStatsHistoryInterval, "sstats", 10*time.Second, "Short refreshes show stats for past `ShortStatsHistoryInterval` minutes")
-	flag.DurationVar(&config.LongStatsHistoryInterval, "lstats", 60*time.Second,
-		"Long refreshes show stats for past `LongStatsHistoryInterval` minutes")
-	flag.DurationVar(&config.WebsiteAlertInterval, "alertint", 10*time.Second,
-		"Shows alert if website is down for `WebsiteAlertInterval` minutes")
-	flag.Float64Var(&config.CriticalAvailability, "crit", 0.8, "Availability of websites below which we show an alert")
+	defineFlags(flag.CommandLine)
 	err := parse()
 	if err != nil {
 		log.Fatalln("Failed parsing command arguments: ", err)
 	}
 
-	// initiate array holding metrics. each metrics corresponds to one URL
-	// metrics are updated over time through `ListenAndProcess()` method
-	// * note: we could have used a channel of capacity one to always keep the latest metric ready
-	// * but I think this is simpler and more understandable
-	stats := make([]*metrics.Metrics, 0, len(config.UrlsPollingsIntervals))
-
-	for url, pollingInterval := range config.UrlsPollingsIntervals {
-		// Init the inspectors, where each inspector monitors a single URL
-		// and sends back the trace report over the `reportc` channel
-		reportc := inspect.NewInspector(url, pollingInterval)
+	// SIGINT and SIGTERM stop monitoring gracefully like quitting the CUI, a second signal exits right away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		cancel()
+		<-signals
+		log.Fatalln("Interrupted while shutting down")
+	}()
 
-		// init metrics server for each url and add them to `stats` array
-		s := metrics.NewMetrics(reportc, pollingInterval)
-		stats = append(stats, s)
+	// init monitoring: each monitor corresponds to one URL, monitored by an inspector whose reports update its metrics,
+	// whose alerts are tracked as incidents, notified and escalated
+	// monitors can be added and removed at runtime through the API
+	c, err := coreConfig()
+	if err != nil {
+		log.Fatalln("Failed initializing monitoring: ", err)
+	}
+	mon, err := core.New(c)
+	if err != nil {
+		log.Fatalln("Failed initializing monitoring: ", err)
+	}
+	var server *api.Server
+	if config.APIAddress != "" {
+		server = api.NewServer(mon.Registry, mon.Incidents, mon.Store)
+		mon.Watch(server.Watch, server.Unwatch)
+	}
+	if err := mon.Start(ctx); err != nil {
+		log.Fatalln("Failed adding monitor: ", err)
+	}
 
-		// start a goroutine for each url, which going to listen to `reportc` channel
-		// process its reports, and updates the corresponding `Metrics`
-		go s.ListenAndProcess()
+	// serve the HTTP API and the web dashboard, listening beforehand so that errors are reported before the CUI starts
+	// requests (e.g. event streams) are canceled on shutdown
+	var httpServer *http.Server
+	if server != nil {
+		listener, err := net.Listen("tcp", config.APIAddress)
+		if err != nil {
+			log.Fatalln("Failed to start API: ", err)
+		}
+		httpServer = &http.Server{Handler: server, BaseContext: func(net.Listener) context.Context { return ctx }}
+		go httpServer.Serve(listener)
 	}
 
-	// create CUI and handle keyboardBindings
-	err = cui.HandleCUI(stats)
+	// create CUI and handle keyboardBindings, until the user quits or a signal is received
+	err = cui.HandleCUI(ctx, mon.Registry, mon.Incidents, mon.Store, clock.Real)
+	cancel()
 	if err != nil {
 		log.Fatalf("Failed to start CUI %v", err)
 	}
+	if err := shutdown(mon, httpServer); err != nil {
+		log.Fatalln("Failed shutting down gracefully: ", err)
+	}
+}
+
+// shutdown stops the API and probes, and waits for in-flight requests to be processed and stored,
+// and for notifications to be sent, for at most config.ShutdownTimeout
+// `httpServer` is nil when the API is disabled
+func shutdown(mon *core.Monitor, httpServer *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if httpServer != nil {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			return fmt.Errorf("stopping API: %v", err)
+		}
+	}
+	return mon.Stop(ctx)
 }
 
+// defineFlags defines the monitoring options in `flags`, shared by monitoring and the validate command
+func defineFlags(flags *flag.FlagSet) {
+	flags.DurationVar(&config.UIRefreshInterval, "refresh", 2*time.Second, "Refreshing UI interval")
+	defineAlertFlags(flags)
+	flags.DurationVar(&config.HistoryRetention, "history", time.Hour, "Reports are kept in memory for `HistoryRetention`")
+	flags.StringVar(&config.DataDir, "data", "", "Directory where reports and alert events are stored, e.g. for the statuspage command (disabled by default)")
+	config.StorageRetention = config.Retention{Raw: 7 * 24 * time.Hour, Minute: 30 * 24 * time.Hour, Hour: 90 * 24 * time.Hour}
+	flags.Var(&config.StorageRetention, "retention",
+		"How long stored reports and their per-minute, per-hour and per-day rollups are kept, e.g. \"raw=14d,hour=365d\" (0 keeps them forever)")
+	flags.DurationVar(&config.ShutdownTimeout, "shutdown", 10*time.Second, "On exit, in-flight requests and notifications are waited for at most `ShutdownTimeout`")
+	flags.StringVar(&config.APIAddress, "api", "", "Address the HTTP API and web dashboard listen on, e.g. localhost:8080 (disabled by default)")
+	flags.StringVar(&config.APIToken, "apitoken", os.Getenv("ISEEU_API_TOKEN"),
+		"Token required as \"Authorization: Bearer TOKEN\" by the write endpoints of the HTTP API, disabled without it (defaults to $ISEEU_API_TOKEN)")
+	flags.StringVar(&configFile, "config", "", "JSON configuration file defining monitors, alert rules, notifiers and escalation policy")
+	defineDeprecatedFlags(flags)
+}
+
+// defineAlertFlags defines the windows and alerting options in `flags`, shared by monitoring and the replay command
+func defineAlertFlags(flags *flag.FlagSet) {
+	config.StatsWindows = config.Windows{{Name: "short", Duration: 10 * time.Second}, {Name: "long", Duration: time.Minute}}
+	flags.Var(&config.StatsWindows, "windows",
+		"Comma-separated `windows` stats are aggregated over, like \"1m,5m,1h,24h\" or named like \"short=10s,long=1m\"")
+	flags.DurationVar(&config.WebsiteAlertInterval, "alertint", 10*time.Second,
+		"Shows alert if website is down for `WebsiteAlertInterval` minutes")
+	flags.Float64Var(&config.CriticalAvailability, "crit", 0.8, "Availability of websites below which we show an alert")
+	flags.Float64Var(&config.WarningAvailability, "warn", 0, "Availability of websites below which we show a warning (0 disables availability warnings)")
+	flags.DurationVar(&config.LatencyThreshold, "latency", 0, "Latency of websites above which we show an alert (0 disables latency alerts)")
+	flags.DurationVar(&config.LatencyWarningThreshold, "latencywarn", 0, "Latency of websites above which we show a warning (0 disables latency warnings)")
+	flags.StringVar(&config.LatencyAggregate, "latagg", "avg", "How latency is aggregated over the alert window (-alertint): avg, max or a percentile like p95")
+	flags.StringVar(&config.LatencyPhase, "latphase", "ttfb", "Latency alerts are computed on first byte (ttfb) or total (total) request duration")
+	flags.DurationVar(&config.FlapDetectionInterval, "flapint", 20*time.Second, "State changes are tracked over the past `FlapDetectionInterval` for flap detection")
+	flags.Float64Var(&config.FlapHighThreshold, "flaphigh", 0.5, "Percent state change above which a website is flapping (0 disables flap detection)")
+	flags.Float64Var(&config.FlapLowThreshold, "flaplow", 0.25, "Percent state change below which a website stops flapping")
+}
+
+// configFile is the JSON configuration file given with `-config`
+var configFile string
+
 // parse parses urls and validates command format
 func parse() error {
 	flag.Parse()
 	tail := flag.Args()
-	if len(tail) > 0 && len(tail)%2 == 0 {
-		for i := 0; i < len(tail); i += 2 {
-			pollingInterval, err := strconv.Atoi(tail[i+1])
-			if err != nil {
-				return fmt.Errorf("error converting polling interval %v to int", tail[i+1])
-			}
-			url, err := parseURL(tail[i])
-			if err != nil {
-				return err
-			}
-			config.UrlsPollingsIntervals[url] = time.Duration(pollingInterval) * time.Second
-		}
-	} else {
+	if len(tail)%2 != 0 || (len(tail) == 0 && configFile == "") {
 		fmt.Fprintf(os.Stderr, "\nUsage: %s [OPTIONS] URL1 POLLING_INTERVAL1 URL2 POLLING_INTERVAL2\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Example: %s -crit 0.3 -sui 1s google.com 2 http://google.fr 1\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Example: %s -crit 0.3 -refresh 1s google.com 2 http://google.fr 1\n\n", os.Args[0])
 		fmt.Fprintln(os.Stderr, "OPTIONS:")
 		flag.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nCOMMANDS (see their options with -h):")
+		fmt.Fprintf(os.Stderr, "  %s statuspage [OPTIONS]\trenders a static status page from stored history\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s badges [OPTIONS]\texports SVG badges of monitors from stored history\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s check [OPTIONS] [URL...]\tprobes websites once, and fails if any check fails\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s export [OPTIONS] [MONITOR...]\texports stored history as CSV, JSON or NDJSON files\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s replay [OPTIONS] [REPORTS.ndjson...]\treplays recorded reports to see which alerts would have fired\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s report [OPTIONS]\trenders the uptime report of a period, with incidents, MTTR and MTBF, as Markdown, HTML or JSON\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s validate [OPTIONS] [URL...]\tprints every configuration problem, or what would be monitored\n", os.Args[0])
 		return errors.New("urls must be provided with their respective polling intervals")
 	}
+
+	if problems := validate(tail); len(problems) > 0 {
+		if len(problems) > 1 {
+			return fmt.Errorf("%v, and %d other problems (list them with %s validate)", problems[0], len(problems)-1, os.Args[0])
+		}
+		return problems[0]
+	}
 	return nil
 }
 
-// parseURL reassembles the URL into a valid URL string
-func parseURL(uri string) (string, error) {
-	if !strings.Contains(uri, "://") && !strings.HasPrefix(uri, "//") {
-		uri = "//" + uri
+// parseMonitors adds the monitors of the configuration file and resolves their dependencies, like `validate` does,
+// failing on the first problem
+func parseMonitors() error {
+	if problems := validateMonitors(); len(problems) > 0 {
+		return problems[0]
 	}
+	return nil
+}
 
-	url, err := url.Parse(uri)
-	if err != nil {
-		return "", err
+// coreConfig returns the configuration of monitoring set by the command line and the configuration file
+func coreConfig() (core.Config, error) {
+	urls := make([]string, 0, len(config.UrlsPollingsIntervals))
+	for url := range config.UrlsPollingsIntervals {
+		urls = append(urls, url)
 	}
-	if url.Scheme == "" {
-		url.Scheme = "http"
-		if !strings.HasSuffix(url.Host, ":80") {
-			url.Scheme += "s"
-		}
+	sort.Strings(urls)
+	var targets []core.Target
+	for _, url := range urls {
+		targets = append(targets, core.Target{URL: url, Interval: config.UrlsPollingsIntervals[url], Name: config.Names[url],
+			Tags: config.Tags[url], DependsOn: config.Dependencies[url]})
 	}
 
-	return url.String(), nil
+	ruleset, err := rules.Compile(config.Rules)
+	if err != nil {
+		return core.Config{}, err
+	}
+	notifiers, err := notify.FromConfig(config.Notifiers)
+	if err != nil {
+		return core.Config{}, err
+	}
+	return core.Config{
+		Targets:    targets,
+		Settings:   metrics.ConfigSettings(),
+		Rules:      ruleset,
+		Notifiers:  notifiers,
+		Escalation: config.Escalation,
+		StateFile:  config.StateFile,
+		DataDir:    config.DataDir,
+		Retention:  config.StorageRetention,
+	}, nil
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/replay"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// runReplay feeds recorded reports through metrics and alerting with the given alert options, and prints the alerts
+// which would have fired
+// e.g. `iseeu replay -data ./data -from 2026-09-01 -crit 0.9 -alertint 2m` or `iseeu replay -crit 0.9 reports.ndjson`
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	defineAlertFlags(flags)
+	flags.StringVar(&config.DataDir, "data", "", "Directory where reports were stored by monitoring, replayed without report logs")
+	flags.StringVar(&configFile, "config", "", "JSON configuration file defining the alert rules and alerting options")
+	from := flags.String("from", "", "Start of the replayed history, as a day like 2026-09-01 or an RFC 3339 time (defaults to the oldest history)")
+	to := flags.String("to", "", "End of the replayed history, as a day (included) or an RFC 3339 time (defaults to now)")
+	opts := replay.Options{}
+	flags.Float64Var(&opts.Speed, "speed", 0, "Replay speed relative to real time, e.g. 3600 replays an hour per second (0 replays as fast as possible)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s replay [OPTIONS] [REPORTS.ndjson...]\n\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Replays the given report logs, or the history stored in the data directory.\n\nOPTIONS:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	fromTime, err := parseTime(*from, false)
+	if err != nil {
+		return fmt.Errorf("invalid -from: %v", err)
+	}
+	toTime, err := parseTime(*to, true)
+	if err != nil {
+		return fmt.Errorf("invalid -to: %v", err)
+	}
+	if configFile != "" {
+		if err := config.Load(configFile); err != nil {
+			return err
+		}
+	}
+	if opts.Rules, err = rules.Compile(config.Rules); err != nil {
+		return err
+	}
+	if err := metrics.ValidateLatencyAlert(config.LatencyPhase, config.LatencyAggregate); err != nil {
+		return err
+	}
+
+	// load the recorded reports
+	var records []*metrics.Record
+	collect := func(record *metrics.Record) error {
+		if (fromTime.IsZero() || !record.Time.Before(fromTime)) && (toTime.IsZero() || !record.Time.After(toTime)) {
+			records = append(records, record)
+		}
+		return nil
+	}
+	if flags.NArg() > 0 {
+		for _, path := range flags.Args() {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			err = storage.ReadReports(f, collect)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("reading %s: %v", path, err)
+			}
+		}
+	} else {
+		if config.DataDir == "" {
+			return errors.New("no reports, give report logs or set the data directory with -data or data_dir in the configuration file")
+		}
+		store, err := storage.Open(config.DataDir)
+		if err != nil {
+			return err
+		}
+		if err := store.Reports(fromTime, toTime, collect); err != nil {
+			return err
+		}
+	}
+	if len(records) == 0 {
+		return errors.New("no reports to replay")
+	}
+	for _, record := range records {
+		if problems := intervalProblems(record.Report.Url, record.Report.PollingInterval); len(problems) > 0 {
+			return problems[0]
+		}
+	}
+
+	result, err := replay.Run(records, opts, func(e *metrics.Event) {
+		state := "FIRING"
+		if e.Resolved {
+			state = "RESOLVED"
+		}
+		fmt.Printf("%s  %-8s  %-8s  %s\n", e.Time.Format("2006-01-02 15:04:05"), state, e.Severity, e.Message)
+	})
+	if err != nil {
+		return err
+	}
+	printReplaySummary(result)
+	return nil
+}
+
+// printReplaySummary prints how many times each alert fired and for how long
+func printReplaySummary(result *replay.Result) {
+	fmt.Printf("\nReplayed %d reports of %d websites from %s to %s\n\n", result.Reports, len(result.Urls),
+		result.From.Format("2006-01-02 15:04:05"), result.To.Format("2006-01-02 15:04:05"))
+	if len(result.Alerts) == 0 {
+		fmt.Println("No alert would have fired")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WEBSITE\tALERT\tSEVERITY\tFIRED\tFIRING FOR")
+	for _, a := range result.Alerts {
+		firing := a.Firing.Round(time.Second).String()
+		if a.Ongoing {
+			firing += " (ongoing)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", a.Url, a.Alert, a.Severity, a.Fired, firing)
+	}
+	w.Flush()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+	"github.com/NouamaneTazi/website-monitor/internal/uptime"
+)
+
+// runReport renders the uptime report of a period from the history stored by monitoring with `-data`
+// e.g. `iseeu report -config iseeu.json -period 2026-09 -format html -out report.html`
+func runReport(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	period := flags.String("period", "", "Period of the report, as a month like 2026-09, a year like 2026 or a day like 2026-09-15 (defaults to the last month)")
+	format := flags.String("format", "markdown", "Format of the report: "+strings.Join(uptime.Formats, ", "))
+	out := flags.String("out", "", "File the report is written to (defaults to the standard output)")
+	flags.StringVar(&config.DataDir, "data", "", "Directory where reports and alert events were stored (defaults to data_dir of the configuration file)")
+	flags.StringVar(&configFile, "config", "", "JSON configuration file defining the reported monitors and their names (defaults to every stored website)")
+	flags.Parse(args)
+
+	now := time.Now()
+	p := uptime.LastMonth(now)
+	if *period != "" {
+		var err error
+		if p, err = uptime.ParsePeriod(*period); err != nil {
+			return err
+		}
+	}
+
+	var sites []uptime.Site
+	if configFile != "" {
+		if err := config.Load(configFile); err != nil {
+			return err
+		}
+		if err := parseMonitors(); err != nil {
+			return err
+		}
+		for _, m := range config.Monitors {
+			url, _ := inspect.ParseConfigURL(m.URL)
+			sites = append(sites, uptime.Site{Url: url, Name: m.Name})
+		}
+	}
+	if config.DataDir == "" {
+		return errors.New("no data directory, set it with -data or data_dir in the configuration file")
+	}
+
+	// the report is of existing history, which storage.Open would otherwise create
+	if err := directoryExists(config.DataDir); err != nil {
+		return err
+	}
+	store, err := storage.Open(config.DataDir)
+	if err != nil {
+		return err
+	}
+	report, err := uptime.Build(store, sites, p, now)
+	if err != nil {
+		return err
+	}
+
+	// rendered in memory so that no file is written on errors
+	var buf bytes.Buffer
+	if err := uptime.Render(&buf, report, *format); err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(*out, buf.Bytes(), 0644)
+}
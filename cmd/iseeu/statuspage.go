@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/statuspage"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// runStatuspage renders a static status page from the history stored by monitoring with `-data`
+// e.g. `iseeu statuspage -config iseeu.json -out ./public`
+func runStatuspage(args []string) error {
+	flags := flag.NewFlagSet("statuspage", flag.ExitOnError)
+	out := flags.String("out", "public", "Directory the status page and its feeds are written to")
+	flags.StringVar(&config.DataDir, "data", "", "Directory where reports and alert events were stored (defaults to data_dir of the configuration file)")
+	flags.StringVar(&configFile, "config", "", "JSON configuration file defining the monitors shown and their groups (defaults to every stored website)")
+	opts := statuspage.Options{}
+	flags.StringVar(&opts.Title, "title", "Status", "Title of the status page")
+	flags.IntVar(&opts.Days, "days", 90, "Number of days of uptime history shown")
+	flags.StringVar(&opts.BaseURL, "url", "", "URL the status page is published at, used for links in feeds")
+	flags.Parse(args)
+
+	var sites []statuspage.Site
+	if configFile != "" {
+		if err := config.Load(configFile); err != nil {
+			return err
+		}
+		if err := parseMonitors(); err != nil {
+			return err
+		}
+		for _, m := range config.Monitors {
+			url, _ := inspect.ParseConfigURL(m.URL)
+			sites = append(sites, statuspage.Site{Url: url, Name: m.Name, Group: m.Group})
+		}
+		for _, rule := range config.Rules {
+			opts.Rules = append(opts.Rules, rule.Name)
+		}
+	}
+	if config.DataDir == "" {
+		return errors.New("no data directory, set it with -data or data_dir in the configuration file")
+	}
+	if opts.Days <= 0 {
+		return fmt.Errorf("invalid number of days %d", opts.Days)
+	}
+
+	store, err := storage.Open(config.DataDir)
+	if err != nil {
+		return err
+	}
+	return statuspage.Generate(store, sites, *out, opts, time.Now())
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/notify"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+)
+
+// problem is a configuration problem found by the validate command, at `location` in the configuration
+// (e.g. `monitors[2].url`, `-windows` or `notifiers.ops`)
+type problem struct {
+	location string
+	message  string
+}
+
+func (p *problem) Error() string {
+	return p.location + ": " + p.message
+}
+
+// runValidate checks the configuration without monitoring anything: it prints every problem with its location,
+// or a summary of what would be monitored
+// e.g. `iseeu validate -config iseeu.json -windows 30s google.com 60`
+func runValidate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	defineFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s validate [OPTIONS] [URL1 POLLING_INTERVAL1 ...]\n\nOPTIONS:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	problems := validate(flags.Args())
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found", len(problems))
+	}
+	printSummary()
+	return nil
+}
+
+// validate checks the configuration file, the monitoring options and the urls and polling intervals in `tail`,
+// and sets the config variables, monitoring only starting without problems (see `parse`)
+func validate(tail []string) []*problem {
+	var problems []*problem
+	add := func(location, format string, a ...interface{}) {
+		problems = append(problems, &problem{location, fmt.Sprintf(format, a...)})
+	}
+
+	// the command line takes precedence over the configuration file
+	dataOption := "data_dir"
+	if config.DataDir != "" {
+		dataOption = "-data"
+	}
+	if configFile != "" {
+		if err := config.Load(configFile); err != nil {
+			// nothing else can be checked in a file which can't be parsed
+			return []*problem{{"-config", err.Error()}}
+		}
+	}
+	problems = append(problems, validateMonitors()...)
+
+	if len(tail)%2 != 0 {
+		add("arguments", "urls must be provided with their respective polling intervals")
+		tail = tail[:len(tail)-1]
+	}
+	for i := 0; i < len(tail); i += 2 {
+		location := fmt.Sprintf("arguments[%d]", i)
+		u, err := inspect.ParseURL(tail[i])
+		if err != nil {
+			add(location, "%v", err)
+			continue
+		}
+		pollingInterval, err := strconv.Atoi(tail[i+1])
+		if err != nil || pollingInterval <= 0 {
+			add(fmt.Sprintf("arguments[%d]", i+1), "invalid polling interval %q, expected a positive number of seconds", tail[i+1])
+			continue
+		}
+		if _, ok := config.UrlsPollingsIntervals[u]; ok {
+			add(location, "duplicate monitor of %s", u)
+		}
+		config.UrlsPollingsIntervals[u] = time.Duration(pollingInterval) * time.Second
+	}
+	if len(config.UrlsPollingsIntervals) == 0 && len(problems) == 0 {
+		add("arguments", "no urls to monitor")
+	}
+
+	problems = append(problems, validateOptions(dataOption)...)
+	urls := make([]string, 0, len(config.UrlsPollingsIntervals))
+	for u := range config.UrlsPollingsIntervals {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	for _, u := range urls {
+		problems = append(problems, intervalProblems(u, config.UrlsPollingsIntervals[u])...)
+	}
+	problems = append(problems, validateRules()...)
+	problems = append(problems, validateNotifiers()...)
+	return problems
+}
+
+// validateMonitors checks the monitors of the configuration file and sets their config variables
+func validateMonitors() []*problem {
+	var problems []*problem
+	add := func(i int, field, format string, a ...interface{}) {
+		location := fmt.Sprintf("monitors[%d]%s", i, field)
+		problems = append(problems, &problem{location, fmt.Sprintf(format, a...)})
+	}
+
+	// monitors can be referred to by name or by url
+	refs := make(map[string]string)
+	urls := make([]string, len(config.Monitors))
+	for i, m := range config.Monitors {
+		u, err := inspect.ParseConfigURL(m.URL)
+		if err != nil {
+			add(i, ".url", "%v", err)
+		} else if _, ok := refs[u]; ok {
+			add(i, ".url", "duplicate monitor of %s", u)
+		} else {
+			urls[i] = u
+			refs[u] = u
+		}
+		if m.Interval <= 0 {
+			add(i, ".interval", "polling interval must be positive")
+		}
+		if m.Name != "" {
+			if _, ok := refs[m.Name]; ok {
+				add(i, ".name", "duplicate monitor name %q", m.Name)
+			} else if urls[i] != "" {
+				refs[m.Name] = urls[i]
+			}
+		}
+		for _, code := range m.Check.Status {
+			if code < 100 || code > 599 {
+				add(i, ".check.status", "invalid status code %d", code)
+			}
+		}
+		if m.Check.MaxLatency < 0 {
+			add(i, ".check.max_latency", "maximum latency must not be negative")
+		}
+		if urls[i] == "" || m.Interval <= 0 {
+			continue
+		}
+		config.UrlsPollingsIntervals[urls[i]] = time.Duration(m.Interval)
+		if m.Name != "" {
+			config.Names[urls[i]] = m.Name
+		}
+		if m.Group != "" {
+			config.Groups[urls[i]] = m.Group
+		}
+		if len(m.Tags) > 0 {
+			config.Tags[urls[i]] = m.Tags
+		}
+	}
+
+	for i, m := range config.Monitors {
+		for _, ref := range m.DependsOn {
+			parent, ok := refs[ref]
+			if !ok {
+				if normalized, err := inspect.ParseConfigURL(ref); err == nil {
+					parent, ok = refs[normalized]
+				}
+			}
+			switch {
+			case !ok:
+				add(i, ".depends_on", "unknown dependency %q", ref)
+			case parent == urls[i]:
+				add(i, ".depends_on", "monitor can't depend on itself")
+			case urls[i] != "":
+				config.Dependencies[urls[i]] = append(config.Dependencies[urls[i]], parent)
+			}
+		}
+	}
+	// a cycle of dependencies suppresses the alerts of all its monitors whenever one of them is down
+	for i, u := range urls {
+		if u != "" && incident.Reaches(config.Dependencies, u, u) {
+			add(i, ".depends_on", "cyclic dependency of %s", u)
+		}
+	}
+	return problems
+}
+
+// validateOptions checks the monitoring options which don't depend on polling intervals,
+// `dataOption` being where the data directory is set
+func validateOptions(dataOption string) []*problem {
+	var problems []*problem
+	add := func(location, format string, a ...interface{}) {
+		problems = append(problems, &problem{location, fmt.Sprintf(format, a...)})
+	}
+	if config.UIRefreshInterval <= 0 {
+		add("-refresh", "UI refresh interval must be positive")
+	}
+	if err := metrics.ValidateThresholds(config.CriticalAvailability, config.WarningAvailability, config.LatencyThreshold, config.LatencyWarningThreshold); err != nil {
+		options := map[string]string{"CriticalAvailability": "-crit", "WarningAvailability": "-warn",
+			"LatencyThreshold": "-latency", "LatencyWarningThreshold": "-latencywarn"}
+		add(options[err.(*metrics.ThresholdError).Threshold], "%v", err)
+	}
+	if err := metrics.ValidateLatencyAlert(config.LatencyPhase, config.LatencyAggregate); err != nil {
+		add("-latagg", "%v", err)
+	}
+	if config.FlapLowThreshold > config.FlapHighThreshold {
+		add("-flaplow", "flap low threshold must not be above flap high threshold")
+	}
+	if config.ShutdownTimeout <= 0 {
+		add("-shutdown", "shutdown timeout must be positive")
+	}
+	if config.HistoryRetention <= 0 {
+		add("-history", "history retention must be positive")
+	}
+	// the data directory is created when monitoring starts
+	if info, err := os.Stat(config.DataDir); config.DataDir != "" && err == nil && !info.IsDir() {
+		add(dataOption, "%s is not a directory", config.DataDir)
+	}
+	if config.StateFile != "" {
+		if err := directoryExists(filepath.Dir(config.StateFile)); err != nil {
+			add("state_file", "%v", err)
+		}
+	}
+	return problems
+}
+
+// intervalProblems checks that the stats and alert windows hold at least one report of `url` polled every `pollingInterval`,
+// otherwise its metrics are computed over zero reports and alerts never fire
+func intervalProblems(url string, pollingInterval time.Duration) []*problem {
+	var problems []*problem
+	type window struct {
+		option   string
+		interval time.Duration
+	}
+	windows := []window{{"-alertint", config.WebsiteAlertInterval}}
+	for _, w := range config.StatsWindows {
+		windows = append(windows, window{"-windows " + w.Name, w.Duration})
+	}
+	if config.FlapHighThreshold > 0 {
+		windows = append(windows, window{"-flapint", config.FlapDetectionInterval})
+	}
+	for _, w := range windows {
+		if w.interval < pollingInterval {
+			problems = append(problems, &problem{w.option, fmt.Sprintf("interval %v is smaller than the polling interval %v of %s",
+				w.interval, pollingInterval, url)})
+		}
+	}
+	return problems
+}
+
+// validateRules checks every alert rule, where `rules.Compile` stops at the first invalid one
+func validateRules() []*problem {
+	var problems []*problem
+	names := make(map[string]bool)
+	for i, c := range config.Rules {
+		location := fmt.Sprintf("rules[%d]", i)
+		if c.Name != "" && names[c.Name] {
+			problems = append(problems, &problem{location, fmt.Sprintf("duplicate rule name %q", c.Name)})
+			continue
+		}
+		names[c.Name] = true
+		if _, err := rules.Compile([]config.RuleConfig{c}); err != nil {
+			message := strings.TrimPrefix(err.Error(), "rules[0]: ")
+			problems = append(problems, &problem{location, message})
+		}
+	}
+	return problems
+}
+
+// validateNotifiers checks that notifiers can deliver notifications and that the escalation policy refers to them
+func validateNotifiers() []*problem {
+	var problems []*problem
+	add := func(location, format string, a ...interface{}) {
+		problems = append(problems, &problem{location, fmt.Sprintf(format, a...)})
+	}
+
+	names := make([]string, 0, len(config.Notifiers))
+	for name := range config.Notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cfg, location := config.Notifiers[name], "notifiers."+name
+		if _, err := notify.New(cfg); err != nil {
+			add(location, "%v", err)
+			continue
+		}
+		switch cfg.Type {
+		case "webhook":
+			if u, _ := url.Parse(cfg.URL); (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add(location, "webhook url %q must be an absolute http or https url", cfg.URL)
+			}
+		case "exec":
+			if _, err := exec.LookPath(cfg.Command[0]); err != nil {
+				add(location, "%v", err)
+			}
+		case "file":
+			if err := directoryExists(filepath.Dir(cfg.Path)); err != nil {
+				add(location, "%v", err)
+			}
+		}
+	}
+
+	policy := config.Escalation
+	for _, channel := range []struct{ field, name string }{{"primary", policy.Primary}, {"secondary", policy.Secondary}} {
+		if _, ok := config.Notifiers[channel.name]; channel.name != "" && !ok {
+			add("escalation."+channel.field, "%q is not a defined notifier", channel.name)
+		}
+	}
+	if policy.Secondary != "" && policy.EscalateAfter <= 0 {
+		add("escalation.escalate_after", "incidents are never escalated to %q without a positive escalate_after", policy.Secondary)
+	}
+	if policy.Secondary == "" && policy.EscalateAfter > 0 {
+		add("escalation.secondary", "incidents can't be escalated after %v without a secondary notifier", time.Duration(policy.EscalateAfter))
+	}
+	for severity, channel := range policy.Routes {
+		if severity != "info" && severity != "warning" && severity != "critical" {
+			add("escalation.routes", "unknown severity %q (expected info, warning or critical)", severity)
+		} else if _, ok := config.Notifiers[channel]; !ok {
+			add("escalation.routes."+severity, "%q is not a defined notifier", channel)
+		}
+	}
+	if policy.RepeatInterval < 0 {
+		add("escalation.repeat_interval", "repeat interval must not be negative")
+	}
+	return problems
+}
+
+// directoryExists returns an error unless `dir` is an existing directory
+func directoryExists(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// printSummary prints the monitors, alert rules and notifiers which would be used, as a dry run
+func printSummary() {
+	urls := make([]string, 0, len(config.UrlsPollingsIntervals))
+	for u := range config.UrlsPollingsIntervals {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MONITOR\tURL\tINTERVAL\tDEPENDS ON")
+	for _, u := range urls {
+		name := config.Names[u]
+		if name == "" {
+			name = "-"
+		}
+		dependencies := strings.Join(config.Dependencies[u], ", ")
+		if dependencies == "" {
+			dependencies = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%v\t%s\n", name, u, config.UrlsPollingsIntervals[u], dependencies)
+	}
+	w.Flush()
+	fmt.Printf("\n%d monitors, %d alert rules, %d notifiers: configuration is valid\n",
+		len(urls), len(config.Rules), len(config.Notifiers))
+}
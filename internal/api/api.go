@@ -0,0 +1,286 @@
+// Package api serves the monitored websites status, history and alerts as JSON over HTTP, and a web dashboard
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/broadcast"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// prefix of all API endpoints
+const prefix = "/api/v1/"
+
+// Server serves the API endpoints:
+//
+//	GET    /api/v1/monitors                          status and aggregated stats of every monitor
+//	POST   /api/v1/monitors                          adds a monitor from {"url": "", "interval": "5s", "name": "", "tags": []}
+//	GET    /api/v1/monitors/{id}                     status and aggregated stats of a monitor
+//	DELETE /api/v1/monitors/{id}                     removes a monitor
+//	POST   /api/v1/monitors/{id}/pause               stops probing a monitor
+//	POST   /api/v1/monitors/{id}/resume              resumes probing a monitor
+//	POST   /api/v1/monitors/{id}/probe               triggers an immediate probe of a monitor
+//	GET    /api/v1/monitors/{id}/history?from=&to=   reports of a monitor between `from` and `to`
+//	GET    /api/v1/monitors/{id}/badges/{kind}.svg    SVG badge of a monitor, see badge.Kinds
+//	GET    /api/v1/alerts                            open incidents and alert transitions history
+//	GET    /api/v1/windows                           names and intervals of the windows stats are aggregated over
+//	GET    /api/v1/events?monitor=&tag=              Server-Sent Events of reports and alert transitions
+//	GET    /events?monitor=&tag=                     same as /api/v1/events
+//	GET    /  or  /dashboard                         web dashboard mirroring the terminal UI
+//	GET    /dashboard/stream                         Server-Sent Events feeding the dashboard
+//
+// where {id} is the monitor name, or its (escaped) url if it has no name
+// POST and DELETE endpoints require the `Authorization: Bearer TOKEN` header with config.APIToken, they're disabled without it
+type Server struct {
+	monitors  *registry.Registry
+	incidents *incident.Manager
+	store     *storage.Store // stored history badges uptimes are computed from (nil when storage is disabled)
+	hub       *broadcast.Hub // fans out monitors reports and alerts to stream clients
+}
+
+// NewServer inits an API Server serving `monitors` and `incidents`, `store` can be nil
+// monitors must be watched with `Watch` for their updates to be streamed
+func NewServer(monitors *registry.Registry, incidents *incident.Manager, store *storage.Store) *Server {
+	return &Server{monitors: monitors, incidents: incidents, store: store, hub: broadcast.NewHub()}
+}
+
+// ServeHTTP routes API requests
+// * note we don't use http.ServeMux as it would redirect ids containing escaped urls
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	switch {
+	case (path == "/" || path == "/dashboard") && r.Method == http.MethodGet:
+		s.dashboard(w, r)
+		return
+	case path == "/dashboard/stream" && r.Method == http.MethodGet:
+		s.stream(w, r, func(msg *broadcast.Message) bool { return msg.Event != "report" })
+		return
+	case path == "/events" && r.Method == http.MethodGet:
+		s.events(w, r)
+		return
+	}
+	if !strings.HasPrefix(path, prefix) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(path, prefix), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "monitors" && r.Method == http.MethodGet:
+		s.listMonitors(w, r)
+	case len(parts) == 1 && parts[0] == "monitors" && r.Method == http.MethodPost:
+		if authorized(w, r) {
+			s.addMonitor(w, r)
+		}
+	case len(parts) == 1 && parts[0] == "alerts" && r.Method == http.MethodGet:
+		s.listAlerts(w, r)
+	case len(parts) == 1 && parts[0] == "events" && r.Method == http.MethodGet:
+		s.events(w, r)
+	case len(parts) == 1 && parts[0] == "windows" && r.Method == http.MethodGet:
+		s.listWindows(w)
+	case len(parts) == 2 && parts[0] == "monitors" && r.Method == http.MethodGet:
+		if m := s.lookup(w, parts[1]); m != nil {
+			writeJSON(w, http.StatusOK, newMonitor(m))
+		}
+	case len(parts) == 2 && parts[0] == "monitors" && r.Method == http.MethodDelete:
+		if !authorized(w, r) {
+			return
+		}
+		if m := s.lookup(w, parts[1]); m != nil {
+			if err := s.monitors.Remove(m.Url); err != nil {
+				writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case len(parts) == 3 && parts[0] == "monitors" && parts[2] == "history" && r.Method == http.MethodGet:
+		if m := s.lookup(w, parts[1]); m != nil {
+			s.history(w, r, m)
+		}
+	case len(parts) == 4 && parts[0] == "monitors" && parts[2] == "badges" && r.Method == http.MethodGet:
+		if m := s.lookup(w, parts[1]); m != nil {
+			s.badge(w, r, m, parts[3])
+		}
+	case len(parts) == 3 && parts[0] == "monitors" && r.Method == http.MethodPost:
+		if !authorized(w, r) {
+			return
+		}
+		if m := s.lookup(w, parts[1]); m != nil {
+			s.control(w, m, parts[2])
+		}
+	case len(parts) <= 3 && (parts[0] == "monitors" || parts[0] == "alerts" || parts[0] == "events" || parts[0] == "windows"):
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// authorized checks the token of requests to write endpoints, it writes an error response if it's missing or invalid
+// * note the token is sent in a header, which browsers don't set on cross-site form posts
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if config.APIToken == "" {
+		writeError(w, http.StatusForbidden, "write endpoints are disabled, enable them with -apitoken")
+		return false
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(config.APIToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or invalid token")
+		return false
+	}
+	return true
+}
+
+// lookup finds the monitor identified by the escaped `id`, it writes an error response if there's none
+func (s *Server) lookup(w http.ResponseWriter, id string) *registry.Monitor {
+	id, err := url.PathUnescape(id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid monitor id")
+		return nil
+	}
+	if m := s.monitors.Get(id); m != nil {
+		return m
+	}
+	writeError(w, http.StatusNotFound, "unknown monitor "+id)
+	return nil
+}
+
+func (s *Server) listMonitors(w http.ResponseWriter, r *http.Request) {
+	var monitors []*monitor
+	for _, m := range s.monitors.Monitors() {
+		monitors = append(monitors, newMonitor(m))
+	}
+	sort.Slice(monitors, func(i, j int) bool { return monitors[i].ID < monitors[j].ID })
+	writeJSON(w, http.StatusOK, monitors)
+}
+
+// newMonitorRequest is the body of monitor creation requests
+type newMonitorRequest struct {
+	URL      string          `json:"url"`
+	Interval config.Duration `json:"interval"`
+	Name     string          `json:"name"`
+	Tags     []string        `json:"tags"`
+}
+
+// addMonitor adds a monitor of an HTTP(S) url, other checks (e.g. exec) can only be defined in the configuration file
+func (s *Server) addMonitor(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "body must be JSON, sent with Content-Type: application/json")
+		return
+	}
+	var req newMonitorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+	u, err := inspect.ParseURL(req.URL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		writeError(w, http.StatusBadRequest, "only http and https monitors can be added through the API")
+		return
+	}
+	m, err := s.monitors.Add(u, time.Duration(req.Interval), req.Name, req.Tags...)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, newMonitor(m))
+}
+
+// control pauses, resumes or probes a monitor
+func (s *Server) control(w http.ResponseWriter, m *registry.Monitor, action string) {
+	switch action {
+	case "pause":
+		m.Inspector.Pause()
+	case "resume":
+		m.Inspector.Resume()
+	case "probe":
+		m.Inspector.ProbeNow()
+		writeJSON(w, http.StatusAccepted, newMonitor(m))
+		return
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, newMonitor(m))
+}
+
+func (s *Server) history(w http.ResponseWriter, r *http.Request, m *registry.Monitor) {
+	from, err := parseTime(r.URL.Query().Get("from"), time.Time{})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	to, err := parseTime(r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+
+	records := m.Metrics.History(from, to)
+	reports := make([]*report, 0, len(records))
+	for _, record := range records {
+		reports = append(reports, newReport(record))
+	}
+	writeJSON(w, http.StatusOK, reports)
+}
+
+func (s *Server) listAlerts(w http.ResponseWriter, r *http.Request) {
+	var events []*metrics.Event
+	for _, m := range s.monitors.Monitors() {
+		events = append(events, m.Metrics.Events()...)
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	writeJSON(w, http.StatusOK, &alerts{Incidents: s.incidents.Incidents(), Events: events})
+}
+
+// listWindows lists the windows stats are aggregated over, in the order they're configured
+func (s *Server) listWindows(w http.ResponseWriter) {
+	windows := make([]*windowDefinition, 0, len(config.StatsWindows))
+	for _, window := range config.StatsWindows {
+		windows = append(windows, &windowDefinition{Name: window.Name, Interval: window.Duration.String()})
+	}
+	writeJSON(w, http.StatusOK, windows)
+}
+
+// parseTime parses a RFC 3339 time or a unix timestamp (in seconds), an empty string gives `def`
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if unix, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
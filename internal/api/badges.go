@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/badge"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// badge serves the SVG badge of `kind` of a monitor, its label can be overridden with the `label` query parameter
+func (s *Server) badge(w http.ResponseWriter, r *http.Request, m *registry.Monitor, kind string) {
+	kind = strings.TrimSuffix(kind, ".svg")
+	stats, err := s.badgeStats(m, kind, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	b := stats.Badge(kind)
+	if b == nil {
+		writeError(w, http.StatusNotFound, "unknown badge "+kind)
+		return
+	}
+	if label := r.URL.Query().Get("label"); label != "" {
+		b.Label = label
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0") // badges are cached by image proxies otherwise
+	w.Write(b.SVG())
+}
+
+// badgeStats computes the stats of a monitor needed by the badge of `kind`
+// uptimes are computed from the stored history if there's a store, from the history kept in memory otherwise,
+// in which case there's no data over periods longer than it's kept
+func (s *Server) badgeStats(m *registry.Monitor, kind string, now time.Time) (*badge.Stats, error) {
+	counter := badge.NewCounter(now)
+	if strings.HasPrefix(kind, "uptime-") {
+		if s.store != nil {
+			err := s.store.Rollups(counter.From(), now, time.Hour, func(r *storage.Rollup) error {
+				if r.Url == m.Url {
+					counter.AddRollup(r)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			for _, record := range m.Metrics.History(counter.From(), now) {
+				counter.Add(record)
+			}
+		}
+	}
+
+	stats := counter.Stats()
+	if s.store == nil {
+		for _, period := range badge.Periods {
+			if period.Duration > m.Metrics.HistoryRetention() {
+				stats.Uptime[period.Name] = -1
+			}
+		}
+	}
+
+	// status and response time are live
+	stats.ResponseTime = -1
+	m.Metrics.Mu.RLock()
+	defer m.Metrics.Mu.RUnlock()
+	switch {
+	case m.Inspector.Paused():
+		stats.Status = "paused"
+	case m.Metrics.LastTimestamp.IsZero():
+		stats.Status = "unknown"
+	case m.Metrics.Alert.WebsiteWasDown:
+		stats.Status = "down"
+	case m.Metrics.Alert.Level() != metrics.OK:
+		stats.Status = "degraded"
+	default:
+		stats.Status = "up"
+	}
+	// response time over the longest window
+	if longest := m.Metrics.AggData.Longest(); longest != nil {
+		if latency := longest.Latency("total", "avg"); latency > 0 {
+			stats.ResponseTime = latency
+		}
+	}
+	return stats, nil
+}
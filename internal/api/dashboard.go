@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/broadcast"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+)
+
+// streamBuffer is the number of messages buffered for each stream client before dropping them
+const streamBuffer = 256
+
+// heartbeatInterval is the interval at which comments are sent to keep idle streams open
+const heartbeatInterval = 15 * time.Second
+
+// monitorUpdate is the payload of "monitor" stream messages, sent after each processed report
+type monitorUpdate struct {
+	Monitor *monitor `json:"monitor"`
+	Report  *report  `json:"report"`
+}
+
+// Watch publishes the reports and alert transitions of `m` to stream clients
+// it must be called before `m` starts processing reports (e.g. in the registry `onAdd` hook)
+func (s *Server) Watch(m *registry.Monitor) {
+	m.Metrics.SubscribeReports(func(record *metrics.Record) {
+		s.publish("monitor", m, func() interface{} { return &monitorUpdate{Monitor: newMonitor(m), Report: newReport(record)} })
+		s.publish("report", m, func() interface{} { return &reportEvent{ID: m.ID(), URL: m.Url, report: *newReport(record)} })
+	})
+	m.Metrics.Subscribe(func(e *metrics.Event) {
+		s.publish("alert", m, func() interface{} { return &alertEvent{ID: m.ID(), Event: e} })
+	})
+}
+
+// Unwatch notifies stream clients that `m` was removed
+func (s *Server) Unwatch(m *registry.Monitor) {
+	s.publish("removed", m, func() interface{} { return map[string]string{"id": m.ID(), "url": m.Url} })
+}
+
+// publish sends the message built by `payload` to stream clients, it never blocks
+// * note `payload` isn't called when no client streams this event of `m`, sparing building and encoding it
+// (e.g. monitor snapshots when only /events clients are connected)
+func (s *Server) publish(event string, m *registry.Monitor, payload func() interface{}) {
+	msg := &broadcast.Message{Event: event, ID: m.ID(), Url: m.Url, Tags: m.Tags}
+	if !s.hub.Wants(msg) {
+		return
+	}
+	data, err := json.Marshal(payload())
+	if err != nil {
+		return
+	}
+	msg.Data = data
+	s.hub.Publish(msg)
+}
+
+// dashboard serves the HTML dashboard
+func (s *Server) dashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, dashboardPage)
+}
+
+// stream streams the messages published to the hub which `keep` returns true for as Server-Sent Events
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, keep func(*broadcast.Message) bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sub := s.hub.Subscribe(streamBuffer, keep)
+	defer s.hub.Unsubscribe(sub)
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case msg := <-sub.C:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Event, msg.Data)
+		case <-heartbeat.C:
+			fmt.Fprintf(w, ": dropped %d\n\n", sub.Dropped())
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+// dashboardPage is the self-contained HTML dashboard (no external dependency), mirroring the terminal UI:
+// stats table, per website latency charts and alerts feed, updated live from `/dashboard/stream`
+const dashboardPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Websites Monitor</title>
+<style>
+  body { font-family: monospace; background: #111; color: #ddd; margin: 0; padding: 1em; }
+  h1 { font-size: 1.2em; margin: 0 0 .5em 0; }
+  header { display: flex; justify-content: space-between; align-items: baseline; }
+  #status { color: #888; }
+  button { font-family: monospace; background: #222; color: #ddd; border: 1px solid #555; padding: .2em .6em; cursor: pointer; }
+  button.active { border-color: #0bc; color: #0bc; }
+  table { border-collapse: collapse; width: 100%; margin: .5em 0 1em 0; }
+  th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #333; }
+  tr.down td { color: #e55; }
+  tr.warning td { color: #eb5; }
+  tr.flapping td { color: #c6c; }
+  tr.paused td { color: #777; }
+  #charts { display: grid; grid-template-columns: repeat(auto-fill, minmax(360px, 1fr)); gap: 1em; }
+  .chart { border: 1px solid #333; padding: .5em; }
+  .chart h2 { font-size: 1em; margin: 0 0 .3em 0; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .legend span { margin-right: 1em; }
+  canvas { width: 100%; height: 120px; }
+  #alerts { list-style: none; padding: 0; max-height: 20em; overflow-y: auto; border: 1px solid #333; }
+  #alerts li { padding: .2em .6em; }
+  #alerts li.problem { color: #e55; }
+  #alerts li.resolved { color: #5c5; }
+  #alerts li.warning { color: #eb5; }
+</style>
+</head>
+<body>
+<header>
+  <h1>Websites Monitor</h1>
+  <div>
+    <span id="windows"></span>
+    <span id="status">connecting...</span>
+  </div>
+</header>
+<table>
+  <thead>
+    <tr><th>website</th><th>Polling Interval</th><th>Status code count</th><th>Availability</th>
+    <th>ConnectDuration</th><th>FirstByteDuration</th><th>TotalDuration</th></tr>
+  </thead>
+  <tbody id="stats"></tbody>
+</table>
+<h1>Latency (past 10 minutes)</h1>
+<div id="charts"></div>
+<h1>Alerts</h1>
+<ul id="alerts"></ul>
+<script>
+(function () {
+  "use strict";
+  var chartSpan = 10 * 60 * 1000; // charts show the past 10 minutes
+  var monitors = {};               // maps urls to their last known status
+  var points = {};                 // maps urls to their latency points
+  var windowName = "";             // name of the window whose stats are shown
+
+  function el(tag, text, cls) {
+    var e = document.createElement(tag);
+    if (text !== undefined) { e.textContent = text; }
+    if (cls) { e.className = cls; }
+    return e;
+  }
+
+  function statusCodes(codes) {
+    var parts = [];
+    for (var code in codes) { parts.push("(" + code + ": " + codes[code] + ")"); }
+    return parts.join("");
+  }
+
+  function renderStats() {
+    var tbody = document.getElementById("stats");
+    tbody.innerHTML = "";
+    Object.keys(monitors).sort().forEach(function (url) {
+      var m = monitors[url], w = m.windows[windowName];
+      if (!w) { return; }
+      var tr = el("tr");
+      if (m.paused) { tr.className = "paused"; }
+      else if (m.flapping) { tr.className = "flapping"; }
+      else if (m.level === "critical") { tr.className = "down"; }
+      else if (m.level === "warning") { tr.className = "warning"; }
+      var availability = (w.availability * 100).toFixed(2) + "%";
+      if (m.flapping) { availability += " (flapping)"; }
+      [m.id, m.polling_interval + (m.paused ? " (paused)" : ""), statusCodes(w.status_codes), availability,
+        w.connect_ms.avg + "ms (" + w.connect_ms.max + "ms)",
+        w.first_byte_ms.avg + "ms (" + w.first_byte_ms.max + "ms)",
+        w.total_ms.avg + "ms (" + w.total_ms.max + "ms)"].forEach(function (text) {
+        tr.appendChild(el("td", text));
+      });
+      tbody.appendChild(tr);
+    });
+  }
+
+  function chartFor(url) {
+    var id = "chart-" + encodeURIComponent(url);
+    var div = document.getElementById(id);
+    if (!div) {
+      div = el("div", undefined, "chart");
+      div.id = id;
+      div.appendChild(el("h2", monitors[url] ? monitors[url].id : url));
+      var legend = el("div", undefined, "legend");
+      var ttfb = el("span", "first byte"), total = el("span", "total");
+      ttfb.style.color = "#0bc";
+      total.style.color = "#eb5";
+      legend.appendChild(ttfb);
+      legend.appendChild(total);
+      div.appendChild(legend);
+      div.appendChild(el("canvas"));
+      document.getElementById("charts").appendChild(div);
+    }
+    return div.querySelector("canvas");
+  }
+
+  function renderChart(url) {
+    var canvas = chartFor(url), ctx = canvas.getContext("2d");
+    canvas.width = canvas.clientWidth;
+    canvas.height = canvas.clientHeight;
+    var now = Date.now(), pts = (points[url] || []).filter(function (p) { return now - p.t <= chartSpan; });
+    points[url] = pts;
+    var max = 1;
+    pts.forEach(function (p) { max = Math.max(max, p.ttfb, p.total); });
+    ctx.clearRect(0, 0, canvas.width, canvas.height);
+    ctx.fillStyle = "#888";
+    ctx.fillText(Math.round(max) + "ms", 2, 10);
+    function x(p) { return canvas.width * (1 - (now - p.t) / chartSpan); }
+    function y(v) { return canvas.height - 2 - (canvas.height - 14) * v / max; }
+    [["ttfb", "#0bc"], ["total", "#eb5"]].forEach(function (serie) {
+      ctx.strokeStyle = serie[1];
+      ctx.beginPath();
+      var started = false;
+      pts.forEach(function (p) {
+        var v = p[serie[0]];
+        if (v < 0) { started = false; return; } // failed request
+        if (started) { ctx.lineTo(x(p), y(v)); } else { ctx.moveTo(x(p), y(v)); started = true; }
+      });
+      ctx.stroke();
+    });
+    // failed requests are drawn as red ticks
+    ctx.fillStyle = "#e55";
+    pts.forEach(function (p) { if (p.ttfb < 0) { ctx.fillRect(x(p) - 1, canvas.height - 8, 2, 8); } });
+  }
+
+  function addPoint(url, r) {
+    (points[url] = points[url] || []).push({ t: new Date(r.time).getTime(), ttfb: r.first_byte_ms, total: r.total_ms });
+  }
+
+  function addAlert(e) {
+    var cls = e.resolved ? "resolved" : (e.severity === "critical" ? "problem" : "warning");
+    var li = el("li", new Date(e.time).toLocaleString() + " " + e.message, cls);
+    var list = document.getElementById("alerts");
+    list.appendChild(li);
+    list.scrollTop = list.scrollHeight;
+  }
+
+  function getJSON(path, fn) {
+    var xhr = new XMLHttpRequest();
+    xhr.open("GET", path);
+    xhr.onload = function () { if (xhr.status === 200) { fn(JSON.parse(xhr.responseText)); } };
+    xhr.send();
+  }
+
+  function renderWindows(windows) {
+    var span = document.getElementById("windows");
+    span.innerHTML = "";
+    windows.forEach(function (w) {
+      var button = el("button", w.name + " window", w.name === windowName ? "active" : "");
+      button.title = "stats over the past " + w.interval;
+      button.onclick = function () {
+        windowName = w.name;
+        renderWindows(windows);
+        renderStats();
+      };
+      span.appendChild(button);
+    });
+  }
+
+  function load() {
+    getJSON("/api/v1/windows", function (windows) {
+      windows = windows || [];
+      if (windows.length > 0 && !windows.some(function (w) { return w.name === windowName; })) {
+        windowName = windows[0].name;
+      }
+      renderWindows(windows);
+      renderStats();
+    });
+    getJSON("/api/v1/monitors", function (list) {
+      monitors = {};
+      (list || []).forEach(function (m) {
+        monitors[m.url] = m;
+        var from = new Date(Date.now() - chartSpan).toISOString().replace(/\.\d+Z$/, "Z");
+        getJSON("/api/v1/monitors/" + encodeURIComponent(m.url) + "/history?from=" + from, function (history) {
+          points[m.url] = [];
+          (history || []).forEach(function (r) { addPoint(m.url, r); });
+          renderChart(m.url);
+        });
+      });
+      renderStats();
+    });
+    getJSON("/api/v1/alerts", function (alerts) {
+      document.getElementById("alerts").innerHTML = "";
+      (alerts.events || []).forEach(addAlert);
+    });
+  }
+
+  var source = new EventSource("/dashboard/stream");
+  source.onopen = function () {
+    document.getElementById("status").textContent = "live";
+    load();
+  };
+  source.onerror = function () {
+    document.getElementById("status").textContent = "reconnecting...";
+  };
+  source.addEventListener("monitor", function (msg) {
+    var update = JSON.parse(msg.data);
+    monitors[update.monitor.url] = update.monitor;
+    addPoint(update.monitor.url, update.report);
+    document.getElementById("status").textContent = "live - last update " + new Date(update.report.time).toLocaleTimeString();
+    renderStats();
+    renderChart(update.monitor.url);
+  });
+  source.addEventListener("alert", function (msg) { addAlert(JSON.parse(msg.data)); });
+  source.addEventListener("removed", function (msg) {
+    var removed = JSON.parse(msg.data), chart = document.getElementById("chart-" + encodeURIComponent(removed.url));
+    delete monitors[removed.url];
+    delete points[removed.url];
+    if (chart) { chart.parentNode.removeChild(chart); }
+    renderStats();
+  });
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/NouamaneTazi/website-monitor/internal/broadcast"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+)
+
+// reportEvent is the payload of "report" stream messages, sent for every probe report
+type reportEvent struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	report
+}
+
+// alertEvent is the payload of "alert" stream messages, sent for every alert transition
+type alertEvent struct {
+	ID string `json:"id"`
+	*metrics.Event
+}
+
+// events streams probe reports ("report" events) and alert transitions ("alert" events) as Server-Sent Events
+// they can be filtered with `monitor` (id or url) and `tag` query parameters, each given any number of times:
+// a message is kept if its monitor matches any of the given monitors and has any of the given tags
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	var monitors []string
+	for _, id := range r.URL.Query()["monitor"] {
+		monitors = append(monitors, id)
+		// urls can also be given without normalization, e.g. google.com
+		if url, err := inspect.ParseConfigURL(id); err == nil {
+			monitors = append(monitors, url)
+		}
+	}
+	tags := r.URL.Query()["tag"]
+	s.stream(w, r, func(msg *broadcast.Message) bool {
+		if msg.Event != "report" && msg.Event != "alert" {
+			return false
+		}
+		return (len(monitors) == 0 || matchesAny(monitors, msg.ID, msg.Url)) && (len(tags) == 0 || matchesAny(tags, msg.Tags...))
+	})
+}
+
+// matchesAny returns whether any of `values` is in `filters`
+func matchesAny(filters []string, values ...string) bool {
+	for _, filter := range filters {
+		for _, value := range values {
+			if filter == value {
+				return true
+			}
+		}
+	}
+	return false
+}
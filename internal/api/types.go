@@ -0,0 +1,157 @@
+package api
+
+import (
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+)
+
+// monitor is the JSON representation of a monitor status
+type monitor struct {
+	ID              string             `json:"id"`
+	URL             string             `json:"url"`
+	Tags            []string           `json:"tags,omitempty"`
+	PollingInterval string             `json:"polling_interval"`
+	Paused          bool               `json:"paused"`
+	LastUpdate      time.Time          `json:"last_update"`
+	Availability    float64            `json:"availability"` // over the alert interval
+	Down            bool               `json:"down"`
+	Level           string             `json:"level"` // ok, warning or critical
+	LatencyHigh     bool               `json:"latency_high"`
+	LatencyMs       float64            `json:"latency_ms"` // aggregated latency used in latency alerts
+	Flapping        bool               `json:"flapping"`
+	Windows         map[string]*window `json:"windows"` // aggregated stats over every window, by name
+	Rules           []*rule            `json:"rules,omitempty"`
+}
+
+// windowDefinition is the JSON representation of a window stats are aggregated over
+type windowDefinition struct {
+	Name     string `json:"name"`
+	Interval string `json:"interval"`
+}
+
+// window is the JSON representation of stats aggregated over an interval
+type window struct {
+	Name              string      `json:"name"`
+	Interval          string      `json:"interval"`
+	Availability      float64     `json:"availability"`
+	StatusCodes       map[int]int `json:"status_codes"`
+	ConnectDuration   *avgMax     `json:"connect_ms"`
+	FirstByteDuration *avgMax     `json:"first_byte_ms"`
+	TotalDuration     *avgMax     `json:"total_ms"`
+}
+
+type avgMax struct {
+	Avg int `json:"avg"`
+	Max int `json:"max"`
+}
+
+// rule is the JSON representation of the state of an alert rule for a monitor
+type rule struct {
+	Name        string     `json:"name"`
+	Severity    string     `json:"severity"`
+	State       string     `json:"state"`
+	ActiveSince *time.Time `json:"active_since,omitempty"`
+}
+
+// report is the JSON representation of a single probe, durations are -1 when the request failed
+type report struct {
+	Time              time.Time          `json:"time"`
+	StatusCode        int                `json:"status_code"`
+	ConnectDuration   float64            `json:"connect_ms"`
+	FirstByteDuration float64            `json:"first_byte_ms"`
+	TotalDuration     float64            `json:"total_ms"`
+	Error             string             `json:"error,omitempty"`
+	Warning           string             `json:"warning,omitempty"`
+	Protocol          string             `json:"protocol,omitempty"`
+	Details           map[string]string  `json:"details,omitempty"`
+	Metrics           map[string]float64 `json:"metrics,omitempty"`
+}
+
+// alerts is the JSON representation of open incidents and alert transitions history
+type alerts struct {
+	Incidents []incident.Incident `json:"incidents"`
+	Events    []*metrics.Event    `json:"events"`
+}
+
+// newMonitor builds the JSON representation of `mon` (locks its metrics for reading)
+func newMonitor(mon *registry.Monitor) *monitor {
+	m := mon.Metrics
+	m.Mu.RLock()
+	defer m.Mu.RUnlock()
+
+	res := &monitor{
+		ID:              mon.ID(),
+		URL:             m.Url,
+		Tags:            mon.Tags,
+		PollingInterval: m.PollingInterval.String(),
+		Paused:          mon.Inspector.Paused(),
+		LastUpdate:      m.LastTimestamp,
+		Availability:    m.Alert.Availability,
+		Down:            m.Alert.WebsiteWasDown,
+		Level:           m.Alert.Level().String(),
+		LatencyHigh:     m.Alert.LatencyIsHigh,
+		LatencyMs:       milliseconds(m.Alert.Latency),
+		Flapping:        m.Alert.Flapping,
+		Windows:         make(map[string]*window, len(m.AggData.Windows)),
+	}
+	for _, agg := range m.AggData.Windows {
+		res.Windows[agg.Name()] = newWindow(agg)
+	}
+	if m.Rules != nil {
+		for _, a := range m.Rules.Alerts {
+			r := &rule{Name: a.Rule.Name, Severity: a.Rule.Severity, State: a.State.String()}
+			if a.State != rules.Inactive {
+				activeSince := a.ActiveSince
+				r.ActiveSince = &activeSince
+			}
+			res.Rules = append(res.Rules, r)
+		}
+	}
+	return res
+}
+
+// newWindow builds the JSON representation of `agg`, it must be called with the metrics locked
+func newWindow(agg *metrics.IntervalAggData) *window {
+	statusCodes := make(map[int]int, len(agg.StatusCodesCount))
+	for code, count := range agg.StatusCodesCount {
+		if count > 0 {
+			statusCodes[code] = count
+		}
+	}
+	return &window{
+		Name:              agg.Name(),
+		Interval:          agg.HistoryInterval().String(),
+		Availability:      agg.Availability,
+		StatusCodes:       statusCodes,
+		ConnectDuration:   &avgMax{agg.ConnectDuration[0], agg.ConnectDuration[1]},
+		FirstByteDuration: &avgMax{agg.FirstByteDuration[0], agg.FirstByteDuration[1]},
+		TotalDuration:     &avgMax{agg.TotalDuration[0], agg.TotalDuration[1]},
+	}
+}
+
+func newReport(record *metrics.Record) *report {
+	return &report{
+		Time:              record.Time,
+		StatusCode:        record.Report.StatusCode,
+		ConnectDuration:   milliseconds(record.Report.ConnectDuration),
+		FirstByteDuration: milliseconds(record.Report.FirstByteDuration),
+		TotalDuration:     milliseconds(record.Report.TotalDuration),
+		Error:             record.Report.Error,
+		Warning:           record.Report.Warning,
+		Protocol:          record.Report.Protocol,
+		Details:           record.Report.Details,
+		Metrics:           record.Report.Metrics,
+	}
+}
+
+// milliseconds converts a duration to milliseconds, keeping -1 for failed requests
+func milliseconds(d time.Duration) float64 {
+	if d == -1 {
+		return -1
+	}
+	return float64(d) / float64(time.Millisecond)
+}
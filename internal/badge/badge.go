@@ -0,0 +1,238 @@
+// Package badge renders shields-style SVG badges of monitors status, uptime and response time
+package badge
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// badge colors
+const (
+	BrightGreen = "#4c1"
+	Green       = "#97ca00"
+	Yellow      = "#dfb317"
+	Orange      = "#fe7d37"
+	Red         = "#e05d44"
+	Grey        = "#9f9f9f"
+)
+
+// Periods are the periods uptime badges are computed over, by name
+var Periods = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// Kinds returns the kinds of badges of a monitor: status, uptime-24h, uptime-7d, uptime-30d and response-time
+func Kinds() []string {
+	kinds := []string{"status"}
+	for _, period := range Periods {
+		kinds = append(kinds, "uptime-"+period.Name)
+	}
+	return append(kinds, "response-time")
+}
+
+// Stats are the values shown on the badges of a monitor
+type Stats struct {
+	Status       string             // up, down, degraded, paused or unknown
+	Uptime       map[string]float64 // uptime ratio by period name, -1 without reports
+	ResponseTime time.Duration      // average total duration of successful requests, -1 without reports
+}
+
+// Badge is a badge with a grey label on the left, and a colored message on the right
+type Badge struct {
+	Label   string
+	Message string
+	Color   string
+}
+
+// Badge returns the badge of `kind` (see `Kinds`), or nil for unknown kinds
+func (s *Stats) Badge(kind string) *Badge {
+	switch {
+	case kind == "status":
+		color := map[string]string{"up": BrightGreen, "degraded": Orange, "down": Red}[s.Status]
+		if color == "" {
+			color = Grey
+		}
+		return &Badge{Label: "status", Message: s.Status, Color: color}
+
+	case strings.HasPrefix(kind, "uptime-"):
+		uptime, ok := s.Uptime[strings.TrimPrefix(kind, "uptime-")]
+		if !ok {
+			return nil
+		}
+		b := &Badge{Label: "uptime " + strings.TrimPrefix(kind, "uptime-"), Message: "no data", Color: Grey}
+		if uptime >= 0 {
+			b.Message = formatUptime(uptime)
+			b.Color = scale(uptime, []float64{0.999, 0.99, 0.95, 0.9}, true)
+		}
+		return b
+
+	case kind == "response-time":
+		b := &Badge{Label: "response time", Message: "no data", Color: Grey}
+		if s.ResponseTime >= 0 {
+			b.Message = formatDuration(s.ResponseTime)
+			b.Color = scale(s.ResponseTime.Seconds(), []float64{0.2, 0.5, 1, 2}, false)
+		}
+		return b
+	}
+	return nil
+}
+
+// Counter computes the stats of a monitor from its reports
+type Counter struct {
+	now          time.Time
+	up, total    []int // successful and total reports by period of `Periods`
+	responseTime time.Duration
+	responses    int       // number of successful reports over the shortest period
+	last         time.Time // time of the last counted report
+	lastUp       bool      // whether the last counted report was successful
+}
+
+// NewCounter inits a Counter of the reports over `Periods` ending at `now`
+func NewCounter(now time.Time) *Counter {
+	return &Counter{now: now, up: make([]int, len(Periods)), total: make([]int, len(Periods))}
+}
+
+// From returns the time from which reports are counted, i.e. the start of the longest period
+func (c *Counter) From() time.Time {
+	return c.now.Add(-Periods[len(Periods)-1].Duration)
+}
+
+// Add counts a report, reports outside of `Periods` are ignored
+func (c *Counter) Add(record *metrics.Record) {
+	if record.Time.After(c.now) {
+		return
+	}
+	for i, period := range Periods {
+		if record.Time.Before(c.now.Add(-period.Duration)) {
+			continue
+		}
+		c.total[i]++
+		if record.Report.StatusCode == 200 {
+			c.up[i]++
+		}
+		if i == 0 && record.Report.TotalDuration != -1 {
+			c.responseTime += record.Report.TotalDuration
+			c.responses++
+		}
+	}
+	if c.last.IsZero() || record.Time.After(c.last) {
+		c.last, c.lastUp = record.Time, record.Report.StatusCode == 200
+	}
+}
+
+// AddRollup counts the reports of a rollup, which is counted in the periods its start is in
+func (c *Counter) AddRollup(r *storage.Rollup) {
+	if r.Time.After(c.now) {
+		return
+	}
+	for i, period := range Periods {
+		if r.Time.Before(c.now.Add(-period.Duration)) {
+			continue
+		}
+		c.total[i] += r.Count
+		c.up[i] += r.Successes
+		if i == 0 && r.Latencies > 0 {
+			c.responseTime += time.Duration(r.LatencySum * float64(time.Millisecond))
+			c.responses += r.Latencies
+		}
+	}
+	if r.Count > 0 && (c.last.IsZero() || r.Last.After(c.last)) {
+		c.last, c.lastUp = r.Last, r.LastStatusCode == 200
+	}
+}
+
+// Stats returns the stats of the counted reports:
+// the status of the last report, uptimes and the average response time over the shortest period
+func (c *Counter) Stats() *Stats {
+	stats := &Stats{Status: "unknown", Uptime: make(map[string]float64, len(Periods)), ResponseTime: -1}
+	if !c.last.IsZero() {
+		stats.Status = "down"
+		if c.lastUp {
+			stats.Status = "up"
+		}
+	}
+	for i, period := range Periods {
+		stats.Uptime[period.Name] = -1
+		if c.total[i] > 0 {
+			stats.Uptime[period.Name] = float64(c.up[i]) / float64(c.total[i])
+		}
+	}
+	if c.responses > 0 {
+		stats.ResponseTime = c.responseTime / time.Duration(c.responses)
+	}
+	return stats
+}
+
+// scale returns the color of `value` given the thresholds of bright green, green, yellow and orange
+// (in decreasing order if `higherIsBetter`, increasing order otherwise)
+func scale(value float64, thresholds []float64, higherIsBetter bool) string {
+	colors := []string{BrightGreen, Green, Yellow, Orange}
+	for i, threshold := range thresholds {
+		if (higherIsBetter && value >= threshold) || (!higherIsBetter && value < threshold) {
+			return colors[i]
+		}
+	}
+	return Red
+}
+
+// formatUptime formats an uptime ratio as a percentage, without rounding up to 100%
+func formatUptime(uptime float64) string {
+	if uptime < 1 && uptime >= 0.9999 {
+		return "99.99%"
+	}
+	return fmt.Sprintf("%.2f%%", uptime*100)
+}
+
+// formatDuration formats a response time in milliseconds, or seconds above 1s
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
+
+// SVG renders the badge in the flat shields.io style
+func (b *Badge) SVG() []byte {
+	labelWidth, messageWidth := textWidth(b.Label)+10, textWidth(b.Message)+10
+	width := labelWidth + messageWidth
+	label, message := html.EscapeString(b.Label), html.EscapeString(b.Message)
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">
+<title>%[4]s: %[5]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%.1[7]f" y="15" fill="#010101" fill-opacity=".3">%[4]s</text><text x="%.1[7]f" y="14">%[4]s</text>
+<text x="%.1[8]f" y="15" fill="#010101" fill-opacity=".3">%[5]s</text><text x="%.1[8]f" y="14">%[5]s</text>
+</g>
+</svg>
+`, width, labelWidth, messageWidth, label, message, b.Color, float64(labelWidth)/2, float64(labelWidth)+float64(messageWidth)/2))
+}
+
+// textWidth approximates the width in pixels of `text` in 11px Verdana
+func textWidth(text string) int {
+	var width float64
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune("ijlI.,:;'| ", r):
+			width += 3.5
+		case strings.ContainsRune("mwMW%", r):
+			width += 10
+		case r >= 'A' && r <= 'Z':
+			width += 7.5
+		default:
+			width += 6.5
+		}
+	}
+	return int(width + 0.5)
+}
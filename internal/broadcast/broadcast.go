@@ -0,0 +1,93 @@
+// Package broadcast fans out messages to any number of subscribers without ever blocking publishers
+package broadcast
+
+import "sync"
+
+// Message is a message published to all subscribers
+type Message struct {
+	Event string   // kind of message, e.g. report or alert
+	ID    string   // id of the monitor the message is about
+	Url   string   // url of the monitor the message is about
+	Tags  []string // tags of the monitor the message is about
+	Data  []byte   // JSON payload
+}
+
+// Subscriber receives published messages over `C`
+// messages are dropped when a subscriber is too slow to keep up with its buffer
+type Subscriber struct {
+	C       <-chan *Message
+	c       chan *Message
+	keep    func(*Message) bool // messages the subscriber receives, nil for all of them
+	mu      sync.Mutex
+	dropped int
+}
+
+// Dropped returns the number of messages dropped because the subscriber buffer was full
+func (s *Subscriber) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Hub holds subscribers, it's safe for concurrent use
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+}
+
+// NewHub inits a Hub without subscribers
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[*Subscriber]struct{})}
+}
+
+// Subscribe adds a subscriber buffering up to `buffer` of the messages `keep` returns true for (all of them if nil),
+// so that other messages neither take room in its buffer nor count as dropped
+// `keep` must not depend on the Data of messages, which isn't set yet when asked whether it Wants them
+func (h *Hub) Subscribe(buffer int, keep func(*Message) bool) *Subscriber {
+	c := make(chan *Message, buffer)
+	s := &Subscriber{C: c, c: c, keep: keep}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.c)
+	}
+}
+
+// Wants returns whether any subscriber keeps `msg`, so that its Data is only built when it's sent
+func (h *Hub) Wants(msg *Message) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subscribers {
+		if s.keep == nil || s.keep(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish sends `msg` to all subscribers keeping it, dropping it for those whose buffer is full
+func (h *Hub) Publish(msg *Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subscribers {
+		if s.keep != nil && !s.keep(msg) {
+			continue
+		}
+		select {
+		case s.c <- msg:
+		default:
+			s.mu.Lock()
+			s.dropped++
+			s.mu.Unlock()
+		}
+	}
+}
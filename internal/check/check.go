@@ -0,0 +1,104 @@
+// Package check probes websites a fixed number of times and asserts on their reports, e.g. in deploy pipelines
+package check
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+)
+
+// Target is a website to check
+type Target struct {
+	Name  string // optional
+	Url   string
+	Check config.CheckConfig
+}
+
+// Options defines how targets are probed and when a check passes
+type Options struct {
+	Probes     int           // number of probes of each target
+	Interval   time.Duration // interval between probes of a target
+	Timeout    time.Duration // request timeout
+	MinSuccess float64       // ratio of passed probes below which a check fails
+}
+
+// Probe is the result of a probe of a target
+type Probe struct {
+	Report *inspect.Report
+	Passed bool
+	Reason string // why the probe failed: request error or failed assertion
+}
+
+// Result is the result of the check of a target
+type Result struct {
+	Target
+	Probes []*Probe
+	Passed bool
+}
+
+// Successes returns the number of passed probes
+func (r *Result) Successes() int {
+	successes := 0
+	for _, p := range r.Probes {
+		if p.Passed {
+			successes++
+		}
+	}
+	return successes
+}
+
+// Run checks all targets concurrently and returns their results, in the order of `targets`
+func Run(targets []Target, opts Options) []*Result {
+	results := make([]*Result, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target Target) {
+			defer wg.Done()
+			results[i] = run(target, opts)
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// run probes `target` `opts.Probes` times, waiting `opts.Interval` between probes
+func run(target Target, opts Options) *Result {
+	result := &Result{Target: target}
+	for i := 0; i < opts.Probes; i++ {
+		if i > 0 {
+			time.Sleep(opts.Interval)
+		}
+		report := inspect.Probe(target.Url, opts.Timeout)
+		reason := Assert(target.Check, report)
+		result.Probes = append(result.Probes, &Probe{Report: report, Passed: reason == "", Reason: reason})
+	}
+	result.Passed = float64(result.Successes()) >= opts.MinSuccess*float64(opts.Probes)
+	return result
+}
+
+// Assert returns why `report` doesn't pass the assertions of `check`, or an empty string if it does
+func Assert(check config.CheckConfig, report *inspect.Report) string {
+	if report.StatusCode == 0 {
+		return report.Error
+	}
+	status := check.Status
+	if len(status) == 0 {
+		status = []int{200}
+	}
+	accepted := false
+	for _, code := range status {
+		accepted = accepted || code == report.StatusCode
+	}
+	if !accepted {
+		return fmt.Sprintf("status code %d not in %v", report.StatusCode, status)
+	}
+	// * note the latency of error responses isn't traced (-1), so it can't be asserted on
+	if maxLatency := time.Duration(check.MaxLatency); maxLatency > 0 && report.TotalDuration > maxLatency {
+		return fmt.Sprintf("latency %v above %v", report.TotalDuration.Round(time.Millisecond), maxLatency)
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+// Package clock abstracts the passing of time, so that inspectors, metrics and the UI can be driven by a fake clock
+// in tests and replays, faster than real time
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates tickers
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) *Ticker
+}
+
+// Ticker delivers ticks over `C` every period, dropping ticks for slow receivers like time.Ticker
+type Ticker struct {
+	C    <-chan time.Time
+	stop func()
+}
+
+// Stop turns off the ticker, no more ticks are sent after it returns
+func (t *Ticker) Stop() {
+	t.stop()
+}
+
+// Real is the clock of the system, backed by the time package
+var Real Clock = system{}
+
+type system struct{}
+
+func (system) Now() time.Time {
+	return time.Now()
+}
+
+func (system) NewTicker(d time.Duration) *Ticker {
+	t := time.NewTicker(d)
+	return &Ticker{C: t.C, stop: t.Stop}
+}
+
+// Fake is a clock whose time only moves forward with `Add` and `Set`, firing the tickers which are due
+// it's safe for concurrent use
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// fakeTicker is a ticker of a Fake clock
+type fakeTicker struct {
+	c      chan time.Time
+	period time.Duration
+	next   time.Time // time of the next tick
+}
+
+// NewFake inits a Fake clock set to `now`
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the time of the clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTicker creates a ticker whose first tick is due `d` after the time of the clock
+func (f *Fake) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t := &fakeTicker{c: make(chan time.Time, 1), period: d, next: f.now.Add(d)}
+	f.tickers = append(f.tickers, t)
+	return &Ticker{C: t.c, stop: func() { f.remove(t) }}
+}
+
+// Add moves the clock forward by `d`
+func (f *Fake) Add(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to `t` and sends the ticks which are due, it doesn't go back in time
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.Before(f.now) {
+		return
+	}
+	f.now = t
+	for _, ticker := range f.tickers {
+		for !ticker.next.After(t) {
+			select {
+			case ticker.c <- ticker.next:
+			default: // the previous tick wasn't received
+			}
+			ticker.next = ticker.next.Add(ticker.period)
+		}
+	}
+}
+
+// remove stops sending ticks to `t`
+func (f *Fake) remove(t *fakeTicker) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, ticker := range f.tickers {
+		if ticker == t {
+			f.tickers = append(f.tickers[:i:i], f.tickers[i+1:]...)
+			return
+		}
+	}
+}
@@ -3,11 +3,27 @@ package config
 import "time"
 
 var (
-	ShortUIRefreshInterval    time.Duration                    // Short refreshing UI interval (in seconds)
-	LongUIRefreshInterval     time.Duration                    // Long refreshing UI interval (in seconds)
-	ShortStatsHistoryInterval time.Duration                    // Short history interval (in minutes)
-	LongStatsHistoryInterval  time.Duration                    // Long history interval (in minutes)
-	WebsiteAlertInterval      time.Duration                    // Shows alert if website is down for `WebsiteAlertInterval` minutes
-	UrlsPollingsIntervals     = make(map[string]time.Duration) // maps urls to their corresponding polling interval
-	CriticalAvailability      float64                          // availability of websites below which we show an alert
+	UIRefreshInterval       time.Duration                    // refreshing UI interval
+	StatsWindows            Windows                          // named windows stats are aggregated over, shown in the UI and exported by the API
+	WebsiteAlertInterval    time.Duration                    // Shows alert if website is down for `WebsiteAlertInterval` minutes
+	UrlsPollingsIntervals   = make(map[string]time.Duration) // maps urls to their corresponding polling interval
+	Dependencies            = make(map[string][]string)      // maps urls to the urls they depend on
+	Names                   = make(map[string]string)        // maps urls to their monitor name (if any)
+	Groups                  = make(map[string]string)        // maps urls to their monitor group (if any)
+	Tags                    = make(map[string][]string)      // maps urls to their monitor tags (if any)
+	HistoryRetention        time.Duration                    // reports are kept in memory for `HistoryRetention`
+	APIAddress              string                           // address the HTTP API listens on (empty disables the API)
+	APIToken                string                           // token required by the write endpoints of the HTTP API (empty disables them)
+	ShutdownTimeout         time.Duration                    // on exit, in-flight requests and notifications are waited for at most `ShutdownTimeout`
+	DataDir                 string                           // directory where reports and alert events are stored (empty disables storage)
+	StorageRetention        Retention                        // how long stored reports and their rollups are kept
+	CriticalAvailability    float64                          // availability of websites below which we show an alert
+	WarningAvailability     float64                          // availability of websites below which we show a warning (0 disables availability warnings)
+	LatencyThreshold        time.Duration                    // latency above which we show an alert (0 disables latency alerts)
+	LatencyWarningThreshold time.Duration                    // latency above which we show a warning (0 disables latency warnings)
+	LatencyAggregate        string                           // how latency is aggregated over `WebsiteAlertInterval` (avg, max or pNN)
+	LatencyPhase            string                           // request phase whose latency is alerted on (ttfb or total)
+	FlapDetectionInterval   time.Duration                    // state changes are tracked over the past `FlapDetectionInterval` for flap detection
+	FlapHighThreshold       float64                          // percent state change above which a website starts flapping (0 disables flap detection)
+	FlapLowThreshold        float64                          // percent state change below which a website stops flapping
 )
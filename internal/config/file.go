@@ -0,0 +1,141 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+var (
+	Monitors   []MonitorConfig           // websites monitored in addition to those given on the command line
+	Rules      []RuleConfig              // alert rules evaluated against every website, see package rules
+	Notifiers  map[string]NotifierConfig // maps notification channel names to their settings
+	Escalation EscalationConfig          // how incidents are notified and escalated
+	StateFile  string                    // file where incidents and their escalation state are persisted
+)
+
+// File is the layout of the JSON configuration file given with `-config`
+type File struct {
+	Monitors   []MonitorConfig           `json:"monitors"`
+	Rules      []RuleConfig              `json:"rules"`
+	Notifiers  map[string]NotifierConfig `json:"notifiers"`
+	Escalation EscalationConfig          `json:"escalation"`
+	StateFile  string                    `json:"state_file"`
+	DataDir    string                    `json:"data_dir"`
+}
+
+// MonitorConfig defines a monitored website as written in the configuration file
+type MonitorConfig struct {
+	Name      string      `json:"name"`  // optional name other monitors can refer to in `DependsOn`
+	Group     string      `json:"group"` // optional group the monitor is shown in on the status page
+	Tags      []string    `json:"tags"`  // free-form tags, e.g. to filter the events stream
+	URL       string      `json:"url"`
+	Interval  Duration    `json:"interval"`   // polling interval
+	DependsOn []string    `json:"depends_on"` // names or urls of monitors this one depends on
+	Check     CheckConfig `json:"check"`      // assertions of `iseeu check`
+}
+
+// CheckConfig defines the assertions a probe of a monitor must pass in `iseeu check`
+type CheckConfig struct {
+	Status     []int    `json:"status"`      // accepted status codes (defaults to 200)
+	MaxLatency Duration `json:"max_latency"` // maximum total request duration (0 disables)
+}
+
+// RuleConfig defines an alert rule as written in the configuration file
+type RuleConfig struct {
+	Name        string            `json:"name"`
+	Expr        string            `json:"expr"`        // e.g. "availability(5m) < 0.95 and p95(ttfb, 5m) > 800ms"
+	Severity    string            `json:"severity"`    // info, warning or critical
+	For         Duration          `json:"for"`         // how long `Expr` must hold before the rule fires
+	Labels      map[string]string `json:"labels"`      // free-form labels attached to the alert
+	Annotations map[string]string `json:"annotations"` // free-form annotations (e.g. summary) attached to the alert
+}
+
+// NotifierConfig defines a notification channel as written in the configuration file
+type NotifierConfig struct {
+	Type    string   `json:"type"`    // webhook, exec or file
+	URL     string   `json:"url"`     // url notifications are POSTed to (webhook)
+	Command []string `json:"command"` // command and arguments receiving notifications on stdin (exec)
+	Path    string   `json:"path"`    // file notifications are appended to (file)
+}
+
+// EscalationConfig defines the escalation policy of unacknowledged incidents
+type EscalationConfig struct {
+	Primary        string   `json:"primary"`         // channel notified as soon as an incident opens
+	RepeatInterval Duration `json:"repeat_interval"` // unacknowledged incidents are re-notified every `RepeatInterval` (0 disables)
+	Secondary      string   `json:"secondary"`       // channel notified once an incident is unacknowledged for `EscalateAfter`
+	EscalateAfter  Duration `json:"escalate_after"`
+	// maps severities (info, warning or critical) to the channel notified instead of `Primary`, e.g. warnings to chat and criticals to a pager
+	Routes map[string]string `json:"routes"`
+}
+
+// Duration is a time.Duration written as a string like "5m" in the configuration file
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string like "1m30s"
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5m\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string like "1m30s"
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads the JSON configuration file at `path` and sets the corresponding config variables
+func Load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file File
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		// locate syntax and type errors in the file
+		offset := int64(-1)
+		switch err := err.(type) {
+		case *json.SyntaxError:
+			offset = err.Offset
+		case *json.UnmarshalTypeError:
+			offset = err.Offset
+		}
+		if offset >= 0 {
+			line, column := position(data, offset)
+			return fmt.Errorf("parsing %s:%d:%d: %v", path, line, column, err)
+		}
+		return fmt.Errorf("parsing %s: %v", path, err)
+	}
+	Monitors = file.Monitors
+	Rules = file.Rules
+	Notifiers = file.Notifiers
+	Escalation = file.Escalation
+	StateFile = file.StateFile
+	if DataDir == "" { // the command line takes precedence
+		DataDir = file.DataDir
+	}
+	return nil
+}
+
+// position returns the line and column (starting at 1) of the byte at `offset` in `data`
+func position(data []byte, offset int64) (line, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
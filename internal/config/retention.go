@@ -0,0 +1,95 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention is how long stored reports and their per-minute, per-hour and per-day rollups are kept, 0 keeps them forever
+type Retention struct {
+	Raw, Minute, Hour, Day time.Duration
+}
+
+// ParseRetention parses retentions written like "raw=7d,minute=30d,hour=90d,day=0", tiers which aren't given keep
+// the retention of `def`, see Validate
+func ParseRetention(s string, def Retention) (Retention, error) {
+	retention := def
+	tiers := map[string]*time.Duration{"raw": &retention.Raw, "minute": &retention.Minute, "hour": &retention.Hour, "day": &retention.Day}
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		i := strings.Index(field, "=")
+		if i < 0 {
+			return def, fmt.Errorf("retention %q: expected tier=duration", field)
+		}
+		tier, ok := tiers[strings.TrimSpace(field[:i])]
+		if !ok {
+			return def, fmt.Errorf("retention %q: unknown tier, expected raw, minute, hour or day", field)
+		}
+		d, err := parseDays(strings.TrimSpace(field[i+1:]))
+		if err != nil {
+			return def, fmt.Errorf("retention %q: %v", field, err)
+		}
+		*tier = d
+	}
+	return retention, retention.Validate()
+}
+
+// parseDays parses a duration which can also be written in days, like "90d"
+func parseDays(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Validate checks that retentions aren't negative, and that coarser tiers are kept at least as long as finer ones
+// (as they're rolled up from them)
+func (r Retention) Validate() error {
+	tiers := []struct {
+		name      string
+		retention time.Duration
+	}{{"raw", r.Raw}, {"minute", r.Minute}, {"hour", r.Hour}, {"day", r.Day}}
+	for i, tier := range tiers {
+		if tier.retention < 0 {
+			return fmt.Errorf("%s retention must not be negative", tier.name)
+		}
+		if i > 0 && tier.retention != 0 && (tiers[i-1].retention == 0 || tier.retention < tiers[i-1].retention) {
+			return errors.New(tier.name + " retention must not be shorter than " + tiers[i-1].name + " retention")
+		}
+	}
+	return nil
+}
+
+// String writes retentions as parsed by ParseRetention
+func (r *Retention) String() string {
+	if r == nil {
+		return ""
+	}
+	format := func(d time.Duration) string {
+		if d%(24*time.Hour) == 0 {
+			return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+		}
+		return d.String()
+	}
+	return fmt.Sprintf("raw=%s,minute=%s,hour=%s,day=%s", format(r.Raw), format(r.Minute), format(r.Hour), format(r.Day))
+}
+
+// Set parses the retentions of a flag, tiers which aren't given keep their current retention
+func (r *Retention) Set(s string) error {
+	parsed, err := ParseRetention(s, *r)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
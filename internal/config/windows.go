@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a named window over which stats of websites are aggregated
+type Window struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Windows is a list of windows written like "short=10s,long=1m", or "1m,5m,1h" where windows are named after
+// their duration, it can be used as a flag
+type Windows []Window
+
+// ParseWindows parses a comma-separated list of windows, see Validate
+func ParseWindows(s string) (Windows, error) {
+	var windows Windows
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, value := field, field
+		if i := strings.Index(field, "="); i >= 0 {
+			name, value = strings.TrimSpace(field[:i]), strings.TrimSpace(field[i+1:])
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("window %q: %v", field, err)
+		}
+		windows = append(windows, Window{Name: name, Duration: duration})
+	}
+	if err := windows.Validate(); err != nil {
+		return nil, err
+	}
+	return windows, nil
+}
+
+// Validate checks that there's at least one window, and that windows have unique names and positive durations
+func (windows Windows) Validate() error {
+	if len(windows) == 0 {
+		return errors.New("at least one window must be given")
+	}
+	names := make(map[string]bool)
+	for _, w := range windows {
+		if w.Name == "" {
+			return fmt.Errorf("window %v: missing name", w.Duration)
+		}
+		if w.Duration <= 0 {
+			return fmt.Errorf("window %q: duration must be positive", w.Name)
+		}
+		if names[w.Name] {
+			return fmt.Errorf("duplicate window name %q", w.Name)
+		}
+		names[w.Name] = true
+	}
+	return nil
+}
+
+// String writes the windows as parsed by ParseWindows
+func (windows *Windows) String() string {
+	if windows == nil {
+		return ""
+	}
+	fields := make([]string, 0, len(*windows))
+	for _, w := range *windows {
+		fields = append(fields, w.Name+"="+w.Duration.String())
+	}
+	return strings.Join(fields, ",")
+}
+
+// Set parses the windows of a flag
+func (windows *Windows) Set(s string) error {
+	parsed, err := ParseWindows(s)
+	if err != nil {
+		return err
+	}
+	*windows = parsed
+	return nil
+}
+
+// Longest returns the duration of the longest window, 0 if there's none
+func (windows Windows) Longest() time.Duration {
+	var longest time.Duration
+	for _, w := range windows {
+		if w.Duration > longest {
+			longest = w.Duration
+		}
+	}
+	return longest
+}
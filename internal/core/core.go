@@ -0,0 +1,265 @@
+// Package core monitors websites: it wires the monitors of a registry to alert rules, incidents, storage and hooks.
+// pkg/monitor wraps it with a public API, and the iseeu command uses it directly as its terminal UI and HTTP API need
+// its registry, incidents and store, which aren't part of the public API of pkg/monitor
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/notify"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// Target is a website to monitor
+type Target struct {
+	URL       string
+	Interval  time.Duration // polling interval
+	Name      string        // optional name, used as id when set
+	Tags      []string      // optional free-form tags
+	DependsOn []string      // names or urls of targets this one depends on, whose outages suppress its alerts
+}
+
+// Config configures a Monitor, its settings are expected to be validated
+type Config struct {
+	Targets    []Target
+	Settings   *metrics.Settings // windows and alert settings of the metrics of monitors
+	Rules      []*rules.Rule     // alert rules evaluated against every website
+	Notifiers  map[string]notify.Notifier
+	Escalation config.EscalationConfig
+	StateFile  string // file open incidents are persisted in (empty disables it)
+	DataDir    string // directory reports and alert events are stored in (empty disables storage)
+	Retention  config.Retention
+	Clock      clock.Clock // clock of monitors and incidents, the real one when nil
+}
+
+// Monitor monitors websites, it's safe for concurrent use
+type Monitor struct {
+	Registry  *registry.Registry
+	Incidents *incident.Manager
+	Store     *storage.Store // nil when storage is disabled
+
+	targets   []Target
+	ruleset   []*rules.Rule
+	retention config.Retention
+
+	mu              sync.RWMutex
+	onAdd, onRemove []func(*registry.Monitor)
+	stop            context.CancelFunc // stops ticking incidents and compacting, nil until started
+	aborting        bool               // set while a failed Start removes the monitors it added
+}
+
+// New inits a Monitor configured by `c`, which starts monitoring with Start
+func New(c Config) (*Monitor, error) {
+	m := &Monitor{targets: c.Targets, ruleset: c.Rules, retention: c.Retention}
+	var err error
+	if m.Incidents, err = incident.NewManager(c.Escalation, c.Notifiers, c.StateFile); err != nil {
+		return nil, err
+	}
+	if c.DataDir != "" {
+		if err := c.Retention.Validate(); err != nil {
+			return nil, err
+		}
+		if m.Store, err = storage.Open(c.DataDir); err != nil {
+			return nil, err
+		}
+	}
+	m.Registry = registry.New(m.added, m.removed)
+	m.Registry.Settings = c.Settings
+	if c.Clock != nil {
+		m.Registry.Clock = c.Clock
+	}
+	m.Incidents.Clock = m.Registry.Clock
+	return m, nil
+}
+
+// Start starts monitoring the targets, until Stop is called
+func (m *Monitor) Start(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return errors.New("monitor already started")
+	}
+	ctx, m.stop = context.WithCancel(ctx)
+	m.mu.Unlock()
+	go m.Incidents.Run(ctx)
+	if m.Store != nil {
+		go m.compact(ctx)
+	}
+
+	// targets can depend on any other target, whatever their order
+	var added []string
+	for _, t := range m.targets {
+		mon, err := m.add(t)
+		if err != nil {
+			m.abort(added)
+			return err
+		}
+		added = append(added, mon.Url)
+	}
+	for _, t := range m.targets {
+		if err := m.dependsOn(t); err != nil {
+			m.abort(added)
+			return err
+		}
+	}
+
+	// incidents restored from the state file of websites which are no longer monitored would never be resolved
+	var urls []string
+	for _, mon := range m.Registry.Monitors() {
+		urls = append(urls, mon.Url)
+	}
+	m.Incidents.Retain(urls...)
+	return nil
+}
+
+// abort undoes a failed Start, so that it can be retried: it stops ticking incidents and compacting, and removes the
+// monitors of `urls` it added, keeping their incidents restored from the state file
+func (m *Monitor) abort(urls []string) {
+	m.mu.Lock()
+	m.stop()
+	m.stop = nil
+	m.aborting = true
+	m.mu.Unlock()
+	for _, url := range urls {
+		m.Registry.Remove(url)
+		m.Incidents.Forget(url)
+	}
+	m.mu.Lock()
+	m.aborting = false
+	m.mu.Unlock()
+}
+
+// compact rolls stored reports up and deletes those older than their retention on start, then every hour until `ctx` is done
+// errors are reported by the LastError of the store
+func (m *Monitor) compact(ctx context.Context) {
+	clk := m.Registry.Clock
+	ticker := clk.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		m.Store.Compact(clk.Now(), m.retention)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops probing, and waits until in-flight requests are processed and notifications are sent, or `ctx` is done
+func (m *Monitor) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	if m.stop != nil {
+		m.stop()
+	}
+	m.mu.Unlock()
+	if err := m.Registry.Close(ctx); err != nil {
+		return err
+	}
+	return m.Incidents.Close(ctx)
+}
+
+// Add starts monitoring a target, its dependencies must already be monitored
+func (m *Monitor) Add(t Target) error {
+	if _, err := m.add(t); err != nil {
+		return err
+	}
+	if err := m.dependsOn(t); err != nil {
+		m.Registry.Remove(t.URL)
+		return err
+	}
+	return nil
+}
+
+// add adds the monitor of `t`, whose polling interval must fit in windows
+func (m *Monitor) add(t Target) (*registry.Monitor, error) {
+	mon, err := m.Registry.Add(t.URL, t.Interval, t.Name, t.Tags...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", t.URL, err)
+	}
+	return mon, nil
+}
+
+// dependsOn declares the dependencies of `t`
+func (m *Monitor) dependsOn(t Target) error {
+	child := m.Registry.Get(t.URL)
+	if child == nil {
+		return fmt.Errorf("unknown monitor %s", t.URL)
+	}
+	for _, ref := range t.DependsOn {
+		parent := m.Registry.Get(ref)
+		if parent == nil {
+			return fmt.Errorf("%s: unknown dependency %q", child.ID(), ref)
+		}
+		if parent == child {
+			return fmt.Errorf("%s: monitor can't depend on itself", child.ID())
+		}
+		if err := m.Incidents.DependsOn(child.Url, parent.Url); err != nil {
+			return fmt.Errorf("%s: %v", child.ID(), err)
+		}
+	}
+	return nil
+}
+
+// Watch registers hooks called when a monitor is added, before it processes reports, and once it's removed
+// hooks can be nil, they must be registered before Start
+func (m *Monitor) Watch(onAdd, onRemove func(*registry.Monitor)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if onAdd != nil {
+		m.onAdd = append(m.onAdd, onAdd)
+	}
+	if onRemove != nil {
+		m.onRemove = append(m.onRemove, onRemove)
+	}
+}
+
+// added wires a new monitor to rules, incidents, storage and hooks
+func (m *Monitor) added(mon *registry.Monitor) {
+	if len(m.ruleset) > 0 {
+		mon.Metrics.Rules = rules.NewEvaluator(m.ruleset)
+	}
+	// restored incidents of the website are reconciled with its first evaluation, as recoveries while it wasn't
+	// monitored don't cause any event
+	evaluated := false
+	mon.Metrics.SubscribeReports(func(*metrics.Record) {
+		if !evaluated {
+			evaluated = true
+			m.Incidents.Reconcile(mon.Url, mon.Metrics.Raised())
+		}
+	})
+	mon.Metrics.Subscribe(m.Incidents.Handle)
+	if m.Store != nil {
+		mon.Metrics.SubscribeReports(func(r *metrics.Record) { m.Store.AppendReport(r) })
+		mon.Metrics.Subscribe(func(e *metrics.Event) { m.Store.AppendEvent(e) })
+	}
+
+	m.mu.RLock()
+	hooks := m.onAdd
+	m.mu.RUnlock()
+	for _, fn := range hooks {
+		fn(mon)
+	}
+}
+
+// removed drops the incidents of a removed monitor, unless a failed Start removes it
+func (m *Monitor) removed(mon *registry.Monitor) {
+	m.mu.RLock()
+	hooks, aborting := m.onRemove, m.aborting
+	m.mu.RUnlock()
+	if !aborting {
+		m.Incidents.Remove(mon.Url)
+	}
+	for _, fn := range hooks {
+		fn(mon)
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
 	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
 	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
 
 	ui "github.com/gizak/termui/v3"
 	"github.com/gizak/termui/v3/widgets"
@@ -19,6 +22,10 @@ type UI struct {
 	Status     *widgets.Paragraph
 	StatsTable *widgets.Table
 	Alerts     *widgets.List
+	incidents  *incident.Manager // open incidents shown in status
+	store      *storage.Store    // store whose write errors are shown in status (nil when storage is disabled)
+	clock      clock.Clock       // clock of refreshes and alert times
+	window     int               // index in config.StatsWindows of the window whose stats are shown
 }
 
 // Init creates widgets, sets sizes and labels.
@@ -50,10 +57,12 @@ func (t *UI) Init() error {
 				"Status code count",
 				"Availability",
 				"ConnectDuration",
-				"FirstByteDuration"},
+				"FirstByteDuration",
+				"TotalDuration"},
 		}
 		table.TextStyle = ui.NewStyle(ui.ColorWhite)
 		table.RowSeparator = false
+		table.Title = windowTitle(0)
 		return table
 	}()
 	t.Alerts = func() *widgets.List {
@@ -77,10 +86,45 @@ func (t *UI) Init() error {
 	return nil
 }
 
+// windowTitle returns the title of the stats table showing the window at index `i` of config.StatsWindows
+func windowTitle(i int) string {
+	if i >= len(config.StatsWindows) {
+		return ""
+	}
+	w := config.StatsWindows[i]
+	return fmt.Sprintf("Stats of the past %v (%s window %d/%d) [Press w or 1-9 to switch windows]", w.Duration, w.Name, i+1, len(config.StatsWindows))
+}
+
+// ShowWindow shows the stats over the window at index `i` of config.StatsWindows (ignored if there's none)
+func (t *UI) ShowWindow(data []*metrics.Metrics, i int) {
+	if i < 0 || i >= len(config.StatsWindows) {
+		return
+	}
+	t.window = i
+	now := t.clock.Now()
+	for _, m := range data {
+		m.Expire(now)
+		m.Mu.RLock()
+		defer m.Mu.RUnlock()
+	}
+	t.updateStatsTable(data)
+	ui.Render(t.StatsTable)
+}
+
+// NextWindow shows the stats over the next window of config.StatsWindows, going back to the first after the last
+func (t *UI) NextWindow(data []*metrics.Metrics) {
+	if len(config.StatsWindows) > 0 {
+		t.ShowWindow(data, (t.window+1)%len(config.StatsWindows))
+	}
+}
+
 // Update updates UI widgets from UIData.
-func (t *UI) UpdateUI(data []*metrics.Metrics, refreshInterval time.Duration) {
+func (t *UI) UpdateUI(data []*metrics.Metrics) {
 	// Lock so only one reader or writer goroutines at a time can access the map.
+	// stats are shown over the windows ending now, whether websites reported lately or not
+	now := t.clock.Now()
 	for _, m := range data {
+		m.Expire(now)
 		m.Mu.RLock()
 		defer m.Mu.RUnlock()
 	}
@@ -88,43 +132,36 @@ func (t *UI) UpdateUI(data []*metrics.Metrics, refreshInterval time.Duration) {
 	/* -------------------------------------------------------------------------- */
 	/*                                   HEADERS                                  */
 	/* -------------------------------------------------------------------------- */
-	t.Title.Text = fmt.Sprintf("monitoring %d websites, press q to quit", len(data))
-	t.Status.Text = fmt.Sprintf("Last update: %v (refreshes every %vs)", data[0].LastTimestamp.Format(time.Stamp), refreshInterval.Seconds())
+	t.Title.Text = fmt.Sprintf("monitoring %d websites, press q to quit, a to acknowledge incidents, w to switch windows", len(data))
+	var lastUpdate time.Time
+	for _, m := range data {
+		if m.LastTimestamp.After(lastUpdate) {
+			lastUpdate = m.LastTimestamp
+		}
+	}
+	t.Status.Text = fmt.Sprintf("Last update: %v (refreshes every %vs)", lastUpdate.Format(time.Stamp), config.UIRefreshInterval.Seconds())
+	if open := t.incidents.Incidents(); len(open) > 0 {
+		unacknowledged := 0
+		for _, inc := range open {
+			if !inc.Acknowledged {
+				unacknowledged++
+			}
+		}
+		t.Status.Text += fmt.Sprintf(" - %d open incidents (%d unacknowledged)", len(open), unacknowledged)
+	}
+	if err := t.incidents.LastError(); err != nil {
+		t.Status.Text += fmt.Sprintf(" - %v", err)
+	}
+	if t.store != nil {
+		if err := t.store.LastError(); err != nil {
+			t.Status.Text += fmt.Sprintf(" - %v", err)
+		}
+	}
 
 	/* -------------------------------------------------------------------------- */
 	/*                                MIDDLE TABLE                                */
 	/* -------------------------------------------------------------------------- */
-	// Update stats table
-	t.StatsTable.Rows = t.StatsTable.Rows[:1]
-	var agg *metrics.IntervalAggData
-	for _, stat := range data {
-		switch refreshInterval {
-		case config.ShortUIRefreshInterval:
-			agg = stat.AggData.Short
-		case config.LongUIRefreshInterval:
-			agg = stat.AggData.Long
-		}
-
-		// Update stat row in table
-		t.StatsTable.Rows = append(t.StatsTable.Rows,
-			[]string{stat.Url,
-				fmt.Sprintf("%vs", stat.PollingInterval.Seconds()),
-				strings.Join(formatStatusCodeCount(agg.StatusCodesCount), ""),
-				strconv.FormatFloat(agg.Availability*100, 'f', 2, 64) + "%",
-				fmt.Sprintf("%dms (%dms)", agg.ConnectDuration[0], agg.ConnectDuration[1]),
-				fmt.Sprintf("%dms (%dms)", agg.FirstByteDuration[0], agg.FirstByteDuration[1]),
-			})
-	}
-
-	// Colors table in different color depending on refreshInterval
-	switch refreshInterval {
-	case config.LongUIRefreshInterval:
-		t.Title.TextStyle = ui.NewStyle(ui.ColorCyan)
-		t.StatsTable.TextStyle = ui.NewStyle(ui.ColorCyan)
-	case config.ShortUIRefreshInterval:
-		t.Title.TextStyle = ui.Theme.Default
-		t.StatsTable.TextStyle = ui.Theme.Table.Text
-	}
+	t.updateStatsTable(data)
 
 	/* -------------------------------------------------------------------------- */
 	/*                                   ALERTS                                   */
@@ -134,11 +171,47 @@ func (t *UI) UpdateUI(data []*metrics.Metrics, refreshInterval time.Duration) {
 
 	// update alerts
 	for _, stat := range data {
+		// alerts of websites whose dependency is down are grouped under the dependency alert
+		if t.incidents.SuppressedBy(stat.Url) != "" {
+			continue
+		}
 		if stat.Alert.WebsiteWasDown {
-			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v is down. availability=%.2f, time=%v](fg:red)", stat.Url, stat.Alert.Availability, time.Now().Format("2006-01-02 15:04:05")))
+			var affecting string
+			if children := t.incidents.Suppressing(stat.Url); len(children) > 0 {
+				affecting = fmt.Sprintf(" affecting: %v,", strings.Join(children, ", "))
+			}
+			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v is down. availability=%.2f,%s time=%v](fg:red)", stat.Url, stat.Alert.Availability, affecting, t.clock.Now().Format("2006-01-02 15:04:05")))
+		}
+		if stat.Alert.AvailabilityChanged && stat.Alert.AvailabilityLevel == metrics.Warning {
+			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v is degraded. availability=%.2f, time=%v](fg:yellow)", stat.Url, stat.Alert.Availability, t.clock.Now().Format("2006-01-02 15:04:05")))
+		}
+		if stat.Alert.AvailabilityChanged && stat.Alert.AvailabilityLevel == metrics.OK {
+			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v has recovered. availability=%.2f, time=%v](fg:green)", stat.Url, stat.Alert.Availability, t.clock.Now().Format("2006-01-02 15:04:05")))
+		}
+		if stat.Alert.FlappingStarted {
+			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v is flapping. state change=%.2f, time=%v](fg:magenta)", stat.Url, stat.Alert.StateChange, t.clock.Now().Format("2006-01-02 15:04:05")))
 		}
-		if stat.Alert.WebsiteHasRecovered {
-			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v has recovered. availability=%.2f, time=%v](fg:green)", stat.Url, stat.Alert.Availability, time.Now().Format("2006-01-02 15:04:05")))
+		if stat.Alert.FlappingStopped {
+			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v stopped flapping. state change=%.2f, time=%v](fg:green)", stat.Url, stat.Alert.StateChange, t.clock.Now().Format("2006-01-02 15:04:05")))
+		}
+		if stat.Alert.LatencyChanged && stat.Alert.LatencyLevel == metrics.Critical {
+			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v is slow. %s %s latency=%v, time=%v](fg:red)", stat.Url, config.LatencyAggregate, config.LatencyPhase, stat.Alert.Latency.Round(time.Millisecond), t.clock.Now().Format("2006-01-02 15:04:05")))
+		}
+		if stat.Alert.LatencyChanged && stat.Alert.LatencyLevel == metrics.Warning {
+			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v is getting slow. %s %s latency=%v, time=%v](fg:yellow)", stat.Url, config.LatencyAggregate, config.LatencyPhase, stat.Alert.Latency.Round(time.Millisecond), t.clock.Now().Format("2006-01-02 15:04:05")))
+		}
+		if stat.Alert.LatencyChanged && stat.Alert.LatencyLevel == metrics.OK {
+			t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Website %v latency has recovered. %s %s latency=%v, time=%v](fg:green)", stat.Url, config.LatencyAggregate, config.LatencyPhase, stat.Alert.Latency.Round(time.Millisecond), t.clock.Now().Format("2006-01-02 15:04:05")))
+		}
+		if stat.Rules != nil {
+			for _, alert := range stat.Rules.Alerts {
+				if alert.HasFired {
+					t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Rule %v is firing for website %v (%v). %v time=%v](fg:%s)", alert.Rule.Name, stat.Url, alert.Rule.Severity, alert.Rule.Annotations["summary"], t.clock.Now().Format("2006-01-02 15:04:05"), severityColors[alert.Rule.Severity]))
+				}
+				if alert.HasResolved {
+					t.Alerts.Rows = append(t.Alerts.Rows, fmt.Sprintf("[Rule %v is resolved for website %v. time=%v](fg:green)", alert.Rule.Name, stat.Url, t.clock.Now().Format("2006-01-02 15:04:05")))
+				}
+			}
 		}
 	}
 	// if there's new alerts scrolldown
@@ -153,6 +226,46 @@ func (t *UI) UpdateUI(data []*metrics.Metrics, refreshInterval time.Duration) {
 
 }
 
+// updateStatsTable updates the stats table over the shown window, coloring rows by alert level
+// it must be called with the metrics locked
+func (t *UI) updateStatsTable(data []*metrics.Metrics) {
+	t.StatsTable.Title = windowTitle(t.window)
+	t.StatsTable.Rows = t.StatsTable.Rows[:1]
+	t.StatsTable.RowStyles = make(map[int]ui.Style)
+	for _, stat := range data {
+		if t.window >= len(stat.AggData.Windows) {
+			continue
+		}
+		agg := stat.AggData.Windows[t.window]
+
+		availability := strconv.FormatFloat(agg.Availability*100, 'f', 2, 64) + "%"
+		if stat.Alert.Flapping {
+			availability += " (flapping)"
+		}
+
+		switch stat.Alert.Level() {
+		case metrics.Critical:
+			t.StatsTable.RowStyles[len(t.StatsTable.Rows)] = ui.NewStyle(ui.ColorRed)
+		case metrics.Warning:
+			t.StatsTable.RowStyles[len(t.StatsTable.Rows)] = ui.NewStyle(ui.ColorYellow)
+		}
+
+		// Update stat row in table
+		t.StatsTable.Rows = append(t.StatsTable.Rows,
+			[]string{stat.Url,
+				fmt.Sprintf("%vs", stat.PollingInterval.Seconds()),
+				strings.Join(formatStatusCodeCount(agg.StatusCodesCount), ""),
+				availability,
+				fmt.Sprintf("%dms (%dms)", agg.ConnectDuration[0], agg.ConnectDuration[1]),
+				fmt.Sprintf("%dms (%dms)", agg.FirstByteDuration[0], agg.FirstByteDuration[1]),
+				fmt.Sprintf("%dms (%dms)", agg.TotalDuration[0], agg.TotalDuration[1]),
+			})
+	}
+}
+
+// severityColors maps alert severities to the colors of their alerts
+var severityColors = map[string]string{"info": "cyan", "warning": "yellow", "critical": "red"}
+
 // formatStatusCodeCount format status code count in a better format
 func formatStatusCodeCount(statusCodesMap map[int]int) []string {
 	// Format status code count
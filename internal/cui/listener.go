@@ -1,16 +1,22 @@
 package cui
 
 import (
-	"time"
+	"context"
+	"fmt"
 
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
 	"github.com/NouamaneTazi/website-monitor/internal/config"
-	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
 	"github.com/gizak/termui/v3"
 )
 
-// handleCUI creates CUI and handles keyboardBindings
-func HandleCUI(data []*metrics.Metrics) error {
-	var ui UI
+// handleCUI creates CUI and handles keyboardBindings, refreshing it on the ticks of `clk`
+// it returns when the user quits or `ctx` is done, e.g. on SIGTERM
+// `store` is nil when storage is disabled
+func HandleCUI(ctx context.Context, monitors *registry.Registry, incidents *incident.Manager, store *storage.Store, clk clock.Clock) error {
+	ui := UI{incidents: incidents, store: store, clock: clk}
 
 	if err := ui.Init(); err != nil {
 		return err
@@ -18,23 +24,23 @@ func HandleCUI(data []*metrics.Metrics) error {
 	defer ui.Close()
 
 	// Ticker that refreshes UI
-	shortTick := time.NewTicker(config.ShortUIRefreshInterval)
-	longTick := time.NewTicker(config.LongUIRefreshInterval)
+	tick := clk.NewTicker(config.UIRefreshInterval)
+	defer tick.Stop()
 
 	// keyboard bindings
 	uiEvents := termui.PollEvents()
 	for {
 		select {
-		case <-longTick.C:
-			ui.UpdateUI(data, config.LongUIRefreshInterval)
+		case <-tick.C:
+			ui.UpdateUI(monitors.Metrics())
 
-		case <-shortTick.C:
-			ui.UpdateUI(data, config.ShortUIRefreshInterval)
+		case <-ctx.Done():
+			return nil
 
 		case e := <-uiEvents:
 			switch e.ID {
 			case "q", "<C-c>":
-				// TODO: interrupt app gracefully
+				// the caller shuts monitoring down gracefully
 				return nil
 			case "j", "<Down>":
 				ui.Alerts.ScrollDown()
@@ -52,6 +58,14 @@ func HandleCUI(data []*metrics.Metrics) error {
 				ui.Alerts.ScrollTop()
 			case "G", "<End>":
 				ui.Alerts.ScrollBottom()
+			case "w", "<Tab>":
+				ui.NextWindow(monitors.Metrics())
+			case "1", "2", "3", "4", "5", "6", "7", "8", "9":
+				ui.ShowWindow(monitors.Metrics(), int(e.ID[0]-'1'))
+			case "a":
+				count := incidents.AcknowledgeAll()
+				ui.Alerts.Rows = append(ui.Alerts.Rows, fmt.Sprintf("[Acknowledged %d incidents, time=%v](fg:cyan)", count, clk.Now().Format("2006-01-02 15:04:05")))
+				ui.Alerts.ScrollBottom()
 			}
 			termui.Render(ui.Alerts)
 		}
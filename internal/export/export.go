@@ -0,0 +1,251 @@
+// Package export writes the stored history of monitors as tables of reports, rollups and alert events,
+// in CSV, JSON or NDJSON files with a stable column ordering, e.g. for monthly reports in spreadsheets
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{"csv", "json", "ndjson"}
+
+// Monitor is a website whose history is exported
+type Monitor struct {
+	Url  string
+	Name string // optional, defaults to the url
+}
+
+// Options defines what is exported
+type Options struct {
+	From, To time.Time     // zero times are unbounded
+	Interval time.Duration // interval of rollups, e.g. an hour or a day
+	Monitors []Monitor     // exported monitors, in this order (defaults to every stored website, sorted by url)
+}
+
+// Columns of the exported tables, in the order they are written
+var (
+	ReportColumns = []string{"time", "name", "url", "polling_interval_s", "status_code", "connect_ms", "first_byte_ms", "total_ms"}
+	RollupColumns = []string{"start", "end", "name", "url", "probes", "up", "availability", "status_codes",
+		"connect_avg_ms", "first_byte_avg_ms", "total_avg_ms", "total_max_ms"}
+	EventColumns = []string{"time", "name", "url", "alert", "state", "severity", "message"}
+)
+
+// Export writes the `reports`, `rollups` and `events` tables of the history of `store` to `dir`,
+// in files named after the table and `format` (e.g. `reports.csv`)
+// durations are in milliseconds, -1 when the request failed (or when no request of a rollup succeeded)
+func Export(store *storage.Store, dir, format string, opts Options) error {
+	if opts.Interval <= 0 {
+		return fmt.Errorf("invalid rollup interval %v", opts.Interval)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	names := make(map[string]string)
+	for _, m := range opts.Monitors {
+		names[m.Url] = m.Name
+		if m.Name == "" {
+			names[m.Url] = m.Url
+		}
+	}
+	selected := func(url string) bool {
+		if _, ok := names[url]; !ok && len(opts.Monitors) == 0 {
+			names[url] = url
+		}
+		_, ok := names[url]
+		return ok
+	}
+
+	// reports are streamed to their table while they are rolled up
+	reports, err := create(dir, "reports", format, ReportColumns)
+	if err != nil {
+		return err
+	}
+	rollups := make(map[rollupKey]*rollup)
+	err = store.Reports(opts.From, opts.To, func(record *metrics.Record) error {
+		r := record.Report
+		if !selected(r.Url) {
+			return nil
+		}
+		key := rollupKey{r.Url, record.Time.UTC().Truncate(opts.Interval)}
+		if rollups[key] == nil {
+			rollups[key] = &rollup{statusCodes: make(map[int]int)}
+		}
+		rollups[key].add(record)
+		return reports.write([]interface{}{record.Time.UTC(), names[r.Url], r.Url, r.PollingInterval.Seconds(), r.StatusCode,
+			milliseconds(r.ConnectDuration), milliseconds(r.FirstByteDuration), milliseconds(r.TotalDuration)})
+	})
+	if closeErr := reports.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeRollups(dir, format, rollups, names, order(opts.Monitors, names), opts.Interval); err != nil {
+		return err
+	}
+
+	events, err := store.Events(opts.From, opts.To)
+	if err != nil {
+		return err
+	}
+	table, err := create(dir, "events", format, EventColumns)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if !selected(e.Url) {
+			continue
+		}
+		state := "firing"
+		if e.Resolved {
+			state = "resolved"
+		}
+		if err := table.write([]interface{}{e.Time.UTC(), names[e.Url], e.Url, e.Alert, state, e.Severity, e.Message}); err != nil {
+			table.close()
+			return err
+		}
+	}
+	return table.close()
+}
+
+// order returns the rank of each exported monitor: their order in `monitors`, or the order of their urls
+func order(monitors []Monitor, names map[string]string) map[string]int {
+	ranks := make(map[string]int)
+	if len(monitors) > 0 {
+		for i, m := range monitors {
+			ranks[m.Url] = i
+		}
+		return ranks
+	}
+	urls := make([]string, 0, len(names))
+	for url := range names {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for i, url := range urls {
+		ranks[url] = i
+	}
+	return ranks
+}
+
+// rollupKey identifies the rollup of the reports of a website over an interval
+type rollupKey struct {
+	url   string
+	start time.Time
+}
+
+// rollup aggregates the reports of a website over an interval
+type rollup struct {
+	probes, up  int
+	statusCodes map[int]int
+	connect     sum
+	firstByte   sum
+	total       sum
+}
+
+// sum accumulates the durations of traced requests (-1 means there has been an error)
+type sum struct {
+	total, max time.Duration
+	n          int
+}
+
+func (s *sum) add(d time.Duration) {
+	if d == -1 {
+		return
+	}
+	s.total += d
+	s.n++
+	if d > s.max {
+		s.max = d
+	}
+}
+
+// average returns the average duration, or -1 if no request was traced
+func (s *sum) average() time.Duration {
+	if s.n == 0 {
+		return -1
+	}
+	return s.total / time.Duration(s.n)
+}
+
+func (r *rollup) add(record *metrics.Record) {
+	r.probes++
+	if record.Report.StatusCode == 200 {
+		r.up++
+	}
+	r.statusCodes[record.Report.StatusCode]++
+	r.connect.add(record.Report.ConnectDuration)
+	r.firstByte.add(record.Report.FirstByteDuration)
+	r.total.add(record.Report.TotalDuration)
+}
+
+// writeRollups writes the `rollups` table, sorted by interval then monitor
+func writeRollups(dir, format string, rollups map[rollupKey]*rollup, names map[string]string, ranks map[string]int, interval time.Duration) error {
+	keys := make([]rollupKey, 0, len(rollups))
+	for key := range rollups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].start.Equal(keys[j].start) {
+			return keys[i].start.Before(keys[j].start)
+		}
+		return ranks[keys[i].url] < ranks[keys[j].url]
+	})
+
+	table, err := create(dir, "rollups", format, RollupColumns)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		r := rollups[key]
+		maxTotal := time.Duration(-1)
+		if r.total.n > 0 {
+			maxTotal = r.total.max
+		}
+		err := table.write([]interface{}{key.start, key.start.Add(interval), names[key.url], key.url, r.probes, r.up,
+			float64(r.up) / float64(r.probes), statusCodes(r.statusCodes), milliseconds(r.connect.average()),
+			milliseconds(r.firstByte.average()), milliseconds(r.total.average()), milliseconds(maxTotal)})
+		if err != nil {
+			table.close()
+			return err
+		}
+	}
+	return table.close()
+}
+
+// statusCodes formats the count of each status code, sorted by code, e.g. "200:58 503:2" (0 is for failed requests)
+func statusCodes(counts map[int]int) string {
+	codes := make([]int, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%d:%d", code, counts[code])
+	}
+	return strings.Join(parts, " ")
+}
+
+// milliseconds converts a duration to milliseconds rounded to the microsecond, keeping -1 for failed requests
+func milliseconds(d time.Duration) float64 {
+	if d == -1 {
+		return -1
+	}
+	return float64(d.Round(time.Microsecond)) / float64(time.Millisecond)
+}
+
+// path returns the path of the file of `table` in `format`
+func path(dir, table, format string) string {
+	return filepath.Join(dir, table+"."+format)
+}
@@ -0,0 +1,129 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// tableWriter writes the rows of a table, whose values are in the order of its columns
+type tableWriter interface {
+	write(row []interface{}) error
+	close() error
+}
+
+// create creates the file of `table` in `dir` and returns a writer of its rows in `format`
+func create(dir, table, format string, columns []string) (tableWriter, error) {
+	if format != "csv" && format != "json" && format != "ndjson" {
+		return nil, fmt.Errorf("unknown format %q (expected csv, json or ndjson)", format)
+	}
+	f, err := os.Create(path(dir, table, format))
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	switch format {
+	case "csv":
+		w := &csvWriter{f: f, buf: buf, w: csv.NewWriter(buf)}
+		if err := w.w.Write(columns); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return w, nil
+	case "json":
+		buf.WriteString("[")
+		return &jsonWriter{f: f, buf: buf, columns: columns, array: true}, nil
+	}
+	return &jsonWriter{f: f, buf: buf, columns: columns}, nil
+}
+
+// csvWriter writes a table as CSV, with a header line of its columns
+type csvWriter struct {
+	f   *os.File
+	buf *bufio.Writer
+	w   *csv.Writer
+}
+
+func (c *csvWriter) write(row []interface{}) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		switch v := v.(type) {
+		case time.Time:
+			record[i] = v.Format(time.RFC3339)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) close() error {
+	c.w.Flush()
+	return closeFile(c.f, c.buf, c.w.Error())
+}
+
+// jsonWriter writes a table as a JSON array of objects (`array`), or as an object per line,
+// whose keys are in the order of the columns
+type jsonWriter struct {
+	f       *os.File
+	buf     *bufio.Writer
+	columns []string
+	array   bool
+	rows    int
+}
+
+func (j *jsonWriter) write(row []interface{}) error {
+	if j.array {
+		if j.rows > 0 {
+			j.buf.WriteString(",")
+		}
+		j.buf.WriteString("\n  ")
+	}
+	j.rows++
+	j.buf.WriteString("{")
+	for i, v := range row {
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(time.RFC3339)
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			j.buf.WriteString(",")
+		}
+		fmt.Fprintf(j.buf, "%q:%s", j.columns[i], value)
+	}
+	_, err := j.buf.WriteString("}")
+	if !j.array {
+		_, err = j.buf.WriteString("\n")
+	}
+	return err
+}
+
+func (j *jsonWriter) close() error {
+	if j.array {
+		if j.rows > 0 {
+			j.buf.WriteString("\n")
+		}
+		j.buf.WriteString("]\n")
+	}
+	return closeFile(j.f, j.buf, nil)
+}
+
+// closeFile flushes `buf` and closes `f`, returning the first error
+func closeFile(f *os.File, buf *bufio.Writer, err error) error {
+	if flushErr := buf.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,558 @@
+// Package incident tracks open incidents from alert transitions, and notifies and escalates them
+// following the escalation policy until they are acknowledged or resolved
+package incident
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/notify"
+)
+
+// Incident is an alert of a website that started and isn't resolved yet
+type Incident struct {
+	Key           string    `json:"key"` // url and alert, see `Key`
+	Url           string    `json:"url"`
+	Alert         string    `json:"alert"`
+	Severity      string    `json:"severity"`
+	Message       string    `json:"message"`
+	OpenedAt      time.Time `json:"opened_at"`
+	LastNotified  time.Time `json:"last_notified"`
+	Notifications int       `json:"notifications"`    // number of times the incident was notified
+	Escalated     bool      `json:"escalated"`        // incident was escalated to the secondary channel
+	Acknowledged  bool      `json:"acknowledged"`     // acknowledged incidents are neither repeated nor escalated
+	Parent        string    `json:"parent,omitempty"` // key of the incident of a down dependency this one is grouped under
+}
+
+// Key identifies the incident of an alert of a website
+func Key(url, alert string) string {
+	return url + " " + alert
+}
+
+// Manager tracks open incidents and applies the escalation policy
+type Manager struct {
+	Clock     clock.Clock // time of the changes which aren't caused by an event, e.g. removals
+	mu        sync.Mutex
+	policy    config.EscalationConfig
+	notifiers map[string]notify.Notifier
+	stateFile string               // incidents are persisted to `stateFile` (if not empty) on every change
+	incidents map[string]*Incident // maps incident keys to open incidents
+	parents   map[string][]string  // maps urls to the urls they depend on
+	restored  map[string]bool      // urls with incidents restored from `stateFile`, until they're reconciled
+	lastErr   error                // last notification or persistence error
+	outboxes  map[string]*outbox   // maps channels to their notifications waiting to be sent
+	sending   sync.WaitGroup       // in-flight notifications
+}
+
+// outbox queues the notifications of a channel, sent one at a time so that they arrive in order
+type outbox struct {
+	pending []*notify.Notification
+	running bool // whether a goroutine is sending the pending notifications
+}
+
+// severities of incidents, from the least to the most severe
+var severities = map[string]int{"info": 0, "warning": 1, "critical": 2}
+
+// NewManager inits a Manager and restores the incidents persisted in `stateFile`
+func NewManager(policy config.EscalationConfig, notifiers map[string]notify.Notifier, stateFile string) (*Manager, error) {
+	for _, channel := range []string{policy.Primary, policy.Secondary} {
+		if _, ok := notifiers[channel]; channel != "" && !ok {
+			return nil, fmt.Errorf("escalation channel %q is not a defined notifier", channel)
+		}
+	}
+	for severity, channel := range policy.Routes {
+		if _, ok := severities[severity]; !ok {
+			return nil, fmt.Errorf("unknown severity %q in escalation routes (expected info, warning or critical)", severity)
+		}
+		if _, ok := notifiers[channel]; !ok {
+			return nil, fmt.Errorf("escalation route channel %q is not a defined notifier", channel)
+		}
+	}
+	m := &Manager{
+		Clock:     clock.Real,
+		policy:    policy,
+		notifiers: notifiers,
+		stateFile: stateFile,
+		incidents: make(map[string]*Incident),
+		parents:   make(map[string][]string),
+		restored:  make(map[string]bool),
+		outboxes:  make(map[string]*outbox),
+	}
+	if stateFile == "" {
+		return m, nil
+	}
+
+	data, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var incidents []*Incident
+	if err := json.Unmarshal(data, &incidents); err != nil {
+		return nil, fmt.Errorf("parsing state file %s: %v", stateFile, err)
+	}
+	for _, inc := range incidents {
+		m.incidents[inc.Key] = inc
+		m.restored[inc.Url] = true
+	}
+	return m, nil
+}
+
+// Reconcile resolves the incidents of `url` restored from the state file whose alert isn't raised at the first
+// evaluation of the website after the restart, `raised` mapping the alerts raised then to their severity (see
+// `Metrics.Raised`), alerts which are still raised are left to the events of the website
+func (m *Manager) Reconcile(url string, raised map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.restored[url] {
+		return
+	}
+	delete(m.restored, url)
+	now := m.Clock.Now()
+	for key, inc := range m.incidents {
+		if _, ok := raised[inc.Alert]; inc.Url != url || ok {
+			continue
+		}
+		delete(m.incidents, key)
+		inc.Message = fmt.Sprintf("Website %v %s alert was resolved while it wasn't monitored", inc.Url, inc.Alert)
+		if inc.Notifications > 0 {
+			m.notify(inc, now, true)
+		}
+		m.release(inc, now)
+	}
+	m.save()
+}
+
+// Retain drops the incidents of the websites which aren't in `urls` without notifying, e.g. the restored incidents
+// of websites which are no longer monitored
+func (m *Manager) Retain(urls ...string) {
+	monitored := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		monitored[url] = true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var dropped []*Incident
+	for key, inc := range m.incidents {
+		if !monitored[inc.Url] {
+			delete(m.incidents, key)
+			delete(m.restored, inc.Url)
+			dropped = append(dropped, inc)
+		}
+	}
+	for _, inc := range dropped {
+		m.release(inc, m.Clock.Now())
+	}
+	if len(dropped) > 0 {
+		m.save()
+	}
+}
+
+// Handle opens or resolves the incident of an alert transition, it is meant to be passed to `Metrics.Subscribe`
+func (m *Manager) Handle(e *metrics.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := Key(e.Url, e.Alert)
+	inc, open := m.incidents[key]
+	switch {
+	case !e.Resolved && !open:
+		inc = &Incident{
+			Key:      key,
+			Url:      e.Url,
+			Alert:    e.Alert,
+			Severity: e.Severity,
+			Message:  e.Message,
+			OpenedAt: e.Time,
+		}
+		m.incidents[key] = inc
+
+		// alerts of a website whose dependency is down are grouped under the dependency incident
+		if parent := m.downDependency(e.Url); parent != nil {
+			inc.Parent = parent.Key
+			break
+		}
+		m.notify(inc, e.Time, false)
+		if isDown(inc) {
+			m.group(inc)
+		}
+	case !e.Resolved && open && e.Severity != inc.Severity:
+		// the level of the alert changed, e.g. a degraded website went down
+		wasDown := isDown(inc)
+		if severities[e.Severity] > severities[inc.Severity] {
+			inc.Acknowledged = false // acknowledging a warning doesn't silence its escalation to a critical
+		}
+		inc.Severity, inc.Message = e.Severity, e.Message
+		if inc.Parent == "" {
+			m.notify(inc, e.Time, false)
+		}
+		if wasDown && !isDown(inc) {
+			m.release(inc, e.Time)
+		} else if !wasDown && isDown(inc) {
+			m.group(inc)
+		}
+	case e.Resolved && open:
+		delete(m.incidents, key)
+		inc.Message = e.Message
+		if inc.Notifications > 0 {
+			m.notify(inc, e.Time, true)
+		}
+		m.release(inc, e.Time)
+	default:
+		return
+	}
+	m.save()
+}
+
+// DependsOn declares that `url` depends on `parents`: alerts of `url` are suppressed while a parent is down
+// it fails without declaring anything if a parent depends on `url`, as a cycle would suppress the alerts of all
+// its websites whenever one of them is down
+func (m *Manager) DependsOn(url string, parents ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, parent := range parents {
+		if parent == url || Reaches(m.parents, parent, url) {
+			return fmt.Errorf("cyclic dependency of %s on %s", url, parent)
+		}
+	}
+	m.parents[url] = append(m.parents[url], parents...)
+	return nil
+}
+
+// Reaches tells whether `url` depends on `target` in `parents` (which maps urls to the urls they depend on),
+// directly or through its dependencies
+func Reaches(parents map[string][]string, url, target string) bool {
+	visited := map[string]bool{url: true}
+	queue := append([]string(nil), parents[url]...)
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		if parent == target {
+			return true
+		}
+		if !visited[parent] {
+			visited[parent] = true
+			queue = append(queue, parents[parent]...)
+		}
+	}
+	return false
+}
+
+// Remove drops the incidents and dependencies of a website that is no longer monitored, without notifying
+func (m *Manager) Remove(url string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, inc := range m.incidents {
+		if inc.Url == url {
+			delete(m.incidents, key)
+			m.release(inc, m.Clock.Now())
+		}
+	}
+	delete(m.parents, url)
+	delete(m.restored, url)
+	m.save()
+}
+
+// Forget drops the dependencies of `url` but keeps its incidents, e.g. when monitoring it failed to start
+func (m *Manager) Forget(url string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.parents, url)
+}
+
+// SuppressedBy returns the url of the down dependency whose incident groups `url` alerts, or "" if there's none
+func (m *Manager) SuppressedBy(url string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if parent := m.downDependency(url); parent != nil {
+		return parent.Url
+	}
+	return ""
+}
+
+// Suppressing returns the urls whose alerts are grouped under the incident of `url` being down
+func (m *Manager) Suppressing(url string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var children []string
+	for child := range m.parents {
+		if parent := m.downDependency(child); parent != nil && parent.Url == url {
+			children = append(children, child)
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+// downDependency returns the root incident of a down (direct or transitive) dependency of `url`, or nil
+// it must be called with `m.mu` locked
+func (m *Manager) downDependency(url string) *Incident {
+	visited := map[string]bool{url: true}
+	queue := append([]string(nil), m.parents[url]...)
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		if visited[parent] {
+			continue
+		}
+		visited[parent] = true
+		if inc, ok := m.incidents[Key(parent, "availability")]; ok && isDown(inc) {
+			// follow the chain of grouped incidents up to the root one
+			for inc.Parent != "" && m.incidents[inc.Parent] != nil {
+				inc = m.incidents[inc.Parent]
+			}
+			return inc
+		}
+		queue = append(queue, m.parents[parent]...)
+	}
+	return nil
+}
+
+// isDown returns whether `inc` is the incident of a website being down, as opposed to degraded
+func isDown(inc *Incident) bool {
+	return inc.Alert == "availability" && inc.Severity == "critical"
+}
+
+// group groups the open incidents of websites depending on the website of `parent` under it
+// it must be called with `m.mu` locked
+func (m *Manager) group(parent *Incident) {
+	for _, inc := range m.incidents {
+		if inc != parent && inc.Parent == "" {
+			if root := m.downDependency(inc.Url); root == parent {
+				inc.Parent = parent.Key
+			}
+		}
+	}
+}
+
+// release ungroups the incidents grouped under `parent` once it's resolved
+// incidents still open are notified unless they're grouped under another down dependency
+// it must be called with `m.mu` locked
+func (m *Manager) release(parent *Incident, now time.Time) {
+	for _, inc := range m.incidents {
+		if inc.Parent != parent.Key {
+			continue
+		}
+		inc.Parent = ""
+		if root := m.downDependency(inc.Url); root != nil {
+			inc.Parent = root.Key
+		} else if inc.Notifications == 0 {
+			m.notify(inc, now, false)
+		}
+	}
+}
+
+// Tick re-notifies and escalates unacknowledged incidents that are due at `now`
+func (m *Manager) Tick(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := false
+	for _, inc := range m.incidents {
+		// grouped incidents follow their parent
+		if inc.Acknowledged || inc.Parent != "" {
+			continue
+		}
+		escalateAfter, repeatInterval := time.Duration(m.policy.EscalateAfter), time.Duration(m.policy.RepeatInterval)
+		switch {
+		case !inc.Escalated && m.policy.Secondary != "" && escalateAfter > 0 && now.Sub(inc.OpenedAt) >= escalateAfter:
+			inc.Escalated = true
+		case repeatInterval > 0 && now.Sub(inc.LastNotified) >= repeatInterval:
+		default:
+			continue
+		}
+		m.notify(inc, now, false)
+		changed = true
+	}
+	if changed {
+		m.save()
+	}
+}
+
+// Run ticks every second of its clock until `ctx` is done
+func (m *Manager) Run(ctx context.Context) {
+	ticker := m.Clock.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			m.Tick(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close waits for in-flight notifications until `ctx` is done, and persists open incidents
+func (m *Manager) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.sending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for notifications: %v", ctx.Err())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.save()
+}
+
+// Acknowledge stops repeating and escalating the incident identified by `key`
+func (m *Manager) Acknowledge(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inc, ok := m.incidents[key]
+	if !ok || inc.Acknowledged {
+		return false
+	}
+	inc.Acknowledged = true
+	m.save()
+	return true
+}
+
+// AcknowledgeAll acknowledges all open incidents and returns how many were acknowledged
+func (m *Manager) AcknowledgeAll() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, inc := range m.incidents {
+		if !inc.Acknowledged {
+			inc.Acknowledged = true
+			count++
+		}
+	}
+	if count > 0 {
+		m.save()
+	}
+	return count
+}
+
+// Incidents returns a copy of the open incidents, oldest first
+func (m *Manager) Incidents() []Incident {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	incidents := make([]Incident, 0, len(m.incidents))
+	for _, inc := range m.incidents {
+		incidents = append(incidents, *inc)
+	}
+	sort.Slice(incidents, func(i, j int) bool { return incidents[i].OpenedAt.Before(incidents[j].OpenedAt) })
+	return incidents
+}
+
+// LastError returns the last notification or persistence error
+func (m *Manager) LastError() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastErr
+}
+
+// notify sends the incident to the primary channel (or the one routed to by its severity), and to the secondary one once escalated
+// notifications are sent asynchronously so that alerting never waits for a slow channel, in order for each channel
+func (m *Manager) notify(inc *Incident, now time.Time, resolved bool) {
+	n := &notify.Notification{
+		Incident:  inc.Key,
+		Url:       inc.Url,
+		Alert:     inc.Alert,
+		Severity:  inc.Severity,
+		Resolved:  resolved,
+		Message:   inc.Message,
+		Time:      now,
+		Repeat:    inc.Notifications,
+		Escalated: inc.Escalated,
+	}
+	for _, child := range m.incidents {
+		if child.Parent == inc.Key {
+			n.Suppressed = append(n.Suppressed, child.Url)
+		}
+	}
+	sort.Strings(n.Suppressed)
+	inc.Notifications++
+	inc.LastNotified = now
+
+	channels := []string{m.policy.Primary}
+	if channel, ok := m.policy.Routes[inc.Severity]; ok {
+		channels[0] = channel
+	}
+	if inc.Escalated {
+		channels = append(channels, m.policy.Secondary)
+	}
+	for _, channel := range channels {
+		notifier, ok := m.notifiers[channel]
+		if !ok {
+			continue
+		}
+		box, ok := m.outboxes[channel]
+		if !ok {
+			box = &outbox{}
+			m.outboxes[channel] = box
+		}
+		m.sending.Add(1)
+		box.pending = append(box.pending, n)
+		if !box.running {
+			box.running = true
+			go m.send(channel, notifier, box)
+		}
+	}
+}
+
+// send sends the pending notifications of `box` to `notifier`, until there are none left
+func (m *Manager) send(channel string, notifier notify.Notifier, box *outbox) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(box.pending) > 0 {
+		n := box.pending[0]
+		box.pending = box.pending[1:]
+		m.mu.Unlock()
+		err := notifier.Notify(n)
+		m.mu.Lock()
+		if err != nil {
+			m.lastErr = fmt.Errorf("notifying %s: %v", channel, err)
+		}
+		m.sending.Done()
+	}
+	box.running = false
+}
+
+// save persists open incidents to the state file, it must be called with `m.mu` locked
+// errors are also kept as last error
+func (m *Manager) save() error {
+	if m.stateFile == "" {
+		return nil
+	}
+	incidents := make([]*Incident, 0, len(m.incidents))
+	for _, inc := range m.incidents {
+		incidents = append(incidents, inc)
+	}
+	sort.Slice(incidents, func(i, j int) bool { return incidents[i].Key < incidents[j].Key })
+	data, err := json.MarshalIndent(incidents, "", "  ")
+	if err != nil {
+		m.lastErr = err
+		return err
+	}
+
+	// write to a temporary file first so that a crash never leaves a truncated state file
+	tmp := m.stateFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		m.lastErr = err
+		return err
+	}
+	if err := os.Rename(tmp, m.stateFile); err != nil {
+		m.lastErr = err
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package inspect
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+func init() {
+	RegisterLocal("exec", newExecProber)
+}
+
+// states of checks, indexed by exit code, following the Nagios plugin convention
+var execStates = [...]string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// execProber runs a local command, e.g. `exec:/usr/lib/nagios/plugins/check_load -w 5,4,3 -c 10,8,6`, following the
+// Nagios plugin convention: exit code 0 is ok, 1 warning, 2 critical and any other unknown, and stdout is a line of text
+// optionally followed by performance data: `TEXT | label=value[UOM];[warn];[crit];[min];[max] ...`
+//
+// checks are up (status code 200) when they're ok, up with a `Warning` when they're warning, and down otherwise,
+// their reports have
+//
+//	Details    exit_code, state (OK, WARNING, CRITICAL or UNKNOWN) and output (the text, without performance data)
+//	Metrics    the values of performance data by label (without unit), and state (the exit code, up to 3)
+//
+// exec checks can only be defined in the configuration file, as they run commands
+type execProber struct {
+	url     string
+	args    []string // command and its arguments
+	timeout time.Duration
+}
+
+// newExecProber creates the prober running the command of `url`, whose arguments are split like in a shell
+func newExecProber(url string, timeout time.Duration) (Prober, error) {
+	args, err := splitCommand(url[len("exec:"):])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: missing command", url)
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, err
+	}
+	return &execProber{url: url, args: args, timeout: timeout}, nil
+}
+
+// Probe runs the command, which is killed when `ctx` is done or after the timeout of the prober
+func (p *execProber) Probe(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	start := time.Now()
+	stdout, err := run(ctx, p.args)
+	duration := time.Since(start)
+
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if ctx.Err() != nil {
+			return failedReport(p.url, "exec", ctx.Err())
+		} else if !errors.As(err, &exitErr) {
+			return failedReport(p.url, "exec", err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	state := exitCode
+	if state < 0 || state > 3 {
+		state = 3
+	}
+
+	output, perfdata := parsePluginOutput(stdout)
+	perfdata["state"] = float64(state)
+	report := &Report{
+		Url:               p.url,
+		Protocol:          "exec",
+		StatusCode:        200,
+		ConnectDuration:   -1,
+		FirstByteDuration: -1,
+		TotalDuration:     duration,
+		Details: map[string]string{
+			"exit_code": strconv.Itoa(exitCode),
+			"state":     execStates[state],
+			"output":    output,
+		},
+		Metrics: perfdata,
+	}
+	reason := execStates[state]
+	if output != "" {
+		reason += ": " + output
+	}
+	switch {
+	case state == 1:
+		report.Warning = reason
+	case state > 1:
+		report.StatusCode = 0
+		report.Error = reason
+	}
+	return report
+}
+
+// run runs the command of `args` and returns its stdout, or the error of `ctx` as soon as it's done: the command is
+// killed then, but processes it started may keep stdout open, so reading it isn't waited for
+func run(ctx context.Context, args []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	type output struct {
+		stdout []byte
+		err    error
+	}
+	read := make(chan output, 1)
+	go func() {
+		stdout, err := ioutil.ReadAll(pipe)
+		read <- output{stdout, err}
+	}()
+
+	select {
+	case out := <-read:
+		// stdout is waited for only once it's read, as Wait closes it
+		if err := cmd.Wait(); err != nil {
+			return out.stdout, err
+		}
+		return out.stdout, out.err
+	case <-ctx.Done():
+		// Wait returns once the killed command exits, closing stdout so that reading it stops
+		cmd.Wait()
+		return nil, ctx.Err()
+	}
+}
+
+// parsePluginOutput returns the text of the output of a Nagios plugin, and its performance data by label
+// performance data can follow a `|` on the first line and on any of the next ones, invalid entries are skipped
+func parsePluginOutput(stdout []byte) (string, map[string]float64) {
+	var text string
+	perfdata := make(map[string]float64)
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for first := true; scanner.Scan(); first = false {
+		line := scanner.Text()
+		data := ""
+		if i := strings.IndexByte(line, '|'); i >= 0 {
+			line, data = line[:i], line[i+1:]
+		}
+		if first {
+			text = strings.TrimSpace(line)
+		}
+		parsePerfdata(data, perfdata)
+	}
+	return text, perfdata
+}
+
+// parsePerfdata adds the values of entries such as `'/ used'=12.5MB;80;90;0;100 load1=0.5` to `perfdata`
+func parsePerfdata(data string, perfdata map[string]float64) {
+	for data = strings.TrimSpace(data); data != ""; data = strings.TrimSpace(data) {
+		// labels can be quoted to contain spaces or equal signs, `''` being a quote
+		var label string
+		if data[0] == '\'' {
+			i := 1
+			for ; i < len(data); i++ {
+				if data[i] == '\'' {
+					if i+1 < len(data) && data[i+1] == '\'' {
+						label += "'"
+						i++
+						continue
+					}
+					break
+				}
+				label += string(data[i])
+			}
+			if i < len(data) {
+				i++ // closing quote
+			}
+			data = data[i:]
+		} else if i := strings.IndexByte(data, '='); i >= 0 {
+			label, data = data[:i], data[i:]
+		}
+		entry := data
+		if i := strings.IndexAny(data, " \t"); i >= 0 {
+			entry, data = data[:i], data[i:]
+		} else {
+			data = ""
+		}
+		if label == "" || !strings.HasPrefix(entry, "=") {
+			continue
+		}
+		value := strings.SplitN(entry[1:], ";", 2)[0]
+		value = strings.TrimRightFunc(value, func(r rune) bool { return r == '%' || unicode.IsLetter(r) })
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			perfdata[label] = v
+		}
+	}
+}
+
+// splitCommand splits a command line into arguments separated by spaces, which can be single or double quoted
+func splitCommand(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote, inArg = c, true
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,131 @@
+package inspect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func init() {
+	Register("http", newHTTPProber)
+	Register("https", newHTTPProber)
+}
+
+// httpProber checks a website with HTTP GET requests traced by colly
+// its reports have the HTTP status code of responses, and the connect, first byte and total durations of requests
+type httpProber struct {
+	url     string
+	timeout time.Duration
+}
+
+// newHTTPProber creates the prober of the website at `url`
+func newHTTPProber(url string, timeout time.Duration) (Prober, error) {
+	return &httpProber{url: url, timeout: timeout}, nil
+}
+
+// Probe sends a request to the website and returns its report, the request is canceled once `ctx` is done
+func (p *httpProber) Probe(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	// each probe has its own collector, whose requests are sent with the context of the probe
+	var report *Report
+	send := func(r *Report) {
+		if report == nil { // the request was already reported
+			report = r
+		}
+	}
+	collector := newInspectCollector(p.url, p.timeout)
+	collector.WithTransport(&contextTransport{ctx: ctx, base: http.DefaultTransport})
+	reqCtx := colly.NewContext()
+	reqCtx.Put("report", send)
+	if err := collector.Request("GET", p.url, nil, reqCtx, nil); err != nil {
+		// the request couldn't be sent, e.g. because of an invalid url
+		send(failedReport(p.url, "http", err))
+	}
+	send(failedReport(p.url, "http", errors.New("no response")))
+	return report
+}
+
+// contextTransport sends requests with the context of a probe, as colly doesn't set the context of requests
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// keep the trace colly measures durations with
+	ctx := t.ctx
+	if trace := httptrace.ContextClientTrace(req.Context()); trace != nil {
+		ctx = httptrace.WithClientTrace(ctx, trace)
+	}
+	return t.base.RoundTrip(req.WithContext(ctx))
+}
+
+// newInspectCollector creates a collector which traces requests to `url`, and reports each one with the function in its context
+func newInspectCollector(url string, timeout time.Duration) *colly.Collector {
+	collector := newTraceCollector()
+	collector.SetRequestTimeout(timeout)
+
+	// Remember when each request starts to measure its total duration
+	// * note request durations are measured in real time, whatever the clock of the inspector
+	collector.OnRequest(func(req *colly.Request) {
+		req.Ctx.Put("start", time.Now())
+	})
+
+	// Set response handler
+	collector.OnResponse(func(resp *colly.Response) {
+		send := resp.Ctx.GetAny("report").(func(*Report))
+		if resp.Trace == nil {
+			//TODO: check if we ever reach here
+			errReport := &Report{
+				Url:               url,
+				Protocol:          "http",
+				StatusCode:        resp.StatusCode,
+				ConnectDuration:   -1,
+				FirstByteDuration: -1,
+				TotalDuration:     -1,
+			}
+
+			send(errReport)
+			return
+		}
+		// create report from trace
+		report := &Report{
+			Url:               url,
+			Protocol:          "http",
+			StatusCode:        resp.StatusCode,
+			ConnectDuration:   resp.Trace.ConnectDuration,
+			FirstByteDuration: resp.Trace.FirstByteDuration,
+			TotalDuration:     -1,
+		}
+		if start, ok := resp.Ctx.GetAny("start").(time.Time); ok {
+			report.TotalDuration = time.Since(start)
+		}
+
+		send(report)
+	})
+
+	// Set error handler
+	// By default, Colly parses only successful HTTP responses. Set ParseHTTPErrorResponse
+	// to true to enable parsing status codes other than 2xx.
+	// For simplicity we'll consider a website not available if the HTTP response is not successful
+	collector.OnError(func(resp *colly.Response, err error) {
+		// log.Println("Request URL:", resp.Request.URL, "failed with response:", resp, "\nError:", err)
+		errReport := failedReport(url, "http", err)
+		errReport.StatusCode = resp.StatusCode
+
+		resp.Ctx.GetAny("report").(func(*Report))(errReport)
+	})
+	return collector
+}
+
+// newTraceCollector creates a new `colly` collector which traces http requests
+func newTraceCollector() *colly.Collector {
+	collector := colly.NewCollector(colly.TraceHTTP(), colly.AllowURLRevisit(), colly.ParseHTTPErrorResponse())
+	return collector
+}
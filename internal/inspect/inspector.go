@@ -1,110 +1,171 @@
 package inspect
 
 import (
+	"context"
+	"sync"
 	"time"
 
-	"github.com/NouamaneTazi/website-monitor/internal/config"
-	"github.com/gocolly/colly/v2"
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
 )
 
 // Inspector monitors an url every polling interval, and sends reports over `reportc` channel
 type Inspector struct {
-	ticker    *time.Ticker     // periodic ticker of periodicity `PollingInterval`
-	url       string           // current URLs
-	reportc   chan *Report     // channel used to report metrics
-	collector *colly.Collector // colly collector which sends and traces HTTP requests
+	ticker          *clock.Ticker // periodic ticker of periodicity `PollingInterval`
+	url             string        // current URLs
+	pollingInterval time.Duration
+	reportc         chan *Report // channel used to report metrics
+	clock           clock.Clock  // timestamps reports at probe time
+	prober          Prober       // prober registered for the scheme of the url
+	mu              sync.Mutex
+	paused          bool          // paused inspectors don't probe on ticks (but still on `ProbeNow`)
+	probec          chan struct{} // requests an immediate probe
+	done            chan struct{} // closed when the inspector is stopped
+	ctx             context.Context
+	cancel          context.CancelFunc // cancels in-flight requests, see Stop
+	stopOnce        sync.Once
+	visits          sync.WaitGroup // in-flight requests
 }
 
-// Report collects useful metrics from a single HTTP request made by an Inspector
+// Report is the result of a single check made by a Prober, whatever its protocol:
+//
+//	StatusCode       the HTTP status code, 0 when no response was received
+//	                 checks of other protocols report 200 when they succeed, so that availability is computed alike
+//	*Duration        durations of the check, -1 when it failed (checks of other protocols may only set TotalDuration)
+//	Error            why the check failed, if it did
+//	Warning          why the check is degraded although it succeeded, if it is (e.g. exec checks exiting with 1)
+//	Time             when the check started, reports are aggregated over windows by this time
+//	Protocol         protocol of the check, e.g. http (empty in reports stored before it was recorded)
+//	Details          protocol-specific fields, documented by each prober
+//	Metrics          protocol-specific named values, e.g. performance data of exec checks, used by alert rules
 type Report struct {
 	Url               string
 	PollingInterval   time.Duration
+	Time              time.Time
 	StatusCode        int
 	ConnectDuration   time.Duration
 	FirstByteDuration time.Duration
+	TotalDuration     time.Duration
+	Error             string // why the request failed, if it did
+	Warning           string // why the check is degraded although it succeeded, if it is
+	Protocol          string
+	Details           map[string]string
+	Metrics           map[string]float64
 }
 
-// NewInspector initializes an Inspector and returns the channel over which it communicates reports
-func NewInspector(url string, PollingInterval time.Duration) <-chan *Report {
-	// number of reports to keep track of (we keep reports as old as `LongStatsHistoryInterval`)
-	maxNumOfReports := int(config.LongStatsHistoryInterval / PollingInterval)
-	reportc := make(chan *Report, maxNumOfReports)
-
-	// define collector
-	collector := newTraceCollector()
-
-	// set timeout equal to PollingInterval
-	collector.SetRequestTimeout(PollingInterval)
-
-	// Set response handler
-	collector.OnResponse(func(resp *colly.Response) {
-		if resp.Trace == nil {
-			//TODO: check if we ever reach here
-			errReport := &Report{
-				Url:               url,
-				PollingInterval:   PollingInterval,
-				StatusCode:        resp.StatusCode,
-				ConnectDuration:   -1,
-				FirstByteDuration: -1,
-			}
-
-			// send error report to metrics
-			reportc <- errReport
-		}
-		// create report from trace
-		report := &Report{
-			Url:               url,
-			PollingInterval:   PollingInterval,
-			StatusCode:        resp.StatusCode,
-			ConnectDuration:   resp.Trace.ConnectDuration,
-			FirstByteDuration: resp.Trace.FirstByteDuration,
-		}
-
-		// send report over to metrics for further analytics
-		reportc <- report
-	})
-
-	// Set error handler
-	// By default, Colly parses only successful HTTP responses. Set ParseHTTPErrorResponse
-	// to true to enable parsing status codes other than 2xx.
-	// For simplicity we'll consider a website not available if the HTTP response is not successful
-	collector.OnError(func(resp *colly.Response, err error) {
-		// log.Println("Request URL:", resp.Request.URL, "failed with response:", resp, "\nError:", err)
-		errReport := &Report{
-			Url:               url,
-			PollingInterval:   PollingInterval,
-			StatusCode:        resp.StatusCode,
-			ConnectDuration:   -1,
-			FirstByteDuration: -1,
-		}
+// NewInspector initializes an Inspector and starts monitoring on the ticks of `clk`, reports are sent over `inspector.Reports()`
+// which buffers the reports of the past `history` (the longest stats window)
+// it fails if no prober is registered for the scheme of `url`
+func NewInspector(url string, PollingInterval, history time.Duration, clk clock.Clock) (*Inspector, error) {
+	// define prober, with a timeout equal to PollingInterval
+	prober, err := NewProber(url, PollingInterval)
+	if err != nil {
+		return nil, err
+	}
 
-		// send error report to metrics
-		reportc <- errReport
-	})
+	// number of reports to keep track of (we keep reports as old as the longest stats window)
+	maxNumOfReports := int(history / PollingInterval)
 
 	// init new inspector
+	ctx, cancel := context.WithCancel(context.Background())
 	inspector := &Inspector{
-		ticker:    time.NewTicker(PollingInterval),
-		reportc:   reportc,
-		url:       url,
-		collector: collector,
+		ctx:             ctx,
+		cancel:          cancel,
+		ticker:          clk.NewTicker(PollingInterval),
+		reportc:         make(chan *Report, maxNumOfReports),
+		clock:           clk,
+		url:             url,
+		pollingInterval: PollingInterval,
+		prober:          prober,
+		probec:          make(chan struct{}, 1),
+		done:            make(chan struct{}),
 	}
 
 	// start monitoring
 	go inspector.startInspecting()
-	return reportc
+	return inspector, nil
 }
 
-// newTraceCollector creates a new `colly` collector which traces http requests
-func newTraceCollector() *colly.Collector {
-	collector := colly.NewCollector(colly.TraceHTTP(), colly.AllowURLRevisit(), colly.ParseHTTPErrorResponse())
-	return collector
+// Reports returns the channel over which reports are sent, it is closed once the inspector is stopped
+func (inspector *Inspector) Reports() <-chan *Report {
+	return inspector.reportc
 }
 
 // startInspecting start inspection loop of the url every `PollingInterval`
 func (inspector *Inspector) startInspecting() {
-	for range inspector.ticker.C {
-		// When the ticker fires, inspect url
-		go inspector.collector.Visit(inspector.url)
+	for {
+		select {
+		case <-inspector.ticker.C:
+			// When the ticker fires, inspect url
+			if !inspector.Paused() {
+				inspector.visit()
+			}
+		case <-inspector.probec:
+			inspector.visit()
+		case <-inspector.done:
+			inspector.ticker.Stop()
+			// close reports channel once in-flight requests are done, so that readers stop too
+			inspector.visits.Wait()
+			close(inspector.reportc)
+			return
+		}
+	}
+}
+
+// visit inspects the url in a new goroutine, and sends its report over to metrics
+func (inspector *Inspector) visit() {
+	inspector.visits.Add(1)
+	go func() {
+		defer inspector.visits.Done()
+		start := inspector.clock.Now()
+		ctx, cancel := context.WithTimeout(inspector.ctx, inspector.pollingInterval)
+		defer cancel()
+		report := inspector.prober.Probe(ctx)
+		if inspector.ctx.Err() != nil {
+			// the request was canceled by Stop, its failure isn't the website's
+			return
+		}
+		report.PollingInterval = inspector.pollingInterval
+		report.Time = start
+		inspector.reportc <- report
+	}()
+}
+
+// Stop stops monitoring and cancels in-flight requests, which aren't reported, the reports channel is closed once they return
+func (inspector *Inspector) Stop() {
+	inspector.Drain()
+	inspector.cancel()
+}
+
+// Drain stops monitoring like Stop, but lets in-flight requests finish, the reports channel is closed once they're done
+func (inspector *Inspector) Drain() {
+	inspector.stopOnce.Do(func() { close(inspector.done) })
+}
+
+// Pause stops probing the url on every tick until `Resume` is called
+func (inspector *Inspector) Pause() {
+	inspector.mu.Lock()
+	defer inspector.mu.Unlock()
+	inspector.paused = true
+}
+
+// Resume resumes probing the url on every tick
+func (inspector *Inspector) Resume() {
+	inspector.mu.Lock()
+	defer inspector.mu.Unlock()
+	inspector.paused = false
+}
+
+// Paused returns whether the inspector is paused
+func (inspector *Inspector) Paused() bool {
+	inspector.mu.Lock()
+	defer inspector.mu.Unlock()
+	return inspector.paused
+}
+
+// ProbeNow triggers an immediate probe (even if paused), it doesn't wait for the probe report
+func (inspector *Inspector) ProbeNow() {
+	select {
+	case inspector.probec <- struct{}{}:
+	default: // a probe is already pending
 	}
 }
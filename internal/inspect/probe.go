@@ -0,0 +1,17 @@
+package inspect
+
+import (
+	"context"
+	"time"
+)
+
+// Probe inspects `url` once and returns its report, the check times out after `timeout`
+func Probe(url string, timeout time.Duration) *Report {
+	prober, err := NewProber(url, timeout)
+	if err != nil {
+		return failedReport(url, "", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return prober.Probe(ctx)
+}
@@ -0,0 +1,92 @@
+package inspect
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prober checks a target once per call, it's safe for concurrent use
+type Prober interface {
+	// Probe checks the target and returns its report, giving up when `ctx` is done
+	// * note the report's `PollingInterval` is set by the caller
+	Probe(ctx context.Context) *Report
+}
+
+// ProberFactory creates the prober of `url`, whose probes time out after `timeout`
+type ProberFactory func(url string, timeout time.Duration) (Prober, error)
+
+var (
+	probersMu sync.RWMutex
+	probers   = make(map[string]ProberFactory) // prober factories by URL scheme
+	local     = make(map[string]bool)          // schemes whose probers run local commands
+)
+
+// Register makes the probers of `factory` check the URLs of `scheme`, replacing any previous factory of the scheme
+// it's meant to be called from the `init` functions of the files implementing check types (see http.go)
+func Register(scheme string, factory ProberFactory) {
+	probersMu.Lock()
+	defer probersMu.Unlock()
+	probers[strings.ToLower(scheme)] = factory
+	delete(local, strings.ToLower(scheme))
+}
+
+// RegisterLocal is like Register for probers running local commands (see exec.go), whose URLs are only accepted
+// from the configuration file
+func RegisterLocal(scheme string, factory ProberFactory) {
+	Register(scheme, factory)
+	probersMu.Lock()
+	defer probersMu.Unlock()
+	local[strings.ToLower(scheme)] = true
+}
+
+// isLocal returns whether the probers of `scheme` run local commands
+func isLocal(scheme string) bool {
+	probersMu.RLock()
+	defer probersMu.RUnlock()
+	return local[strings.ToLower(scheme)]
+}
+
+// Schemes returns the sorted URL schemes which can be checked
+func Schemes() []string {
+	probersMu.RLock()
+	defer probersMu.RUnlock()
+	schemes := make([]string, 0, len(probers))
+	for scheme := range probers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// factory returns the prober factory of `scheme`, or nil if it isn't registered
+func factory(scheme string) ProberFactory {
+	probersMu.RLock()
+	defer probersMu.RUnlock()
+	return probers[strings.ToLower(scheme)]
+}
+
+// NewProber creates the prober of `uri` with the factory registered for its scheme
+func NewProber(uri string, timeout time.Duration) (Prober, error) {
+	s := scheme(uri)
+	newProber := factory(s)
+	if newProber == nil {
+		return nil, fmt.Errorf("unsupported scheme %q in %s, expected one of %s", s, uri, strings.Join(Schemes(), ", "))
+	}
+	return newProber(uri, timeout)
+}
+
+// failedReport returns the report of a check of `url` which failed with `err`
+func failedReport(url, protocol string, err error) *Report {
+	return &Report{
+		Url:               url,
+		Protocol:          protocol,
+		ConnectDuration:   -1,
+		FirstByteDuration: -1,
+		TotalDuration:     -1,
+		Error:             err.Error(),
+	}
+}
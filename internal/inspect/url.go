@@ -0,0 +1,63 @@
+package inspect
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParseURL reassembles the URL into a valid URL string, URLs without scheme are checked over HTTP(S)
+// it fails if no prober is registered for the scheme of the URL, or if its probers run local commands (e.g. exec),
+// which can only be defined in the configuration file (see ParseConfigURL)
+func ParseURL(uri string) (string, error) {
+	url, err := ParseConfigURL(uri)
+	if err == nil && isLocal(scheme(url)) {
+		return "", fmt.Errorf("%s checks run local commands, they can only be defined in the configuration file", scheme(url))
+	}
+	return url, err
+}
+
+// ParseConfigURL is like ParseURL for the URLs of the configuration file, which can also be checks running local commands
+// opaque URLs of registered schemes (e.g. `exec:check_load -w 5`) are kept as given
+func ParseConfigURL(uri string) (string, error) {
+	if s := scheme(uri); s != "" && !strings.Contains(uri, "://") && factory(s) != nil {
+		return uri, nil
+	}
+	if !strings.Contains(uri, "://") && !strings.HasPrefix(uri, "//") {
+		uri = "//" + uri
+	}
+
+	url, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if url.Scheme == "" {
+		url.Scheme = "http"
+		if !strings.HasSuffix(url.Host, ":80") {
+			url.Scheme += "s"
+		}
+	}
+	if factory(url.Scheme) == nil {
+		return "", fmt.Errorf("unsupported scheme %q in %s, expected one of %s", url.Scheme, uri, strings.Join(Schemes(), ", "))
+	}
+
+	return url.String(), nil
+}
+
+// scheme returns the lower-cased scheme of `uri`, or an empty string if it has none
+func scheme(uri string) string {
+	for i, c := range uri {
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' || c == '+' || c == '-' || c == '.':
+			if i == 0 {
+				return ""
+			}
+		case c == ':':
+			return strings.ToLower(uri[:i])
+		default:
+			return ""
+		}
+	}
+	return ""
+}
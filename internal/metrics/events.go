@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+)
+
+// maxEvents is the number of alert transitions kept in memory for each website
+const maxEvents = 1000
+
+// Event is an alert transition of a website (an alert starting or being resolved)
+type Event struct {
+	Url      string    `json:"url"`
+	Alert    string    `json:"alert"`    // which alert transitioned: availability, latency, flapping or rule:<name>
+	Resolved bool      `json:"resolved"` // whether the alert stopped (true) or started (false)
+	Severity string    `json:"severity"` // info, warning or critical
+	Message  string    `json:"message"`
+	Time     time.Time `json:"time"`
+}
+
+// Subscribe registers `fn` to be called with every alert transition of the website
+// `fn` is called outside of `Mu` lock, from the `ListenAndProcess` goroutine
+func (m *Metrics) Subscribe(fn func(*Event)) {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+	m.subscribers = append(m.subscribers, fn)
+}
+
+// SubscribeReports registers `fn` to be called with every report once it's processed
+// `fn` is called outside of `Mu` lock, from the `ListenAndProcess` goroutine, so it must not block
+func (m *Metrics) SubscribeReports(fn func(*Record)) {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+	m.reportSubscribers = append(m.reportSubscribers, fn)
+}
+
+// SubscribeDone registers `fn` to be called with every report once it's processed and its alert transitions are sent
+// to the subscribers of Subscribe, e.g. to wait until a report is fully handled
+// `fn` is called outside of `Mu` lock, from the `ListenAndProcess` goroutine
+func (m *Metrics) SubscribeDone(fn func(*Record)) {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+	m.doneSubscribers = append(m.doneSubscribers, fn)
+}
+
+// Raised returns the severity of the alerts of the website which are currently raised, by alert (availability,
+// latency, flapping or rule:<name>, as in events)
+func (m *Metrics) Raised() map[string]string {
+	m.Mu.RLock()
+	defer m.Mu.RUnlock()
+	alert, raised := m.Alert, make(map[string]string)
+	if alert.AvailabilityLevel != OK {
+		raised["availability"] = alert.AvailabilityLevel.String()
+	}
+	if alert.LatencyLevel != OK {
+		raised["latency"] = alert.LatencyLevel.String()
+	}
+	if alert.Flapping {
+		raised["flapping"] = "warning"
+	}
+	if m.Rules != nil {
+		for _, a := range m.Rules.Alerts {
+			if a.State == rules.Firing {
+				raised["rule:"+a.Rule.Name] = a.Rule.Severity
+			}
+		}
+	}
+	return raised
+}
+
+// newEvents returns the alert transitions caused by the last report
+func (m *Metrics) newEvents() []*Event {
+	var events []*Event
+	newEvent := func(alert string, resolved bool, severity, format string, args ...interface{}) {
+		events = append(events, &Event{
+			Url:      m.Url,
+			Alert:    alert,
+			Resolved: resolved,
+			Severity: severity,
+			Message:  fmt.Sprintf("Website %v ", m.Url) + fmt.Sprintf(format, args...),
+			Time:     m.LastTimestamp,
+		})
+	}
+
+	alert := m.Alert
+	// a level change of an alert starts it again with the new severity, e.g. when a degraded website goes down
+	if alert.AvailabilityChanged {
+		switch alert.AvailabilityLevel {
+		case Critical:
+			newEvent("availability", false, "critical", "is down. availability=%.2f", alert.Availability)
+		case Warning:
+			if alert.Warning != "" {
+				newEvent("availability", false, "warning", "is degraded. availability=%.2f warning=%s", alert.Availability, alert.Warning)
+			} else {
+				newEvent("availability", false, "warning", "is degraded. availability=%.2f", alert.Availability)
+			}
+		default:
+			newEvent("availability", true, alert.availabilityFrom.String(), "has recovered. availability=%.2f", alert.Availability)
+		}
+	}
+	if alert.LatencyChanged {
+		latency := alert.Latency.Round(time.Millisecond)
+		if alert.LatencyLevel == OK {
+			newEvent("latency", true, alert.latencyFrom.String(), "latency has recovered. %s %s latency=%v", m.settings.LatencyAggregate, m.settings.LatencyPhase, latency)
+		} else {
+			newEvent("latency", false, alert.LatencyLevel.String(), "is slow. %s %s latency=%v", m.settings.LatencyAggregate, m.settings.LatencyPhase, latency)
+		}
+	}
+	if alert.FlappingStarted {
+		newEvent("flapping", false, "warning", "is flapping. state change=%.2f", alert.StateChange)
+	}
+	if alert.FlappingStopped {
+		newEvent("flapping", true, "warning", "stopped flapping. state change=%.2f", alert.StateChange)
+	}
+	if m.Rules != nil {
+		for _, a := range m.Rules.Alerts {
+			if a.HasFired {
+				newEvent("rule:"+a.Rule.Name, false, a.Rule.Severity, "is firing rule %v. %v", a.Rule.Name, a.Rule.Annotations["summary"])
+			}
+			if a.HasResolved {
+				newEvent("rule:"+a.Rule.Name, true, a.Rule.Severity, "resolved rule %v.", a.Rule.Name)
+			}
+		}
+	}
+	return events
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+)
+
+// Level is the alert level of a website, from ok to critical
+type Level int
+
+const (
+	OK       Level = iota
+	Warning        // above a warning threshold (e.g. Settings.WarningAvailability) but not a critical one
+	Critical       // above a critical threshold (e.g. Settings.CriticalAvailability)
+)
+
+func (l Level) String() string {
+	return [...]string{"ok", "warning", "critical"}[l]
+}
+
+// availabilityLevel returns the level of `availability`, warnings being disabled when WarningAvailability is 0
+// (a report with a `Warning` raises it to warning in `Alert.update`)
+func (s *Settings) availabilityLevel(availability float64) Level {
+	switch {
+	case availability < s.CriticalAvailability:
+		return Critical
+	case availability < s.WarningAvailability:
+		return Warning
+	}
+	return OK
+}
+
+// latencyLevel returns the level of `latency`, each threshold being disabled when it's 0
+func (s *Settings) latencyLevel(latency time.Duration) Level {
+	switch {
+	case s.LatencyThreshold > 0 && latency > s.LatencyThreshold:
+		return Critical
+	case s.LatencyWarningThreshold > 0 && latency > s.LatencyWarningThreshold:
+		return Warning
+	}
+	return OK
+}
+
+// Level returns the alert level of the website: critical if it's down or its availability or latency is critical,
+// warning if it's flapping or its availability or latency is above a warning threshold
+func (alert *Alert) Level() Level {
+	level := alert.LatencyLevel
+	if alert.AvailabilityLevel > level {
+		level = alert.AvailabilityLevel
+	}
+	if alert.WebsiteWasDown {
+		level = Critical
+	} else if alert.Flapping && level < Warning {
+		level = Warning
+	}
+	return level
+}
+
+// ThresholdError is an invalid threshold, named like its field of Settings (e.g. WarningAvailability)
+type ThresholdError struct {
+	Threshold string
+	Message   string
+}
+
+func (e *ThresholdError) Error() string {
+	return e.Message
+}
+
+// ValidateThresholds checks that availability thresholds are between 0 and 1, latency thresholds aren't negative,
+// and warning thresholds (when enabled) are reached before critical ones, it returns a *ThresholdError
+func ValidateThresholds(criticalAvailability, warningAvailability float64, latency, latencyWarning time.Duration) error {
+	invalid := func(threshold, format string, a ...interface{}) error {
+		return &ThresholdError{Threshold: threshold, Message: fmt.Sprintf(format, a...)}
+	}
+	switch {
+	case criticalAvailability < 0 || criticalAvailability > 1:
+		return invalid("CriticalAvailability", "critical availability %v must be between 0 and 1", criticalAvailability)
+	case warningAvailability < 0 || warningAvailability > 1:
+		return invalid("WarningAvailability", "warning availability %v must be between 0 and 1", warningAvailability)
+	case warningAvailability > 0 && warningAvailability < criticalAvailability:
+		return invalid("WarningAvailability", "warning availability %v must not be below critical availability %v", warningAvailability, criticalAvailability)
+	case latency < 0:
+		return invalid("LatencyThreshold", "latency threshold must not be negative")
+	case latencyWarning < 0:
+		return invalid("LatencyWarningThreshold", "latency warning threshold must not be negative")
+	case latency > 0 && latencyWarning > latency:
+		return invalid("LatencyWarningThreshold", "latency warning threshold %v must not be above latency threshold %v", latencyWarning, latency)
+	}
+	return nil
+}
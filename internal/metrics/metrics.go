@@ -1,200 +1,482 @@
 package metrics
 
 import (
+	"fmt"
 	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
 	"github.com/NouamaneTazi/website-monitor/internal/config"
 	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
 )
 
 // Metrics contains url trace information and aggregation of reports over a short and a long interval
 type Metrics struct {
-	Url             string                 // the url being monitored
-	PollingInterval time.Duration          // the url's polling interval
-	LastTimestamp   time.Time              // last updated time stamp
-	reportc         <-chan *inspect.Report // the reports channel
-	Mu              sync.RWMutex
-	AggData         *AggData // aggregated data that will be passed to UI
-	Alert           *Alert   // holds alerting logic
+	Url               string                 // the url being monitored
+	PollingInterval   time.Duration          // the url's polling interval
+	LastTimestamp     time.Time              // last updated time stamp
+	Clock             clock.Clock            // clock timestamping processed reports, e.g. a fake clock in tests and replays
+	reportc           <-chan *inspect.Report // the reports channel
+	Mu                sync.RWMutex
+	AggData           *AggData         // aggregated data that will be passed to UI
+	Alert             *Alert           // holds alerting logic
+	settings          *Settings        // windows and alert thresholds
+	Rules             *rules.Evaluator // evaluates user-defined alert rules (nil if there's none)
+	subscribers       []func(*Event)   // called with every alert transition
+	reportSubscribers []func(*Record)  // called with every processed report
+	doneSubscribers   []func(*Record)  // called once a processed report and its alert transitions are sent to subscribers
+	history           []*Record        // reports of the past `settings.HistoryRetention`
+	events            []*Event         // last `maxEvents` alert transitions
+}
+
+// Record is a report along with the time it was probed (or processed, for reports without probe time)
+type Record struct {
+	Time   time.Time
+	Report *inspect.Report
 }
 
 // Alert tracks url alerts
 type Alert struct {
-	statuscodesc        chan int
+	settings            *Settings
+	window              *IntervalAggData // reports of the past `settings.AlertWindow` used for availability and latency alerts
 	Availability        float64
 	WebsiteWasDown      bool
 	WebsiteHasRecovered bool
+	WebsiteWentDown     bool          // availability went below the critical availability on last report
+	AvailabilityLevel   Level         // last notified availability level (transitions aren't notified while flapping)
+	AvailabilityChanged bool          // availability level changed on last report
+	availabilityFrom    Level         // availability level before the last report
+	Warning             string        // warning of the last report (e.g. an exec check exiting with 1), raising the availability level to warning
+	Latency             time.Duration // latency aggregated as `settings.LatencyAggregate` over `settings.LatencyPhase`
+	LatencyIsHigh       bool          // latency is above the latency threshold
+	LatencyWentHigh     bool
+	LatencyHasRecovered bool
+	LatencyLevel        Level
+	LatencyChanged      bool    // latency level changed on last report
+	latencyFrom         Level   // latency level before the last report
+	states              []bool  // stores whether website was up in each of the past `numOfStates` reports
+	numOfStates         int     // number of reports used in flap detection (= `settings.FlapWindow` / PollingInterval)
+	StateChange         float64 // weighted percent of state changes over the past `numOfStates` reports
+	Flapping            bool    // website is oscillating between up and down, individual transitions are suppressed
+	FlappingStarted     bool
+	FlappingStopped     bool
 }
 
-// AggData regroups the aggregated data over a short and a long interval
+// AggData regroups the aggregated data over the windows of config.StatsWindows
 type AggData struct {
-	Short, Long *IntervalAggData
+	Windows []*IntervalAggData // in the order of `Settings.StatsWindows`
 }
 
-// IntervalAggData aggregates data over `historyInterval`
+// IntervalAggData aggregates the reports probed in the past `historyInterval`, whatever their number
 type IntervalAggData struct {
-	historyInterval   time.Duration     // specifies duration of relevant reports history
-	numOfAggReports   int               // specifies number of relevant reports (= historyInterval / PollingInterval)
-	StatusCodesCount  map[int]int       // hold count of status codes of past reports
-	statuscodesc      chan int          // channel to update status codes count (we don't need queue)
-	reportQueue       []*inspect.Report // stores last (historyInterval / PollingInterval) reports to calculate aggregated metrics
-	Availability      float64           // Website availability (%)
-	ConnectDuration   [2]int            // [avg, max] in milliseconds
-	FirstByteDuration [2]int            // [avg, max] in milliseconds
+	name              string        // name of the window
+	historyInterval   time.Duration // specifies duration of relevant reports history
+	StatusCodesCount  map[int]int   // hold count of status codes of past reports
+	records           []*Record     // reports of the past `historyInterval`, sorted by probe time
+	Availability      float64       // Website availability (%) over the reports in the window
+	ConnectDuration   [2]int        // [avg, max] in milliseconds
+	FirstByteDuration [2]int        // [avg, max] in milliseconds
+	TotalDuration     [2]int        // [avg, max] in milliseconds
 }
 
-// NewMetrics inits and return new Metrics object.
-func NewMetrics(reportc <-chan *inspect.Report, pollingInterval time.Duration) *Metrics {
-
-	// Use queues to find max values in metrics
-	shortReportQueue := make([]*inspect.Report, 0, int(config.ShortStatsHistoryInterval/pollingInterval))
-	longReportQueue := make([]*inspect.Report, 0, int(config.LongStatsHistoryInterval/pollingInterval))
-
+// NewMetrics inits and return new Metrics object, aggregating reports and evaluating alerts with `settings`
+// (e.g. `ConfigSettings()`)
+func NewMetrics(reportc <-chan *inspect.Report, pollingInterval time.Duration, settings *Settings) *Metrics {
 	return &Metrics{
 		PollingInterval: pollingInterval,
+		Clock:           clock.Real,
 		reportc:         reportc,
-		AggData: &AggData{
-			Short: &IntervalAggData{
-				historyInterval:  config.ShortStatsHistoryInterval,
-				numOfAggReports:  int(config.ShortStatsHistoryInterval / pollingInterval),
-				statuscodesc:     make(chan int, int(config.ShortStatsHistoryInterval/pollingInterval)),
-				reportQueue:      shortReportQueue,
-				StatusCodesCount: make(map[int]int),
-			},
-			Long: &IntervalAggData{
-				historyInterval:  config.LongStatsHistoryInterval,
-				numOfAggReports:  int(config.LongStatsHistoryInterval / pollingInterval),
-				statuscodesc:     make(chan int, int(config.LongStatsHistoryInterval/pollingInterval)),
-				reportQueue:      longReportQueue,
-				StatusCodesCount: make(map[int]int)},
-		},
+		settings:        settings,
+		AggData:         newAggData(settings.StatsWindows),
 		Alert: &Alert{
-			statuscodesc: make(chan int, int(config.WebsiteAlertInterval/pollingInterval)),
+			settings:    settings,
+			window:      newIntervalAggData("alert", settings.AlertWindow),
+			states:      make([]bool, 0, int(settings.FlapWindow/pollingInterval)),
+			numOfStates: int(settings.FlapWindow / pollingInterval),
 		},
 	}
 }
 
+// newAggData inits the aggregated data over `windows`
+func newAggData(windows config.Windows) *AggData {
+	agg := &AggData{Windows: make([]*IntervalAggData, 0, len(windows))}
+	for _, w := range windows {
+		agg.Windows = append(agg.Windows, newIntervalAggData(w.Name, w.Duration))
+	}
+	return agg
+}
+
+// newIntervalAggData inits an IntervalAggData named `name` holding the reports of the past `historyInterval`
+func newIntervalAggData(name string, historyInterval time.Duration) *IntervalAggData {
+	return &IntervalAggData{
+		name:             name,
+		historyInterval:  historyInterval,
+		StatusCodesCount: make(map[int]int),
+	}
+}
+
 // ListenAndProcess listens for incoming reports and updates metrics
 func (m *Metrics) ListenAndProcess() {
 	// every `pollingInterval` this receives a report from Inspector
 	for report := range m.reportc {
 		// update metrics data
-		m.update(report)
+		record, events := m.update(report)
+
+		// notify subscribers outside of the lock so they can read metrics
+		m.Mu.RLock()
+		subscribers, reportSubscribers, doneSubscribers := m.subscribers, m.reportSubscribers, m.doneSubscribers
+		m.Mu.RUnlock()
+		for _, fn := range reportSubscribers {
+			fn(record)
+		}
+		for _, event := range events {
+			for _, fn := range subscribers {
+				fn(event)
+			}
+		}
+		for _, fn := range doneSubscribers {
+			fn(record)
+		}
 	}
 }
 
-// update updates metrics aggregated data and alerts from a report
-func (m *Metrics) update(newReport *inspect.Report) {
+// update updates metrics aggregated data and alerts from a report, and returns its record and the resulting alert transitions
+func (m *Metrics) update(newReport *inspect.Report) (*Record, []*Event) {
 	m.Mu.Lock()
 	defer m.Mu.Unlock()
 	// defines metrics url upon first report it gets
 	if m.Url == "" {
 		m.Url = newReport.Url
 	}
-	m.LastTimestamp = time.Now()
-	m.AggData.update(newReport)
-	m.Alert.update(newReport)
+	m.LastTimestamp = m.Clock.Now()
+	record := m.record(newReport)
+	m.AggData.update(record)
+	m.Alert.update(record)
+	if m.Rules != nil {
+		m.Rules.Update(record.Time, newReport)
+	}
+	events := m.newEvents()
+	m.events = append(m.events, events...)
+	if len(m.events) > maxEvents {
+		m.events = m.events[len(m.events)-maxEvents:]
+	}
+	return record, events
+}
+
+// record adds a report to history and drops those older than config.HistoryRetention
+// reports are timestamped at probe time, or at processing time for those which don't have one
+func (m *Metrics) record(newReport *inspect.Report) *Record {
+	record := &Record{Time: newReport.Time, Report: newReport}
+	if record.Time.IsZero() {
+		record.Time = m.LastTimestamp
+	}
+	m.history = append(m.history, record)
+	from := m.LastTimestamp.Add(-m.settings.HistoryRetention)
+	i := 0
+	for i < len(m.history) && m.history[i].Time.Before(from) {
+		i++
+	}
+	m.history = m.history[i:]
+	return record
+}
+
+// HistoryRetention returns how long processed reports are kept in history
+func (m *Metrics) HistoryRetention() time.Duration {
+	return m.settings.HistoryRetention
+}
+
+// History returns the reports processed between `from` and `to` (included) that are still in history
+func (m *Metrics) History(from, to time.Time) []*Record {
+	m.Mu.RLock()
+	defer m.Mu.RUnlock()
+	var records []*Record
+	for _, r := range m.history {
+		if !r.Time.Before(from) && !r.Time.After(to) {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// Expire evicts the reports probed more than their window before `now` from the stats windows, so that websites which
+// stopped reporting (e.g. whose probes hang) don't keep showing stale stats
+func (m *Metrics) Expire(now time.Time) {
+	m.Mu.Lock()
+	defer m.Mu.Unlock()
+	for _, w := range m.AggData.Windows {
+		w.expire(now)
+	}
+}
+
+// Events returns the last alert transitions of the website, oldest first
+func (m *Metrics) Events() []*Event {
+	m.Mu.RLock()
+	defer m.Mu.RUnlock()
+	return append([]*Event(nil), m.events...)
+}
+
+// Name returns the name of the window over which data is aggregated
+func (agg *IntervalAggData) Name() string {
+	return agg.name
+}
+
+// HistoryInterval returns the duration over which data is aggregated
+func (agg *IntervalAggData) HistoryInterval() time.Duration {
+	return agg.historyInterval
+}
+
+// Window returns the data aggregated over the window named `name`, nil if there's none
+func (agg *AggData) Window(name string) *IntervalAggData {
+	for _, w := range agg.Windows {
+		if w.name == name {
+			return w
+		}
+	}
+	return nil
+}
+
+// Longest returns the data aggregated over the longest window, nil if there's none
+func (agg *AggData) Longest() *IntervalAggData {
+	var longest *IntervalAggData
+	for _, w := range agg.Windows {
+		if longest == nil || w.historyInterval > longest.historyInterval {
+			longest = w
+		}
+	}
+	return longest
 }
 
 // update updates `AggData` data from a report
-func (agg *AggData) update(newReport *inspect.Report) {
-	agg.Short.aggregate(newReport)
-	agg.Long.aggregate(newReport)
+func (agg *AggData) update(record *Record) {
+	for _, w := range agg.Windows {
+		w.aggregate(record)
+	}
+}
+
+// aggregate adds a report to the window, evicts reports probed more than `agg.historyInterval` before the newest one,
+// and aggregates the remaining ones
+func (agg *IntervalAggData) aggregate(record *Record) {
+	// insert the record by probe time, as a slow probe can be reported after a later one
+	i := len(agg.records)
+	for i > 0 && agg.records[i-1].Time.After(record.Time) {
+		i--
+	}
+	agg.records = append(agg.records, nil)
+	copy(agg.records[i+1:], agg.records[i:])
+	agg.records[i] = record
+	agg.StatusCodesCount[record.Report.StatusCode]++
+
+	agg.evict(agg.records[len(agg.records)-1].Time)
+	agg.refresh()
 }
 
-// aggregate aggregates report for the past `agg.historyInterval` interval
-func (agg *IntervalAggData) aggregate(newReport *inspect.Report) {
-	// add newReport to reportQueue
-	if len(agg.reportQueue) >= agg.numOfAggReports {
-		// * note first element will be garbage collected when enough new elements are added to the slice to cause reallocation
-		// check https://stackoverflow.com/questions/2818852/is-there-a-queue-implementation#comment103168917_26863706
-		agg.reportQueue = agg.reportQueue[1:]
+// expire evicts reports probed more than `agg.historyInterval` before `now`, and aggregates the remaining ones
+func (agg *IntervalAggData) expire(now time.Time) {
+	if agg.evict(now) > 0 {
+		agg.refresh()
 	}
-	agg.reportQueue = append(agg.reportQueue, newReport)
+}
+
+// evict evicts reports probed more than `agg.historyInterval` before `now`, and returns their number
+func (agg *IntervalAggData) evict(now time.Time) int {
+	from := now.Add(-agg.historyInterval)
+	evicted := 0
+	for evicted < len(agg.records) && !agg.records[evicted].Time.After(from) {
+		statusCode := agg.records[evicted].Report.StatusCode
+		if agg.StatusCodesCount[statusCode]--; agg.StatusCodesCount[statusCode] == 0 {
+			delete(agg.StatusCodesCount, statusCode)
+		}
+		evicted++
+	}
+	// * note evicted records are garbage collected when enough records are added to the slice to cause reallocation
+	agg.records = agg.records[evicted:]
+	return evicted
+}
 
+// refresh aggregates the reports in the window
+func (agg *IntervalAggData) refresh() {
 	// update avg/max stats
-	agg.updateAvgMax(agg.reportQueue)
+	agg.updateAvgMax()
 
-	// update status count
-	agg.updateStatusCount(newReport)
+	// update availability over the reports actually in the window
+	agg.Availability = 0
+	if len(agg.records) > 0 {
+		agg.Availability = float64(agg.StatusCodesCount[200]) / float64(len(agg.records))
+		agg.Availability = math.Round(agg.Availability*100) / 100
+	}
+}
 
-	// update availability
-	agg.Availability = float64(agg.StatusCodesCount[200]) / float64(agg.numOfAggReports)
-	agg.Availability = math.Round(agg.Availability*100) / 100
+// Len returns the number of reports in the window
+func (agg *IntervalAggData) Len() int {
+	return len(agg.records)
 }
 
-// updateAvgMax updates `IntervalAggData` with the aggregated avg and max of past reports
+// updateAvgMax updates `IntervalAggData` with the avg and max durations of the successful reports in the window
 // * NOTE we could use a maxheap or maximum sliding window for O(1) time complexity here
-func (agg *IntervalAggData) updateAvgMax(reportQueue []*inspect.Report) {
-	// assuming reportQueue has the newReport
-	agg.ConnectDuration, agg.FirstByteDuration = [2]int{0, 0}, [2]int{0, 0}
-
-	// TODO: this can be refactored
-	for _, report := range reportQueue {
-		// update ConnectDuration (-1 means there has been an error)
-		if report.ConnectDuration != -1 {
-			if int(report.ConnectDuration) > agg.ConnectDuration[1] {
-				agg.ConnectDuration[1] = int(report.ConnectDuration.Milliseconds())
+func (agg *IntervalAggData) updateAvgMax() {
+	phases := []struct {
+		stat     *[2]int
+		duration func(*inspect.Report) time.Duration
+	}{
+		{&agg.ConnectDuration, func(r *inspect.Report) time.Duration { return r.ConnectDuration }},
+		{&agg.FirstByteDuration, func(r *inspect.Report) time.Duration { return r.FirstByteDuration }},
+		{&agg.TotalDuration, func(r *inspect.Report) time.Duration { return r.TotalDuration }},
+	}
+	for _, phase := range phases {
+		var sum, max time.Duration
+		count := 0
+		for _, record := range agg.records {
+			// -1 means there has been an error
+			if d := phase.duration(record.Report); d != -1 {
+				sum += d
+				if d > max {
+					max = d
+				}
+				count++
 			}
-			agg.ConnectDuration[0] += int(report.ConnectDuration.Milliseconds()) / agg.numOfAggReports
 		}
-
-		// update FirstByteDuration (-1 means there has been an error)
-		if report.FirstByteDuration != -1 {
-			if int(report.FirstByteDuration) > agg.FirstByteDuration[1] {
-				agg.FirstByteDuration[1] = int(report.FirstByteDuration.Milliseconds())
-			}
-			agg.FirstByteDuration[0] += int(report.FirstByteDuration.Milliseconds()) / agg.numOfAggReports
+		*phase.stat = [2]int{0, int(max.Milliseconds())}
+		if count > 0 {
+			phase.stat[0] = int((sum / time.Duration(count)).Milliseconds())
 		}
 	}
 }
 
-// updateStatusCount updates status count using `agg.statuscodesc` channel (no need for a queue here)
-func (agg *IntervalAggData) updateStatusCount(newReport *inspect.Report) {
-	// only start dequeuing from channel after it becomes full
-	if len(agg.statuscodesc) == cap(agg.statuscodesc) {
-		statusCode := <-agg.statuscodesc
-		if _, ok := agg.StatusCodesCount[statusCode]; ok {
-			agg.StatusCodesCount[statusCode]--
+// Latency aggregates the `phase` (ttfb or total) durations of the successful reports in the window
+// `aggregate` is one of avg, max or pNN (NNth percentile). Returns 0 if there's no successful report
+func (agg *IntervalAggData) Latency(phase, aggregate string) time.Duration {
+	durations := make([]time.Duration, 0, len(agg.records))
+	for _, record := range agg.records {
+		d := record.Report.FirstByteDuration
+		if phase == "total" {
+			d = record.Report.TotalDuration
+		}
+		// -1 means there has been an error
+		if d != -1 {
+			durations = append(durations, d)
 		}
 	}
-	// note that statuscodesc is a buffered chan of capacity `numOfAggReports`
-	agg.statuscodesc <- newReport.StatusCode
-	agg.StatusCodesCount[newReport.StatusCode]++
-}
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
 
-// update handles the alerting logic
-// Alert if website availability is below config.CriticalAvailability for the past config.WebsiteAlertInterval
-// Alert if website has recovered
-func (alert *Alert) update(newReport *inspect.Report) {
-	oldAvailability := alert.Availability
-	// update availability using alert.statuscodesc channel
-	// only start dequeuing from channel after it becomes full
-	if len(alert.statuscodesc) == cap(alert.statuscodesc) {
-		statusCode := <-alert.statuscodesc
-		if statusCode == 200 {
-			alert.Availability -= 1 / float64(cap(alert.statuscodesc))
+	switch aggregate {
+	case "avg":
+		var sum time.Duration
+		for _, d := range durations {
+			sum += d
 		}
+		return sum / time.Duration(len(durations))
+	case "max":
+		return durations[len(durations)-1]
+	default:
+		// nearest-rank percentile
+		p, _ := strconv.Atoi(strings.TrimPrefix(aggregate, "p"))
+		rank := int(math.Ceil(float64(p) / 100 * float64(len(durations))))
+		if rank < 1 {
+			rank = 1
+		}
+		return durations[rank-1]
 	}
-	// note that statuscodesc is a buffered chan of capacity `numOfAggReports`
-	alert.statuscodesc <- newReport.StatusCode
-	if newReport.StatusCode == 200 {
-		alert.Availability += 1 / float64(cap(alert.statuscodesc))
+}
+
+// ValidateLatencyAlert checks that `phase` and `aggregate` can be used in `IntervalAggData.Latency`
+func ValidateLatencyAlert(phase, aggregate string) error {
+	if phase != "ttfb" && phase != "total" {
+		return fmt.Errorf("unknown latency phase %q (expected ttfb or total)", phase)
 	}
-	alert.Availability = math.Round(alert.Availability*100) / 100
-	if alert.WebsiteHasRecovered {
-		alert.WebsiteHasRecovered = false
+	if aggregate == "avg" || aggregate == "max" {
+		return nil
 	}
-	if oldAvailability < config.CriticalAvailability && alert.Availability >= config.CriticalAvailability {
-		alert.WebsiteHasRecovered = true
+	if p, err := strconv.Atoi(strings.TrimPrefix(aggregate, "p")); err == nil && strings.HasPrefix(aggregate, "p") && p > 0 && p <= 100 {
+		return nil
 	}
+	return fmt.Errorf("unknown latency aggregate %q (expected avg, max or a percentile like p95)", aggregate)
+}
+
+// update handles the alerting logic
+// Alert if website availability is below the critical availability (or warn if it's below the warning availability)
+// for the past alert window
+// Alert if website has recovered
+func (alert *Alert) update(record *Record) {
+	newReport := record.Report
+	alert.window.aggregate(record)
+	alert.Availability = alert.window.Availability
 	if newReport.StatusCode == 200 {
 		alert.WebsiteWasDown = false
 	} else {
 		alert.WebsiteWasDown = true
 	}
+	alert.updateLatency()
+
+	// suppress individual down/recovered transitions while website is flapping
+	alert.updateFlapping(newReport)
+	alert.WebsiteHasRecovered, alert.WebsiteWentDown, alert.AvailabilityChanged = false, false, false
+	if alert.Flapping {
+		alert.WebsiteWasDown = false
+		return
+	}
+	// * note comparing with the last notified level (instead of the level of `oldAvailability`) catches up after flapping stops
+	level := alert.settings.availabilityLevel(alert.Availability)
+	if alert.Warning = newReport.Warning; alert.Warning != "" && level < Warning {
+		level = Warning
+	}
+	alert.availabilityFrom, alert.AvailabilityLevel = alert.AvailabilityLevel, level
+	alert.AvailabilityChanged = level != alert.availabilityFrom
+	alert.WebsiteHasRecovered = alert.availabilityFrom == Critical && level != Critical
+	alert.WebsiteWentDown = alert.availabilityFrom != Critical && level == Critical
+}
+
+// updateFlapping handles flap detection (similar to Nagios)
+// Website starts flapping when its weighted percent state change goes above the flap high threshold
+// and stops flapping when it goes back below the flap low threshold
+func (alert *Alert) updateFlapping(newReport *inspect.Report) {
+	alert.FlappingStarted, alert.FlappingStopped = false, false
+	if alert.numOfStates < 3 || alert.settings.FlapHighThreshold <= 0 {
+		return
+	}
+
+	// add new state to states queue
+	if len(alert.states) >= alert.numOfStates {
+		alert.states = alert.states[1:]
+	}
+	alert.states = append(alert.states, newReport.StatusCode == 200)
+
+	// recent state changes weigh more (from 0.8 for the oldest to 1.2 for the newest)
+	// * note we divide by the full window so that a fresh website doesn't start flapping right away
+	var changes float64
+	for i := 1; i < len(alert.states); i++ {
+		if alert.states[i] != alert.states[i-1] {
+			changes += 0.8 + 0.4*float64(i-1+alert.numOfStates-len(alert.states))/float64(alert.numOfStates-2)
+		}
+	}
+	alert.StateChange = math.Round(changes/float64(alert.numOfStates-1)*100) / 100
+
+	if !alert.Flapping && alert.StateChange > alert.settings.FlapHighThreshold {
+		alert.Flapping, alert.FlappingStarted = true, true
+	} else if alert.Flapping && alert.StateChange < alert.settings.FlapLowThreshold {
+		alert.Flapping, alert.FlappingStopped = false, true
+	}
+}
+
+// updateLatency handles the latency alerting logic
+// Alert if website latency is above the latency threshold (or warn if it's above the latency warning threshold)
+// for the past alert window
+// Alert if website latency has recovered
+func (alert *Alert) updateLatency() {
+	alert.Latency = alert.window.Latency(alert.settings.LatencyPhase, alert.settings.LatencyAggregate)
+	level := alert.settings.latencyLevel(alert.Latency)
+	alert.latencyFrom, alert.LatencyLevel = alert.LatencyLevel, level
+	alert.LatencyChanged = level != alert.latencyFrom
+	alert.LatencyIsHigh = level == Critical
+	alert.LatencyWentHigh = alert.latencyFrom != Critical && level == Critical
+	alert.LatencyHasRecovered = alert.latencyFrom == Critical && level != Critical
 }
 
 // updateAvg keeps track of the avg of a metric
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+)
+
+// Settings are the windows reports are aggregated over and the thresholds alerts are evaluated with,
+// metrics only read them so they can be shared by the metrics of several websites
+type Settings struct {
+	StatsWindows            config.Windows
+	AlertWindow             time.Duration // window of availability and latency alerts
+	FlapWindow              time.Duration // window of flap detection
+	HistoryRetention        time.Duration // how long processed reports are kept in history
+	CriticalAvailability    float64
+	WarningAvailability     float64 // 0 disables availability warnings
+	LatencyThreshold        time.Duration
+	LatencyWarningThreshold time.Duration // 0 disables latency warnings
+	LatencyAggregate        string        // avg, max or a percentile like p95
+	LatencyPhase            string        // ttfb or total
+	FlapHighThreshold       float64       // 0 disables flap detection
+	FlapLowThreshold        float64
+}
+
+// ConfigSettings returns the settings of the process-wide configuration (see package config)
+func ConfigSettings() *Settings {
+	return &Settings{
+		StatsWindows:            config.StatsWindows,
+		AlertWindow:             config.WebsiteAlertInterval,
+		FlapWindow:              config.FlapDetectionInterval,
+		HistoryRetention:        config.HistoryRetention,
+		CriticalAvailability:    config.CriticalAvailability,
+		WarningAvailability:     config.WarningAvailability,
+		LatencyThreshold:        config.LatencyThreshold,
+		LatencyWarningThreshold: config.LatencyWarningThreshold,
+		LatencyAggregate:        config.LatencyAggregate,
+		LatencyPhase:            config.LatencyPhase,
+		FlapHighThreshold:       config.FlapHighThreshold,
+		FlapLowThreshold:        config.FlapLowThreshold,
+	}
+}
+
+// CheckPollingInterval returns an error if a window is shorter than `pollingInterval`, as it would hold no report of
+// a website polled that often: its metrics would be computed over zero reports and its alerts would never fire
+func (s *Settings) CheckPollingInterval(pollingInterval time.Duration) error {
+	type window struct {
+		name     string
+		duration time.Duration
+	}
+	windows := []window{{"alert", s.AlertWindow}}
+	for _, w := range s.StatsWindows {
+		windows = append(windows, window{w.Name + " stats", w.Duration})
+	}
+	if s.FlapHighThreshold > 0 {
+		windows = append(windows, window{"flap", s.FlapWindow})
+	}
+	for _, w := range windows {
+		if w.duration < pollingInterval {
+			return fmt.Errorf("polling interval %v is longer than the %s window %v", pollingInterval, w.name, w.duration)
+		}
+	}
+	return nil
+}
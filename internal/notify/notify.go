@@ -0,0 +1,140 @@
+// Package notify sends incident notifications over the channels defined in the configuration file
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+)
+
+// timeout of a single notification
+const timeout = 10 * time.Second
+
+// Notification is sent to a channel when an incident opens, resolves, is repeated or escalated
+type Notification struct {
+	Incident  string    `json:"incident"` // incident key (url and alert)
+	Url       string    `json:"url"`
+	Alert     string    `json:"alert"`
+	Severity  string    `json:"severity"`
+	Resolved  bool      `json:"resolved"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+	Repeat    int       `json:"repeat"`    // number of times the incident was already notified
+	Escalated bool      `json:"escalated"` // incident was escalated to the secondary channel
+	// urls whose alerts are suppressed and grouped under this incident because they depend on its website
+	Suppressed []string `json:"suppressed,omitempty"`
+}
+
+// Notifier sends notifications over a single channel
+type Notifier interface {
+	Notify(n *Notification) error
+}
+
+// New inits the Notifier defined by `cfg`
+func New(cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case "webhook":
+		if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+			return nil, fmt.Errorf("invalid webhook url %q: %v", cfg.URL, err)
+		}
+		return &webhook{url: cfg.URL, client: &http.Client{Timeout: timeout}}, nil
+	case "exec":
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("exec notifier requires a command")
+		}
+		return &command{args: cfg.Command}, nil
+	case "file":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("file notifier requires a path")
+		}
+		return &file{path: cfg.Path}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q (expected webhook, exec or file)", cfg.Type)
+}
+
+// FromConfig inits the notifiers of all channels defined in the configuration file
+func FromConfig(configs map[string]config.NotifierConfig) (map[string]Notifier, error) {
+	notifiers := make(map[string]Notifier, len(configs))
+	for name, cfg := range configs {
+		n, err := New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("notifier %q: %v", name, err)
+		}
+		notifiers[name] = n
+	}
+	return notifiers, nil
+}
+
+// webhook POSTs notifications as JSON
+type webhook struct {
+	url    string
+	client *http.Client
+}
+
+func (w *webhook) Notify(n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s answered %s", w.url, resp.Status)
+	}
+	return nil
+}
+
+// command runs a command with the JSON notification on its stdin
+type command struct {
+	args []string
+}
+
+func (c *command) Notify(n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.args[0], c.args[1:]...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), "ISEEU_MESSAGE="+n.Message, "ISEEU_SEVERITY="+n.Severity)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", c.args[0], err, out)
+	}
+	return nil
+}
+
+// file appends notifications to a file, one JSON object per line
+type file struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (f *file) Notify(n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = out.Write(append(body, '\n'))
+	return err
+}
@@ -0,0 +1,203 @@
+// Package registry manages the set of monitored websites, which can change at runtime
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+)
+
+// Monitor is a monitored website: its inspector and the metrics processing its reports
+type Monitor struct {
+	Url             string
+	Name            string   // optional name, used as id when set
+	Tags            []string // optional free-form tags
+	PollingInterval time.Duration
+	Inspector       *inspect.Inspector
+	Metrics         *metrics.Metrics
+}
+
+// ID returns the id of the monitor: its name if it has one, its url otherwise
+func (m *Monitor) ID() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return m.Url
+}
+
+// HasTag returns whether the monitor is tagged with `tag`
+func (m *Monitor) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry holds the monitors, it's safe for concurrent use
+type Registry struct {
+	mu       sync.RWMutex
+	monitors []*Monitor        // monitors in the order they were added
+	onAdd    func(m *Monitor)  // called before a new monitor starts processing reports
+	onRemove func(m *Monitor)  // called once a monitor is removed
+	Clock    clock.Clock       // clock of the inspectors and metrics of new monitors
+	Settings *metrics.Settings // windows and alert settings of new monitors, those of package config when nil
+	closed   bool              // monitors can't be added to a closed registry
+	running  sync.WaitGroup    // metrics processing reports
+}
+
+// New inits an empty Registry, `onAdd` and `onRemove` hooks can be nil
+func New(onAdd, onRemove func(m *Monitor)) *Registry {
+	return &Registry{onAdd: onAdd, onRemove: onRemove, Clock: clock.Real}
+}
+
+// Add starts monitoring `url` (normalized with `inspect.ParseConfigURL`) every `pollingInterval`,
+// which must fit in the windows of the settings
+func (r *Registry) Add(url string, pollingInterval time.Duration, name string, tags ...string) (*Monitor, error) {
+	url, err := inspect.ParseConfigURL(url)
+	if err != nil {
+		return nil, err
+	}
+	if pollingInterval <= 0 {
+		return nil, fmt.Errorf("polling interval must be positive")
+	}
+	settings := r.Settings
+	if settings == nil {
+		settings = metrics.ConfigSettings()
+	}
+	if err := settings.CheckPollingInterval(pollingInterval); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, errors.New("registry is closed")
+	}
+	for _, m := range r.monitors {
+		if m.Url == url || (name != "" && m.Name == name) {
+			return nil, fmt.Errorf("monitor %s already exists", m.ID())
+		}
+	}
+
+	// Init the inspector, which monitors the URL and sends back the trace report over its reports channel
+	inspector, err := inspect.NewInspector(url, pollingInterval, settings.StatsWindows.Longest(), r.Clock)
+	if err != nil {
+		return nil, err
+	}
+
+	// init metrics server for the url, with the url known before its first report
+	s := metrics.NewMetrics(inspector.Reports(), pollingInterval, settings)
+	s.Url = url
+	s.Clock = r.Clock
+
+	m := &Monitor{Url: url, Name: name, Tags: tags, PollingInterval: pollingInterval, Inspector: inspector, Metrics: s}
+	if r.onAdd != nil {
+		r.onAdd(m)
+	}
+	r.monitors = append(r.monitors, m)
+
+	// listen to the reports channel, process its reports, and update the corresponding `Metrics`
+	// it returns once the inspector is stopped
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		s.ListenAndProcess()
+	}()
+	return m, nil
+}
+
+// Remove stops and removes the monitor identified by `id`
+// it's stopped and `onRemove` is called once the registry is unlocked, so that they can use it
+func (r *Registry) Remove(id string) error {
+	r.mu.Lock()
+	var removed *Monitor
+	for i, m := range r.monitors {
+		if r.matches(m, id) {
+			removed = m
+			r.monitors = append(r.monitors[:i:i], r.monitors[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+	if removed == nil {
+		return fmt.Errorf("unknown monitor %s", id)
+	}
+
+	removed.Inspector.Stop()
+	if r.onRemove != nil {
+		r.onRemove(removed)
+	}
+	return nil
+}
+
+// Close stops all monitors, and waits until their in-flight requests are processed or `ctx` is done, which cancels them
+func (r *Registry) Close(ctx context.Context) error {
+	r.mu.Lock()
+	r.closed = true
+	for _, m := range r.monitors {
+		m.Inspector.Drain()
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		for _, m := range r.Monitors() {
+			m.Inspector.Stop()
+		}
+		return fmt.Errorf("waiting for in-flight requests: %v", ctx.Err())
+	}
+}
+
+// Get returns the monitor identified by its id, its url or a url that normalizes to it, or nil
+func (r *Registry) Get(id string) *Monitor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, m := range r.monitors {
+		if r.matches(m, id) {
+			return m
+		}
+	}
+	return nil
+}
+
+// matches returns whether `m` is identified by `id`
+func (r *Registry) matches(m *Monitor, id string) bool {
+	if m.ID() == id || m.Url == id {
+		return true
+	}
+	url, err := inspect.ParseConfigURL(id)
+	return err == nil && url == m.Url
+}
+
+// Monitors returns a snapshot of the monitors
+func (r *Registry) Monitors() []*Monitor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Monitor(nil), r.monitors...)
+}
+
+// Metrics returns a snapshot of the metrics of all monitors
+func (r *Registry) Metrics() []*metrics.Metrics {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	stats := make([]*metrics.Metrics, 0, len(r.monitors))
+	for _, m := range r.monitors {
+		stats = append(stats, m.Metrics)
+	}
+	return stats
+}
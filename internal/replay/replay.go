@@ -0,0 +1,169 @@
+// Package replay feeds recorded reports through metrics and alerting on a virtual clock, to see which alerts
+// would have fired with other alert settings (e.g. config.CriticalAvailability or windows) before deploying them
+package replay
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+)
+
+// Options defines how reports are replayed
+type Options struct {
+	Speed float64       // replay speed relative to real time, e.g. 60 replays an hour in a minute (0 replays as fast as possible)
+	Rules []*rules.Rule // alert rules evaluated against every website
+}
+
+// Result is the outcome of a replay
+type Result struct {
+	Reports int              // number of replayed reports
+	Urls    []string         // replayed websites, sorted
+	From    time.Time        // time of the first replayed report
+	To      time.Time        // time of the last replayed report
+	Events  []*metrics.Event // alert transitions, sorted by time
+	Alerts  []*Alert         // alerts which fired, sorted by website and alert
+}
+
+// Alert summarizes how an alert of a website fired during a replay
+type Alert struct {
+	Url      string
+	Alert    string // availability, latency, flapping or rule:<name>
+	Severity string
+	Fired    int           // number of times the alert fired
+	Firing   time.Duration // total time the alert was firing
+	Ongoing  bool          // whether the alert was still firing at the end of the replay
+}
+
+// Run replays `records` in the order of their time: each website gets its own metrics, fed by `ListenAndProcess`,
+// whose clock is the time of the report being processed
+// `fn` (if not nil) is called with every alert transition as it happens
+func Run(records []*metrics.Record, opts Options, fn func(*metrics.Event)) (*Result, error) {
+	sorted := append([]*metrics.Record(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	result := &Result{}
+	var mu sync.Mutex // guards result.Events, appended from the goroutines of metrics
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	websites := make(map[string]*website)
+	defer func() {
+		for _, w := range websites {
+			close(w.reportc)
+		}
+		wg.Wait()
+	}()
+
+	var previous time.Time
+	for _, record := range sorted {
+		w, ok := websites[record.Report.Url]
+		if !ok {
+			if record.Report.PollingInterval <= 0 {
+				return nil, fmt.Errorf("report of %s at %v has no polling interval", record.Report.Url, record.Time)
+			}
+			w = newWebsite(record.Report.PollingInterval, opts.Rules)
+			w.metrics.Subscribe(func(e *metrics.Event) {
+				mu.Lock()
+				result.Events = append(result.Events, e)
+				mu.Unlock()
+				if fn != nil {
+					fn(e)
+				}
+			})
+			// the next report is only replayed once the alert transitions of this one are passed to `fn`,
+			// so that they're in the order of time across websites
+			w.metrics.SubscribeDone(func(*metrics.Record) { done <- struct{}{} })
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w.metrics.ListenAndProcess()
+			}()
+			websites[record.Report.Url] = w
+			result.Urls = append(result.Urls, record.Report.Url)
+		}
+
+		if opts.Speed > 0 && !previous.IsZero() {
+			time.Sleep(time.Duration(float64(record.Time.Sub(previous)) / opts.Speed))
+		}
+		previous = record.Time
+		if result.Reports == 0 {
+			result.From = record.Time
+		}
+		result.To = record.Time
+		result.Reports++
+
+		// the clock is only read while processing the report, which is waited for before moving it forward
+		w.clock.Set(record.Time)
+		w.reportc <- record.Report
+		<-done
+	}
+
+	for _, w := range websites {
+		close(w.reportc)
+	}
+	wg.Wait()
+	websites = nil
+
+	sort.Strings(result.Urls)
+	sort.SliceStable(result.Events, func(i, j int) bool { return result.Events[i].Time.Before(result.Events[j].Time) })
+	result.Alerts = summarize(result.Events, result.To)
+	return result, nil
+}
+
+// website is a replayed website
+type website struct {
+	metrics *metrics.Metrics
+	reportc chan *inspect.Report
+	clock   *clock.Fake // virtual clock of its metrics
+}
+
+func newWebsite(pollingInterval time.Duration, ruleset []*rules.Rule) *website {
+	w := &website{reportc: make(chan *inspect.Report), clock: clock.NewFake(time.Time{})}
+	w.metrics = metrics.NewMetrics(w.reportc, pollingInterval, metrics.ConfigSettings())
+	w.metrics.Clock = w.clock
+	if len(ruleset) > 0 {
+		w.metrics.Rules = rules.NewEvaluator(ruleset)
+	}
+	return w
+}
+
+// summarize returns the alerts which fired in `events`, those still firing at `end` firing until then
+func summarize(events []*metrics.Event, end time.Time) []*Alert {
+	alerts := make(map[[2]string]*Alert)
+	since := make(map[[2]string]time.Time) // time firing alerts started
+	var ordered []*Alert
+	for _, e := range events {
+		key := [2]string{e.Url, e.Alert}
+		start, firing := since[key]
+		switch {
+		case !e.Resolved && !firing:
+			a, ok := alerts[key]
+			if !ok {
+				a = &Alert{Url: e.Url, Alert: e.Alert, Severity: e.Severity}
+				alerts[key] = a
+				ordered = append(ordered, a)
+			}
+			a.Fired++
+			since[key] = e.Time
+		case e.Resolved && firing:
+			alerts[key].Firing += e.Time.Sub(start)
+			delete(since, key)
+		}
+	}
+	for key, start := range since {
+		alerts[key].Firing += end.Sub(start)
+		alerts[key].Ongoing = true
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Url != ordered[j].Url {
+			return ordered[i].Url < ordered[j].Url
+		}
+		return ordered[i].Alert < ordered[j].Alert
+	})
+	return ordered
+}
@@ -0,0 +1,524 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// expr is a compiled rule expression evaluated over a window of samples
+type expr interface {
+	eval(w *window) float64 // booleans evaluate to 1 (true) or 0 (false), missing data to NaN
+	boolean() bool          // whether the expression is a boolean
+	maxWindow() time.Duration
+}
+
+// parse compiles an expression such as `availability(5m) < 0.95 and p95(ttfb, 5m) > 800ms`
+//
+// Grammar:
+//
+//	expr    := and ("or" and)*
+//	and     := not ("and" not)*
+//	not     := "not" not | cmp
+//	cmp     := primary (("<" | "<=" | ">" | ">=" | "==" | "!=") primary)?
+//	primary := number | duration | call | "(" expr ")"
+//	call    := availability(window) | error_rate(window) | count(window)
+//	         | avg(phase, window) | min(phase, window) | max(phase, window) | pNN(phase, window)
+//	         | metric(name, window)
+//
+// where phase is one of connect, ttfb or total, latencies and durations compare in milliseconds,
+// and metric averages the named values of reports (e.g. performance data of exec checks) which have it
+func parse(input string) (expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.peek().text, p.peek().pos)
+	}
+	return e, nil
+}
+
+/* -------------------------------------------------------------------------- */
+/*                                    LEXER                                   */
+/* -------------------------------------------------------------------------- */
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokDuration
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits the expression into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case strings.ContainsRune("<>=!&|", c):
+			j := i + 1
+			if j < len(input) && strings.ContainsRune("=&|", rune(input[j])) {
+				j++
+			}
+			op := input[i:j]
+			switch op {
+			case "<", "<=", ">", ">=", "==", "!=":
+			case "&&":
+				op = "and"
+			case "||":
+				op = "or"
+			case "!":
+				op = "not"
+			default:
+				return nil, fmt.Errorf("unknown operator %q at offset %d", op, i)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i = j
+		case unicode.IsDigit(c) || c == '.':
+			// a unit suffix makes it a duration (e.g. 800ms, 5m, 1h30m) or a percentage (e.g. 95%)
+			kind, k := tokNumber, i
+			for {
+				j := k
+				for j < len(input) && (unicode.IsDigit(rune(input[j])) || input[j] == '.') {
+					j++
+				}
+				k = j
+				for k < len(input) && (unicode.IsLetter(rune(input[k])) || input[k] == '%') {
+					k++
+				}
+				if k == j {
+					break
+				}
+				kind = tokDuration
+				if k == len(input) || !unicode.IsDigit(rune(input[k])) {
+					break
+				}
+			}
+			tokens = append(tokens, token{kind, input[i:k], i})
+			i = k
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(input) && (unicode.IsLetter(rune(input[j])) || unicode.IsDigit(rune(input[j])) || input[j] == '_') {
+				j++
+			}
+			word := input[i:j]
+			if word == "and" || word == "or" || word == "not" {
+				tokens = append(tokens, token{tokOp, word, i})
+			} else {
+				tokens = append(tokens, token{tokIdent, word, i})
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+		}
+	}
+	return append(tokens, token{tokEOF, "end of expression", len(input)}), nil
+}
+
+/* -------------------------------------------------------------------------- */
+/*                                   PARSER                                   */
+/* -------------------------------------------------------------------------- */
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, fmt.Errorf("expected %s at offset %d, got %q", what, t.pos, t.text)
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "or" {
+		t := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if !left.boolean() || !right.boolean() {
+			return nil, fmt.Errorf("operands of \"or\" at offset %d must be comparisons", t.pos)
+		}
+		left = &logical{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOp && p.peek().text == "and" {
+		t := p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if !left.boolean() || !right.boolean() {
+			return nil, fmt.Errorf("operands of \"and\" at offset %d must be comparisons", t.pos)
+		}
+		left = &logical{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (expr, error) {
+	if p.peek().kind == tokOp && p.peek().text == "not" {
+		t := p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if !operand.boolean() {
+			return nil, fmt.Errorf("operand of \"not\" at offset %d must be a comparison", t.pos)
+		}
+		return &negation{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (expr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.kind != tokOp || t.text == "and" || t.text == "or" || t.text == "not" {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if left.boolean() || right.boolean() {
+		return nil, fmt.Errorf("operands of %q at offset %d must be numbers", t.text, t.pos)
+	}
+	return &comparison{op: t.text, left: left, right: right}, nil
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", t.text, t.pos)
+		}
+		return constant(v), nil
+	case tokDuration:
+		if strings.HasSuffix(t.text, "%") {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(t.text, "%"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid percentage %q at offset %d", t.text, t.pos)
+			}
+			return constant(v / 100), nil
+		}
+		d, err := time.ParseDuration(t.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q at offset %d", t.text, t.pos)
+		}
+		return constant(float64(d) / float64(time.Millisecond)), nil
+	case tokLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, "\")\""); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case tokIdent:
+		return p.parseCall(t)
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
+
+// parseCall parses a window function call, `name` being the already consumed function name
+func (p *parser) parseCall(name token) (expr, error) {
+	if _, err := p.expect(tokLParen, "\"(\" after "+name.text); err != nil {
+		return nil, err
+	}
+	call := &call{name: name.text}
+	switch {
+	case name.text == "availability" || name.text == "error_rate" || name.text == "count":
+	case name.text == "metric":
+		metric, err := p.expect(tokIdent, "metric name")
+		if err != nil {
+			return nil, err
+		}
+		call.metric = metric.text
+		if _, err := p.expect(tokComma, "\",\""); err != nil {
+			return nil, err
+		}
+	case name.text == "avg" || name.text == "min" || name.text == "max":
+		call.percentile = -1
+	case strings.HasPrefix(name.text, "p"):
+		pct, err := strconv.Atoi(name.text[1:])
+		if err != nil || pct <= 0 || pct > 100 {
+			return nil, fmt.Errorf("unknown function %q at offset %d", name.text, name.pos)
+		}
+		call.percentile = pct
+	default:
+		return nil, fmt.Errorf("unknown function %q at offset %d", name.text, name.pos)
+	}
+
+	// latency functions take the request phase as first argument
+	if call.percentile != 0 {
+		phase, err := p.expect(tokIdent, "request phase (connect, ttfb or total)")
+		if err != nil {
+			return nil, err
+		}
+		if phase.text != "connect" && phase.text != "ttfb" && phase.text != "total" {
+			return nil, fmt.Errorf("unknown request phase %q at offset %d (expected connect, ttfb or total)", phase.text, phase.pos)
+		}
+		call.phase = phase.text
+		if _, err := p.expect(tokComma, "\",\""); err != nil {
+			return nil, err
+		}
+	}
+
+	window, err := p.expect(tokDuration, "window duration (e.g. 5m)")
+	if err != nil {
+		return nil, err
+	}
+	call.window, err = time.ParseDuration(window.text)
+	if err != nil || call.window <= 0 {
+		return nil, fmt.Errorf("invalid window %q at offset %d", window.text, window.pos)
+	}
+	if _, err := p.expect(tokRParen, "\")\""); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+/* -------------------------------------------------------------------------- */
+/*                                 EVALUATION                                 */
+/* -------------------------------------------------------------------------- */
+
+type constant float64
+
+func (c constant) eval(*window) float64   { return float64(c) }
+func (constant) boolean() bool            { return false }
+func (constant) maxWindow() time.Duration { return 0 }
+
+type logical struct {
+	op          string
+	left, right expr
+}
+
+// eval combines both operands, missing data (NaN) is unknown: it doesn't decide the result, which is missing
+// if it depends on it (e.g. `false and NaN` is false, `true and NaN` is NaN)
+func (l *logical) eval(w *window) float64 {
+	left, right := l.left.eval(w), l.right.eval(w)
+	decisive := 0.0 // value of an operand deciding the result
+	if l.op == "or" {
+		decisive = 1
+	}
+	switch {
+	case left == decisive || right == decisive:
+		return decisive
+	case math.IsNaN(left) || math.IsNaN(right):
+		return math.NaN()
+	}
+	return 1 - decisive
+}
+func (*logical) boolean() bool { return true }
+func (l *logical) maxWindow() time.Duration {
+	return maxDuration(l.left.maxWindow(), l.right.maxWindow())
+}
+
+type negation struct {
+	operand expr
+}
+
+// eval negates its operand, missing data (NaN) stays missing
+func (n *negation) eval(w *window) float64 {
+	operand := n.operand.eval(w)
+	if math.IsNaN(operand) {
+		return operand
+	}
+	return boolToFloat(operand != 1)
+}
+func (*negation) boolean() bool              { return true }
+func (n *negation) maxWindow() time.Duration { return n.operand.maxWindow() }
+
+type comparison struct {
+	op          string
+	left, right expr
+}
+
+// eval compares both operands, any comparison with missing data (NaN) is missing too, so that it never holds
+// even when negated
+func (c *comparison) eval(w *window) float64 {
+	left, right := c.left.eval(w), c.right.eval(w)
+	if math.IsNaN(left) || math.IsNaN(right) {
+		return math.NaN()
+	}
+	switch c.op {
+	case "<":
+		return boolToFloat(left < right)
+	case "<=":
+		return boolToFloat(left <= right)
+	case ">":
+		return boolToFloat(left > right)
+	case ">=":
+		return boolToFloat(left >= right)
+	case "==":
+		return boolToFloat(left == right)
+	default:
+		return boolToFloat(left != right)
+	}
+}
+func (*comparison) boolean() bool { return true }
+func (c *comparison) maxWindow() time.Duration {
+	return maxDuration(c.left.maxWindow(), c.right.maxWindow())
+}
+
+type call struct {
+	name       string
+	phase      string        // request phase of latency functions
+	percentile int           // 0 for non latency functions, -1 for avg/min/max, NN for pNN
+	metric     string        // name of the value averaged by metric
+	window     time.Duration // aggregation window
+}
+
+func (c *call) eval(w *window) float64 {
+	samples := w.since(c.window)
+	switch c.name {
+	case "count":
+		return float64(len(samples))
+	case "availability", "error_rate":
+		if len(samples) == 0 {
+			return math.NaN()
+		}
+		available := 0
+		for _, s := range samples {
+			if s.report.StatusCode == 200 {
+				available++
+			}
+		}
+		availability := float64(available) / float64(len(samples))
+		if c.name == "error_rate" {
+			return 1 - availability
+		}
+		return availability
+	case "metric":
+		var sum float64
+		n := 0
+		for _, s := range samples {
+			if v, ok := s.report.Metrics[c.metric]; ok {
+				sum += v
+				n++
+			}
+		}
+		if n == 0 {
+			return math.NaN()
+		}
+		return sum / float64(n)
+	}
+
+	// latency functions only consider successful requests (-1 means there has been an error)
+	latencies := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		d := s.report.FirstByteDuration
+		switch c.phase {
+		case "connect":
+			d = s.report.ConnectDuration
+		case "total":
+			d = s.report.TotalDuration
+		}
+		if d != -1 {
+			latencies = append(latencies, float64(d)/float64(time.Millisecond))
+		}
+	}
+	if len(latencies) == 0 {
+		return math.NaN()
+	}
+	sort.Float64s(latencies)
+	switch c.name {
+	case "min":
+		return latencies[0]
+	case "max":
+		return latencies[len(latencies)-1]
+	case "avg":
+		var sum float64
+		for _, l := range latencies {
+			sum += l
+		}
+		return sum / float64(len(latencies))
+	}
+	// nearest-rank percentile
+	rank := int(math.Ceil(float64(c.percentile) / 100 * float64(len(latencies))))
+	if rank < 1 {
+		rank = 1
+	}
+	return latencies[rank-1]
+}
+func (*call) boolean() bool              { return false }
+func (c *call) maxWindow() time.Duration { return c.window }
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
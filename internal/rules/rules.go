@@ -0,0 +1,164 @@
+// Package rules implements user-defined alert rules, which are expressions over window aggregates
+// of a website's reports such as `availability(5m) < 0.95 and p95(ttfb, 5m) > 800ms`
+package rules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+)
+
+// Rule is a compiled alert rule
+type Rule struct {
+	Name        string
+	Expr        string
+	Severity    string
+	For         time.Duration // how long `Expr` must hold before the rule fires
+	Labels      map[string]string
+	Annotations map[string]string
+	expr        expr
+}
+
+// State is the state of a rule for a given website
+type State int
+
+const (
+	Inactive State = iota // expression doesn't hold
+	Pending               // expression holds for less than `Rule.For`
+	Firing                // expression holds for at least `Rule.For`
+)
+
+func (s State) String() string {
+	return [...]string{"inactive", "pending", "firing"}[s]
+}
+
+// Alert tracks the state of a rule for a given website
+type Alert struct {
+	Rule        *Rule
+	State       State
+	ActiveSince time.Time // since when the expression holds
+	HasFired    bool      // rule started firing on last update
+	HasResolved bool      // rule stopped firing on last update
+}
+
+// Evaluator evaluates rules against the reports of a single website
+type Evaluator struct {
+	Alerts    []*Alert      // one alert per rule, in the same order as the rules
+	samples   []sample      // reports of the past `maxWindow`
+	maxWindow time.Duration // largest window used by the rules
+}
+
+// sample is a report along with the time it was received
+type sample struct {
+	at     time.Time
+	report *inspect.Report
+}
+
+// window holds the samples available when evaluating the rules
+type window struct {
+	now     time.Time
+	samples []sample
+}
+
+// since returns the samples of the past `d`
+func (w *window) since(d time.Duration) []sample {
+	from := w.now.Add(-d)
+	for i, s := range w.samples {
+		if s.at.After(from) {
+			return w.samples[i:]
+		}
+	}
+	return nil
+}
+
+// Compile compiles the rules defined in the configuration file
+func Compile(configs []config.RuleConfig) ([]*Rule, error) {
+	rules := make([]*Rule, 0, len(configs))
+	names := make(map[string]bool)
+	for i, c := range configs {
+		if c.Name == "" {
+			return nil, fmt.Errorf("rules[%d]: missing name", i)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("rules[%d]: duplicate rule name %q", i, c.Name)
+		}
+		names[c.Name] = true
+
+		severity := c.Severity
+		if severity == "" {
+			severity = "critical"
+		}
+		if severity != "info" && severity != "warning" && severity != "critical" {
+			return nil, fmt.Errorf("rule %q: unknown severity %q (expected info, warning or critical)", c.Name, c.Severity)
+		}
+
+		e, err := parse(c.Expr)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %v", c.Name, err)
+		}
+		if !e.boolean() {
+			return nil, fmt.Errorf("rule %q: expression must be a comparison", c.Name)
+		}
+
+		rules = append(rules, &Rule{
+			Name:        c.Name,
+			Expr:        c.Expr,
+			Severity:    severity,
+			For:         time.Duration(c.For),
+			Labels:      c.Labels,
+			Annotations: c.Annotations,
+			expr:        e,
+		})
+	}
+	return rules, nil
+}
+
+// NewEvaluator inits an Evaluator for `rules`
+func NewEvaluator(rules []*Rule) *Evaluator {
+	ev := &Evaluator{}
+	for _, r := range rules {
+		ev.Alerts = append(ev.Alerts, &Alert{Rule: r})
+		ev.maxWindow = maxDuration(ev.maxWindow, r.expr.maxWindow())
+	}
+	return ev
+}
+
+// Update adds a report received at `now` and evaluates all rules
+func (ev *Evaluator) Update(now time.Time, newReport *inspect.Report) {
+	// insert the new sample by time, as a slow probe can be reported after a later one,
+	// and drop samples older than the largest window
+	i := len(ev.samples)
+	for i > 0 && ev.samples[i-1].at.After(now) {
+		i--
+	}
+	ev.samples = append(ev.samples, sample{})
+	copy(ev.samples[i+1:], ev.samples[i:])
+	ev.samples[i] = sample{at: now, report: newReport}
+	from := now.Add(-ev.maxWindow)
+	for len(ev.samples) > 0 && !ev.samples[0].at.After(from) {
+		ev.samples = ev.samples[1:]
+	}
+
+	w := &window{now: now, samples: ev.samples}
+	for _, alert := range ev.Alerts {
+		alert.HasFired, alert.HasResolved = false, false
+		holds := alert.Rule.expr.eval(w) == 1
+
+		switch {
+		case !holds:
+			alert.HasResolved = alert.State == Firing
+			alert.State = Inactive
+		case alert.State == Inactive:
+			alert.ActiveSince = now
+			alert.State = Pending
+			fallthrough
+		case alert.State == Pending:
+			if now.Sub(alert.ActiveSince) >= alert.Rule.For {
+				alert.State = Firing
+				alert.HasFired = true
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package statuspage
+
+import (
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxFeedEntries is the number of most recent incidents listed in feeds
+const maxFeedEntries = 50
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+type atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rss struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel struct {
+		Title         string    `xml:"title"`
+		Link          string    `xml:"link"`
+		Description   string    `xml:"description"`
+		LastBuildDate string    `xml:"lastBuildDate"`
+		Items         []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+// atomFeed renders the Atom feed of the most recent incidents
+func atomFeed(p *page) ([]byte, error) {
+	feed := &atom{
+		Title:   p.Title + " incidents",
+		ID:      feedID(p),
+		Updated: p.Generated.Format(time.RFC3339),
+		Author:  p.Title,
+		Links:   []atomLink{{Href: pageLink(p)}, {Href: strings.TrimSuffix(pageLink(p), "index.html") + "feed.atom", Rel: "self"}},
+	}
+	for _, inc := range feedIncidents(p) {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   inc.Title(),
+			ID:      incidentID(inc),
+			Updated: updated(inc).Format(time.RFC3339),
+			Link:    atomLink{Href: pageLink(p)},
+			Summary: summary(inc, p.Generated),
+		})
+	}
+	return marshal(feed)
+}
+
+// rssFeed renders the RSS feed of the most recent incidents
+func rssFeed(p *page) ([]byte, error) {
+	feed := &rss{Version: "2.0"}
+	feed.Channel.Title = p.Title + " incidents"
+	feed.Channel.Link = pageLink(p)
+	feed.Channel.Description = "Incidents of " + p.Title
+	feed.Channel.LastBuildDate = p.Generated.Format(time.RFC1123Z)
+	for _, inc := range feedIncidents(p) {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       inc.Title(),
+			Link:        p.BaseURL,
+			Description: summary(inc, p.Generated),
+			GUID:        rssGUID{Value: incidentID(inc)},
+			PubDate:     updated(inc).Format(time.RFC1123Z),
+		})
+	}
+	return marshal(feed)
+}
+
+func marshal(v interface{}) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// feedIncidents returns the most recent incidents of the page
+func feedIncidents(p *page) []*Incident {
+	if len(p.Incidents) > maxFeedEntries {
+		return p.Incidents[:maxFeedEntries]
+	}
+	return p.Incidents
+}
+
+// pageLink returns the link of the published page, relative if its url isn't known
+func pageLink(p *page) string {
+	if p.BaseURL == "" {
+		return "index.html"
+	}
+	return strings.TrimSuffix(p.BaseURL, "/") + "/index.html"
+}
+
+// feedID returns a stable id of the feed
+func feedID(p *page) string {
+	if p.BaseURL != "" {
+		return p.BaseURL
+	}
+	return fmt.Sprintf("urn:sha1:%x", sha1.Sum([]byte(p.Title)))
+}
+
+// incidentID returns a stable id of an incident, which doesn't change when it's resolved
+func incidentID(inc *Incident) string {
+	return fmt.Sprintf("urn:sha1:%x", sha1.Sum([]byte(fmt.Sprintf("%s %s %d", inc.Url, inc.Alert, inc.Start.UnixNano()))))
+}
+
+// updated returns the last time an incident changed
+func updated(inc *Incident) time.Time {
+	if inc.Ongoing() {
+		return inc.Start.UTC()
+	}
+	return inc.End.UTC()
+}
+
+func summary(inc *Incident, now time.Time) string {
+	if inc.Ongoing() {
+		return fmt.Sprintf("%s Started %s, ongoing.", inc.Message, inc.Start.UTC().Format(time.RFC1123))
+	}
+	return fmt.Sprintf("%s Started %s, resolved after %v.", inc.Message, inc.Start.UTC().Format(time.RFC1123), inc.Duration(now))
+}
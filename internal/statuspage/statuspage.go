@@ -0,0 +1,380 @@
+// Package statuspage renders a self-contained static status page, and feeds of its incidents, from stored history
+package statuspage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// Site is a website shown on the status page
+type Site struct {
+	Url   string
+	Name  string // shown instead of the url when set
+	Group string // sites are shown by group, sites without group are shown last
+}
+
+// Options customizes the status page
+type Options struct {
+	Title   string
+	Days    int      // number of days of uptime bars
+	BaseURL string   // url the page is published at, used for links in feeds (optional)
+	Rules   []string // names of the alert rules, so that their incidents opened before the shown days are found (optional)
+}
+
+// site statuses, from best to worst
+const (
+	StatusUnknown     = "unknown"
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusDown        = "down"
+)
+
+// severity orders statuses, to show the worst status of a group
+var severity = map[string]int{StatusUnknown: 0, StatusOperational: 1, StatusDegraded: 2, StatusDown: 3}
+
+// Incident is an alert of a site, from its start event to its resolution event
+type Incident struct {
+	Url      string
+	Name     string
+	Alert    string
+	Severity string
+	Message  string
+	Start    time.Time
+	End      time.Time // zero while ongoing
+}
+
+// Ongoing returns whether the incident isn't resolved yet
+func (i *Incident) Ongoing() bool {
+	return i.End.IsZero()
+}
+
+// Title returns a short description of the incident
+func (i *Incident) Title() string {
+	var what string
+	switch {
+	case i.Alert == "availability":
+		what = "down"
+	case i.Alert == "latency":
+		what = "slow"
+	case i.Alert == "flapping":
+		what = "flapping"
+	default:
+		what = "alert " + strings.TrimPrefix(i.Alert, "rule:")
+	}
+	state := "Resolved"
+	if i.Ongoing() {
+		state = "Ongoing"
+	}
+	return fmt.Sprintf("[%s] %s %s", state, i.Name, what)
+}
+
+// Duration returns how long the incident lasted, or has lasted so far at `now`
+func (i *Incident) Duration(now time.Time) time.Duration {
+	if i.Ongoing() {
+		return now.Sub(i.Start).Round(time.Second)
+	}
+	return i.End.Sub(i.Start).Round(time.Second)
+}
+
+// day is the uptime of a site over a day (UTC)
+type day struct {
+	Day      time.Time
+	Up       int // number of reports with a 200 status code
+	Reports  int
+	Incident bool // whether an incident started that day
+}
+
+// Uptime returns the ratio of successful reports, or -1 without reports
+func (d *day) Uptime() float64 {
+	if d.Reports == 0 {
+		return -1
+	}
+	return float64(d.Up) / float64(d.Reports)
+}
+
+// siteStatus is the state of a site shown on the page
+type siteStatus struct {
+	Site
+	Status     string
+	LastReport time.Time
+	Days       []*day
+	Up         int
+	Reports    int
+}
+
+// Uptime returns the ratio of successful reports over all days, or -1 without reports
+func (s *siteStatus) Uptime() float64 {
+	if s.Reports == 0 {
+		return -1
+	}
+	return float64(s.Up) / float64(s.Reports)
+}
+
+// group is a group of sites shown on the page
+type group struct {
+	Name   string
+	Status string // worst status of its sites
+	Sites  []*siteStatus
+}
+
+// page is the data the page template is executed with
+type page struct {
+	Options
+	Generated time.Time
+	Status    string // worst status of all sites
+	Groups    []*group
+	Incidents []*Incident // incidents of the past days, most recent first
+}
+
+// Generate renders `index.html`, `feed.atom` and `feed.rss` in `dir` from the history of `sites` in `store`
+// if `sites` is empty, every website found in `store` is shown
+func Generate(store *storage.Store, sites []Site, dir string, opts Options, now time.Time) error {
+	p, err := build(store, sites, opts, now)
+	if err != nil {
+		return err
+	}
+
+	var html bytes.Buffer
+	if err := pageTemplate.Execute(&html, p); err != nil {
+		return err
+	}
+	atom, err := atomFeed(p)
+	if err != nil {
+		return err
+	}
+	rss, err := rssFeed(p)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for name, content := range map[string][]byte{"index.html": html.Bytes(), "feed.atom": atom, "feed.rss": rss} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// build computes the page data from the stored reports and events
+func build(store *storage.Store, sites []Site, opts Options, now time.Time) (*page, error) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := today.AddDate(0, 0, 1-opts.Days)
+
+	statuses := make(map[string]*siteStatus)
+	var ordered []*siteStatus
+	addSite := func(site Site) *siteStatus {
+		if site.Name == "" {
+			site.Name = site.Url
+		}
+		s := &siteStatus{Site: site, Status: StatusUnknown}
+		for i := 0; i < opts.Days; i++ {
+			s.Days = append(s.Days, &day{Day: from.AddDate(0, 0, i)})
+		}
+		statuses[site.Url] = s
+		ordered = append(ordered, s)
+		return s
+	}
+	for _, site := range sites {
+		addSite(site)
+	}
+
+	// aggregate reports by site and day, from the per-day rollups of past days
+	err := store.Rollups(from, now, 24*time.Hour, func(r *storage.Rollup) error {
+		s, ok := statuses[r.Url]
+		if !ok {
+			if len(sites) > 0 {
+				return nil
+			}
+			s = addSite(Site{Url: r.Url})
+		}
+		i := int(r.Time.Sub(from) / (24 * time.Hour))
+		if i < 0 || i >= len(s.Days) {
+			return nil
+		}
+		s.Days[i].Reports += r.Count
+		s.Reports += r.Count
+		s.Days[i].Up += r.Successes
+		s.Up += r.Successes
+		if r.Last.After(s.LastReport) {
+			s.LastReport = r.Last
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sites) == 0 {
+		sort.Slice(ordered, func(i, j int) bool { return ordered[i].Name < ordered[j].Name })
+	}
+
+	incidents, err := incidentsOf(store, statuses, opts, from, now)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &page{Options: opts, Generated: now, Status: StatusUnknown}
+	for _, s := range ordered {
+		if s.Reports > 0 {
+			s.Status = StatusOperational
+		}
+	}
+	for _, inc := range incidents {
+		s := statuses[inc.Url]
+		if inc.Ongoing() && inc.Severity != "info" {
+			status := StatusDegraded
+			if inc.Alert == "availability" {
+				status = StatusDown
+			}
+			if severity[status] > severity[s.Status] {
+				s.Status = status
+			}
+		}
+		if inc.Ongoing() || !inc.End.Before(from) {
+			p.Incidents = append(p.Incidents, inc)
+		}
+		if i := int(inc.Start.UTC().Sub(from) / (24 * time.Hour)); !inc.Start.Before(from) && i < len(s.Days) {
+			s.Days[i].Incident = true
+		}
+	}
+	sort.SliceStable(p.Incidents, func(i, j int) bool { return p.Incidents[i].Start.After(p.Incidents[j].Start) })
+
+	// group sites, keeping the order in which groups first appear and showing sites without group last
+	groups := make(map[string]*group)
+	var ungrouped *group
+	for _, s := range ordered {
+		g, ok := groups[s.Group]
+		if !ok {
+			g = &group{Name: s.Group, Status: StatusUnknown}
+			groups[s.Group] = g
+			if s.Group == "" {
+				ungrouped = g
+			} else {
+				p.Groups = append(p.Groups, g)
+			}
+		}
+		g.Sites = append(g.Sites, s)
+		if severity[s.Status] > severity[g.Status] {
+			g.Status = s.Status
+		}
+		if severity[s.Status] > severity[p.Status] {
+			p.Status = s.Status
+		}
+	}
+	if ungrouped != nil {
+		p.Groups = append(p.Groups, ungrouped)
+	}
+	return p, nil
+}
+
+// incidentsOf returns the incidents of `sites` which were ongoing or resolved since `from`, sorted by start time
+// incidents left open when the monitor was stopped have no resolution, they end once sites are probed up again
+func incidentsOf(store *storage.Store, sites map[string]*siteStatus, opts Options, from, now time.Time) ([]*Incident, error) {
+	var urls []string
+	for url := range sites {
+		urls = append(urls, url)
+	}
+	// incidents open when the shown days start began with the last event of their alert before them
+	events, err := store.Events(from, now)
+	if err != nil {
+		return nil, err
+	}
+	alerts := []string{"availability", "latency", "flapping"}
+	for _, rule := range opts.Rules {
+		alerts = append(alerts, "rule:"+rule)
+	}
+	seen := make(map[string]bool)
+	for _, alert := range alerts {
+		seen[alert] = true
+	}
+	for _, e := range events {
+		if !seen[e.Alert] {
+			seen[e.Alert] = true
+			alerts = append(alerts, e.Alert)
+		}
+	}
+	var before []*metrics.Event
+	for _, alert := range alerts {
+		last, err := store.LastEvents(from, alert, urls)
+		if err != nil {
+			return nil, err
+		}
+		before = append(before, last...)
+	}
+	sort.SliceStable(before, func(i, j int) bool { return before[i].Time.Before(before[j].Time) })
+	events = append(before, events...)
+
+	resumed := make(map[string][]storage.Resumption)
+	for _, inc := range pair(events, sites, nil) {
+		end := inc.End
+		if inc.Ongoing() {
+			end = now
+		}
+		rs, err := store.Resumptions(inc.Url, inc.Start, end)
+		if err != nil {
+			return nil, err
+		}
+		key := inc.Url + " " + inc.Alert
+		resumed[key] = append(resumed[key], rs...)
+	}
+	return pair(events, sites, resumed), nil
+}
+
+// pair pairs the start and resolution events of the alerts of `sites` into incidents, sorted by start time
+// an incident with no resolution ends once its site was probed up after a resumption of its reports with no event
+// of its alert since, from `resumed` by url and alert
+func pair(events []*metrics.Event, sites map[string]*siteStatus, resumed map[string][]storage.Resumption) []*Incident {
+	var incidents []*Incident
+	open := make(map[string]*Incident)
+	last := make(map[string]time.Time) // time of the last event of each url and alert
+	// recovered ends the incident of `key` if it was probed up after a resumption with no event since, before `next` (unbounded if zero)
+	recovered := func(key string, next time.Time) {
+		inc, isOpen := open[key]
+		if !isOpen {
+			return
+		}
+		for _, r := range resumed[key] {
+			if r.At.After(last[key]) && (next.IsZero() || r.Up.Before(next)) {
+				inc.End = r.Up
+				delete(open, key)
+				return
+			}
+		}
+	}
+
+	for _, e := range events {
+		s, ok := sites[e.Url]
+		if !ok {
+			continue
+		}
+		key := e.Url + " " + e.Alert
+		recovered(key, e.Time)
+		last[key] = e.Time
+		inc, isOpen := open[key]
+		switch {
+		case !e.Resolved && !isOpen:
+			inc = &Incident{Url: e.Url, Name: s.Name, Alert: e.Alert, Severity: e.Severity, Message: e.Message, Start: e.Time}
+			open[key] = inc
+			incidents = append(incidents, inc)
+		case e.Resolved && isOpen:
+			inc.End = e.Time
+			delete(open, key)
+		}
+	}
+	for key := range open {
+		recovered(key, time.Time{})
+	}
+	return incidents
+}
@@ -0,0 +1,104 @@
+package statuspage
+
+import (
+	"fmt"
+	"html/template"
+	"time"
+)
+
+// pageTemplate renders the self-contained status page (no external dependency)
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"percent": percent,
+	"level":   level,
+	"date":    func(t time.Time) string { return t.UTC().Format("Jan 2, 2006") },
+	"time":    func(t time.Time) string { return t.UTC().Format("Jan 2, 2006 15:04 UTC") },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<link rel="alternate" type="application/atom+xml" title="{{.Title}} incidents" href="feed.atom">
+<link rel="alternate" type="application/rss+xml" title="{{.Title}} incidents" href="feed.rss">
+<style>
+  body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; max-width: 60em; margin: 0 auto; padding: 1em; }
+  h1 { margin-bottom: .2em; }
+  .banner { padding: 1em; border-radius: 4px; color: #fff; font-weight: bold; margin: 1em 0; }
+  .operational { background: #2ecc71; } .degraded { background: #f39c12; } .down { background: #e74c3c; } .unknown { background: #95a5a6; }
+  .group { border: 1px solid #ddd; border-radius: 4px; margin: 1em 0; }
+  .group > h2 { font-size: 1.1em; margin: 0; padding: .6em 1em; border-bottom: 1px solid #ddd; display: flex; justify-content: space-between; }
+  .site { padding: .8em 1em; border-bottom: 1px solid #eee; }
+  .site:last-child { border-bottom: none; }
+  .site-header { display: flex; justify-content: space-between; }
+  .status { font-size: .85em; padding: .1em .5em; border-radius: 3px; color: #fff; }
+  .bars { display: flex; gap: 2px; margin: .5em 0 .2em 0; height: 2em; }
+  .bars span { flex: 1; border-radius: 1px; }
+  .bars .l0 { background: #2ecc71; } .bars .l1 { background: #a3d977; } .bars .l2 { background: #f39c12; } .bars .l3 { background: #e74c3c; } .bars .none { background: #ddd; }
+  .legend { display: flex; justify-content: space-between; color: #888; font-size: .8em; }
+  .incident { border-left: 3px solid #ddd; padding: .2em 1em; margin: 1em 0; }
+  .incident.ongoing { border-color: #e74c3c; }
+  .incident p { margin: .3em 0; color: #555; }
+  footer { color: #888; font-size: .8em; margin-top: 2em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="banner {{.Status}}">
+  {{if eq .Status "operational"}}All systems operational{{else if eq .Status "down"}}Major outage{{else if eq .Status "degraded"}}Degraded performance{{else}}No data{{end}}
+</div>
+{{range .Groups}}
+<div class="group">
+  {{if .Name}}<h2>{{.Name}} <span class="status {{.Status}}">{{.Status}}</span></h2>{{end}}
+  {{range .Sites}}
+  <div class="site">
+    <div class="site-header">
+      <strong title="{{.Url}}">{{.Name}}</strong>
+      <span class="status {{.Status}}">{{.Status}}</span>
+    </div>
+    <div class="bars">
+      {{range .Days}}<span class="{{level .Uptime}}" title="{{date .Day}}: {{if ge .Uptime 0.0}}{{percent .Uptime}} uptime{{else}}no data{{end}}{{if .Incident}}, incident{{end}}"></span>{{end}}
+    </div>
+    <div class="legend">
+      <span>{{len .Days}} days ago</span>
+      <span>{{if ge .Uptime 0.0}}{{percent .Uptime}} uptime{{else}}no data{{end}}</span>
+      <span>today</span>
+    </div>
+  </div>
+  {{end}}
+</div>
+{{end}}
+<h2>Incidents</h2>
+{{range .Incidents}}
+<div class="incident{{if .Ongoing}} ongoing{{end}}">
+  <strong>{{.Title}}</strong>
+  <p>{{.Message}}</p>
+  <p>{{time .Start}}{{if .Ongoing}} - ongoing{{else}} - {{time .End}}{{end}} ({{.Duration $.Generated}})</p>
+</div>
+{{else}}
+<p>No incidents in the past {{.Days}} days.</p>
+{{end}}
+<footer>Generated {{time .Generated}} - <a href="feed.atom">Atom</a> - <a href="feed.rss">RSS</a></footer>
+</body>
+</html>
+`))
+
+// percent formats an uptime ratio
+func percent(uptime float64) string {
+	return fmt.Sprintf("%.2f%%", uptime*100)
+}
+
+// level returns the CSS class of an uptime bar
+func level(uptime float64) string {
+	switch {
+	case uptime < 0:
+		return "none"
+	case uptime >= 0.999:
+		return "l0"
+	case uptime >= 0.99:
+		return "l1"
+	case uptime >= 0.95:
+		return "l2"
+	default:
+		return "l3"
+	}
+}
@@ -0,0 +1,471 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+)
+
+// Tier is a resolution stored reports are rolled up at
+type Tier struct {
+	Name   string
+	Step   time.Duration
+	prefix string // prefix of the daily rollups files of the tier
+}
+
+// Tiers are the resolutions of rollups, from the finest to the coarsest
+var Tiers = []Tier{
+	{"minute", time.Minute, "rollups-minute-"},
+	{"hour", time.Hour, "rollups-hour-"},
+	{"day", 24 * time.Hour, "rollups-day-"},
+}
+
+// compactionDelay is how long after the end of a day its reports are rolled up, so that late reports are stored first
+const compactionDelay = time.Hour
+
+// LatencyBuckets are the upper bounds (in milliseconds) of the latency histograms of rollups,
+// histograms have an extra bucket counting the latencies above the last bound
+var LatencyBuckets = []float64{50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Rollup aggregates the reports of a website over a period of a tier
+// latencies are the total durations of the requests which didn't fail
+type Rollup struct {
+	Url            string          `json:"url"`
+	Time           time.Time       `json:"time"` // start of the period (UTC)
+	Step           config.Duration `json:"step"` // length of the period
+	Count          int             `json:"count"`
+	Successes      int             `json:"successes"` // reports with a 200 status code
+	Latencies      int             `json:"latencies"` // number of latencies in `LatencySum` and `Buckets`
+	LatencySum     float64         `json:"latency_sum_ms"`
+	LatencyMin     float64         `json:"latency_min_ms"`
+	LatencyMax     float64         `json:"latency_max_ms"`
+	Buckets        []int           `json:"buckets"` // count of latencies by bucket of LatencyBuckets
+	StatusCodes    map[int]int     `json:"status_codes"`
+	Last           time.Time       `json:"last"` // time of the last report
+	LastStatusCode int             `json:"last_status_code"`
+
+	// longest polling interval of the reports, to tell gaps in reports (e.g. while the monitor was stopped)
+	// from ones between probes, 0 in rollups stored before it was recorded
+	PollingInterval config.Duration `json:"polling_interval,omitempty"`
+}
+
+// NewRollup inits an empty rollup of `url` over the period of `step` starting at `start`
+func NewRollup(url string, start time.Time, step time.Duration) *Rollup {
+	return &Rollup{Url: url, Time: start, Step: config.Duration(step), Buckets: make([]int, len(LatencyBuckets)+1),
+		StatusCodes: make(map[int]int)}
+}
+
+// add counts a report in the rollup
+func (r *Rollup) add(record *metrics.Record) {
+	r.Count++
+	r.StatusCodes[record.Report.StatusCode]++
+	if record.Report.StatusCode == 200 {
+		r.Successes++
+	}
+	if d := record.Report.TotalDuration; d != -1 {
+		ms := milliseconds(d)
+		if r.Latencies == 0 || ms < r.LatencyMin {
+			r.LatencyMin = ms
+		}
+		if ms > r.LatencyMax {
+			r.LatencyMax = ms
+		}
+		r.Latencies++
+		r.LatencySum += ms
+		r.Buckets[sort.SearchFloat64s(LatencyBuckets, ms)]++
+	}
+	if !record.Time.Before(r.Last) {
+		r.Last, r.LastStatusCode = record.Time, record.Report.StatusCode
+	}
+	if interval := config.Duration(record.Report.PollingInterval); interval > r.PollingInterval {
+		r.PollingInterval = interval
+	}
+}
+
+// Merge adds the counts of `other` to the rollup
+func (r *Rollup) Merge(other *Rollup) {
+	r.Count += other.Count
+	r.Successes += other.Successes
+	if other.Latencies > 0 {
+		if r.Latencies == 0 || other.LatencyMin < r.LatencyMin {
+			r.LatencyMin = other.LatencyMin
+		}
+		if other.LatencyMax > r.LatencyMax {
+			r.LatencyMax = other.LatencyMax
+		}
+	}
+	r.Latencies += other.Latencies
+	r.LatencySum += other.LatencySum
+	for i := 0; i < len(r.Buckets) && i < len(other.Buckets); i++ {
+		r.Buckets[i] += other.Buckets[i]
+	}
+	for code, count := range other.StatusCodes {
+		r.StatusCodes[code] += count
+	}
+	if !other.Last.Before(r.Last) {
+		r.Last, r.LastStatusCode = other.Last, other.LastStatusCode
+	}
+	if other.PollingInterval > r.PollingInterval {
+		r.PollingInterval = other.PollingInterval
+	}
+}
+
+// Uptime returns the ratio of successful reports, or -1 without reports
+func (r *Rollup) Uptime() float64 {
+	if r.Count == 0 {
+		return -1
+	}
+	return float64(r.Successes) / float64(r.Count)
+}
+
+// AvgLatency returns the average latency, or -1 without latencies
+func (r *Rollup) AvgLatency() time.Duration {
+	if r.Latencies == 0 {
+		return -1
+	}
+	return duration(r.LatencySum / float64(r.Latencies))
+}
+
+// Percentile estimates the `p` percentile (between 0 and 100) of latencies as the upper bound of its histogram bucket
+// (the max latency for the last bucket), or returns -1 without latencies
+func (r *Rollup) Percentile(p float64) time.Duration {
+	if r.Latencies == 0 {
+		return -1
+	}
+	rank, seen := p/100*float64(r.Latencies), 0
+	for i, count := range r.Buckets {
+		seen += count
+		if float64(seen) >= rank && count > 0 {
+			if i < len(LatencyBuckets) && LatencyBuckets[i] < r.LatencyMax {
+				return duration(LatencyBuckets[i])
+			}
+			break
+		}
+	}
+	return duration(r.LatencyMax)
+}
+
+// rollups aggregates rollups and reports by website and period
+type rollups struct {
+	step    time.Duration
+	byStart map[string]map[int64]*Rollup // by url and start of period (unix nanoseconds)
+}
+
+func newRollups(step time.Duration) *rollups {
+	return &rollups{step: step, byStart: make(map[string]map[int64]*Rollup)}
+}
+
+// get returns the rollup of `url` over the period of `step` containing `t`
+func (rs *rollups) get(url string, t time.Time, step time.Duration) *Rollup {
+	start := t.UTC().Truncate(step)
+	if rs.byStart[url] == nil {
+		rs.byStart[url] = make(map[int64]*Rollup)
+	}
+	r, ok := rs.byStart[url][start.UnixNano()]
+	if !ok {
+		r = NewRollup(url, start, step)
+		rs.byStart[url][start.UnixNano()] = r
+	}
+	return r
+}
+
+func (rs *rollups) add(record *metrics.Record) {
+	rs.get(record.Report.Url, record.Time, rs.step).add(record)
+}
+
+// merge merges a rollup, rollups coarser than `rs.step` keep their step
+func (rs *rollups) merge(r *Rollup) {
+	step := rs.step
+	if time.Duration(r.Step) > step {
+		step = time.Duration(r.Step)
+	}
+	rs.get(r.Url, r.Time, step).Merge(r)
+}
+
+// sorted returns the rollups sorted by time and url
+func (rs *rollups) sorted() []*Rollup {
+	var sorted []*Rollup
+	for _, byStart := range rs.byStart {
+		for _, r := range byStart {
+			sorted = append(sorted, r)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].Time.Equal(sorted[j].Time) {
+			return sorted[i].Time.Before(sorted[j].Time)
+		}
+		return sorted[i].Url < sorted[j].Url
+	})
+	return sorted
+}
+
+// Compact rolls up the reports of each day into per-minute, per-hour and per-day rollups once the day is over,
+// then deletes the files older than the retention of their tier (raw reports of a day are only deleted once rolled up)
+// it's idempotent, and meant to be called periodically
+func (s *Store) Compact(now time.Time, retention config.Retention) error {
+	s.compacting.Lock()
+	defer s.compacting.Unlock()
+	err := s.compact(now, retention)
+	if err != nil {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Store) compact(now time.Time, retention config.Retention) error {
+	s.removeTemporaryFiles()
+	days, err := s.days(reportsPrefix, time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if now.Before(day.Add(24*time.Hour+compactionDelay)) || s.rolledUp(day) {
+			continue
+		}
+		if err := s.rollUp(day); err != nil {
+			return fmt.Errorf("rolling up reports of %s: %v", day.Format(dayLayout), err)
+		}
+	}
+
+	retentions := map[string]time.Duration{reportsPrefix: retention.Raw}
+	for _, tier := range Tiers {
+		retentions[tier.prefix] = map[string]time.Duration{"minute": retention.Minute, "hour": retention.Hour, "day": retention.Day}[tier.Name]
+	}
+	for prefix, keep := range retentions {
+		if keep == 0 {
+			continue
+		}
+		days, err := s.days(prefix, time.Time{}, time.Time{})
+		if err != nil {
+			return err
+		}
+		for _, day := range days {
+			if !day.Add(24*time.Hour).Before(now.Add(-keep)) || (prefix == reportsPrefix && !s.rolledUp(day)) {
+				continue
+			}
+			if err := os.Remove(s.path(prefix, day)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rolledUp returns whether the reports of `day` are rolled up, the per-day rollups being written last
+func (s *Store) rolledUp(day time.Time) bool {
+	_, err := os.Stat(s.path(Tiers[len(Tiers)-1].prefix, day))
+	return err == nil
+}
+
+// rollUp writes the rollups of every tier of the reports of `day`, each tier being rolled up from the previous one
+func (s *Store) rollUp(day time.Time) error {
+	finer := newRollups(Tiers[0].Step)
+	err := s.scanFile(s.path(reportsPrefix, day), func(line []byte) error {
+		if record := decodeReport(line); record != nil {
+			finer.add(record)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, tier := range Tiers {
+		if i > 0 {
+			coarser := newRollups(tier.Step)
+			for _, r := range finer.sorted() {
+				coarser.merge(r)
+			}
+			finer = coarser
+		}
+		if err := s.writeRollups(tier.prefix, day, finer.sorted()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRollups writes the rollups file of `prefix` for `day`, atomically so that readers never see a partial file
+func (s *Store) writeRollups(prefix string, day time.Time, rollups []*Rollup) error {
+	f, err := ioutil.TempFile(s.dir, ".tmp-"+prefix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	encoder := json.NewEncoder(f)
+	for _, r := range rollups {
+		if err = encoder.Encode(r); err != nil {
+			break
+		}
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(prefix, day))
+}
+
+// Resolution returns the step of rollups suited to the range between `from` and `to`:
+// a minute up to 6 hours, an hour up to 7 days and a day beyond (or if `from` is unbounded)
+func Resolution(from, to time.Time) time.Duration {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	switch span := to.Sub(from); {
+	case from.IsZero():
+		return 24 * time.Hour
+	case span <= 6*time.Hour:
+		return time.Minute
+	case span <= 7*24*time.Hour:
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Rollups calls `fn` with the rollups by `step` (a minute, an hour or a day, 0 picks it with Resolution) of the stored
+// reports over periods overlapping `from` and `to` (zero times are unbounded), sorted by time and url
+// each day is read from the coarsest tier at least as fine as `step`, or else from raw reports (e.g. those of today),
+// or else from the finest coarser tier still kept, whose rollups keep their step
+// it stops at the first error returned by `fn`
+func (s *Store) Rollups(from, to time.Time, step time.Duration, fn func(*Rollup) error) error {
+	if step == 0 {
+		step = Resolution(from, to)
+	}
+	// sources of each day by order of preference, a tier or raw reports (nil)
+	var sources []*Tier
+	for i := len(Tiers) - 1; i >= 0; i-- {
+		if Tiers[i].Step <= step {
+			sources = append(sources, &Tiers[i])
+		}
+	}
+	if len(sources) == 0 || sources[0].Step != step {
+		return fmt.Errorf("invalid rollups step %v, expected a minute, an hour or a day", step)
+	}
+	sources = append(sources, nil)
+	for i := range Tiers {
+		if Tiers[i].Step > step {
+			sources = append(sources, &Tiers[i])
+		}
+	}
+
+	// days stored by each source
+	stored := make(map[*Tier]map[int64]bool)
+	var days []time.Time
+	seen := make(map[int64]bool)
+	for _, source := range sources {
+		prefix := reportsPrefix
+		if source != nil {
+			prefix = source.prefix
+		}
+		sourceDays, err := s.days(prefix, from, to)
+		if err != nil {
+			return err
+		}
+		stored[source] = make(map[int64]bool)
+		for _, day := range sourceDays {
+			stored[source][day.Unix()] = true
+			if !seen[day.Unix()] {
+				seen[day.Unix()] = true
+				days = append(days, day)
+			}
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+
+	for _, day := range days {
+		var source *Tier
+		for _, source = range sources {
+			if stored[source][day.Unix()] {
+				break
+			}
+		}
+		rs := newRollups(step)
+		var err error
+		if source == nil {
+			err = s.scanFile(s.path(reportsPrefix, day), func(line []byte) error {
+				if record := decodeReport(line); record != nil && within(record.Time, from, to) {
+					rs.add(record)
+				}
+				return nil
+			})
+		} else {
+			err = s.scanFile(s.path(source.prefix, day), func(line []byte) error {
+				var r Rollup
+				if json.Unmarshal(line, &r) == nil && overlaps(&r, from, to) {
+					rs.merge(&r)
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			return err
+		}
+		for _, r := range rs.sorted() {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Resumption is when a website was probed again after a gap in its reports (e.g. while the monitor was stopped),
+// and when it was first probed up since
+type Resumption struct {
+	At, Up time.Time
+}
+
+// Resumptions returns the resumptions of the reports of `url` between `from` and `to` which were followed by a
+// successful probe, read from minute rollups: there's a gap when no report was stored for twice the polling interval
+func (s *Store) Resumptions(url string, from, to time.Time) ([]Resumption, error) {
+	var (
+		rs       []Resumption
+		previous *Rollup
+		pending  *Resumption
+	)
+	err := s.Rollups(from, to, time.Minute, func(r *Rollup) error {
+		if r.Url != url {
+			return nil
+		}
+		if previous != nil {
+			interval := previous.PollingInterval
+			if r.PollingInterval > interval {
+				interval = r.PollingInterval
+			}
+			if interval > 0 && r.Time.Sub(previous.Last) > 2*time.Duration(interval) {
+				pending = &Resumption{At: r.Time}
+			}
+		}
+		if pending != nil && r.Successes > 0 {
+			pending.Up = r.Time
+			rs = append(rs, *pending)
+			pending = nil
+		}
+		previous = r
+		return nil
+	})
+	return rs, err
+}
+
+// overlaps returns whether the period of `r` overlaps `from` and `to`, zero times being unbounded
+func overlaps(r *Rollup, from, to time.Time) bool {
+	return (from.IsZero() || r.Time.Add(time.Duration(r.Step)).After(from)) && (to.IsZero() || !r.Time.After(to))
+}
+
+// removeTemporaryFiles removes the temporary files left by interrupted rollups
+func (s *Store) removeTemporaryFiles() {
+	matches, _ := filepath.Glob(filepath.Join(s.dir, ".tmp-*"))
+	for _, match := range matches {
+		os.Remove(match)
+	}
+}
@@ -0,0 +1,304 @@
+// Package storage persists reports and alert events on disk, so that they outlive the monitoring process
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+)
+
+const (
+	reportsPrefix = "reports-"   // prefix of daily reports files
+	eventsPrefix  = "events-"    // prefix of daily alert events files
+	dayLayout     = "2006-01-02" // layout of days in file names (UTC)
+	fileExt       = ".ndjson"
+)
+
+// Store appends reports and alert events of all websites to daily newline-delimited JSON files in its directory,
+// and rolls reports up once their day is over (see Compact):
+//
+//	reports-2006-01-02.ndjson           reports of the day (UTC)
+//	events-2006-01-02.ndjson            alert events of the day (UTC)
+//	rollups-minute-2006-01-02.ndjson    per-minute rollups of the reports of the day, see Rollup
+//	rollups-hour-2006-01-02.ndjson      per-hour rollups
+//	rollups-day-2006-01-02.ndjson       per-day rollups
+//
+// it's safe for concurrent use
+type Store struct {
+	dir        string
+	mu         sync.Mutex
+	err        error      // last write error
+	compacting sync.Mutex // serializes compactions
+}
+
+// Open inits a Store in `dir`, creating it if needed
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+// report is the stored form of a report
+type report struct {
+	Time              time.Time          `json:"time"`
+	Url               string             `json:"url"`
+	PollingInterval   config.Duration    `json:"polling_interval"`
+	StatusCode        int                `json:"status_code"`
+	ConnectDuration   float64            `json:"connect_ms"` // -1 when the request failed
+	FirstByteDuration float64            `json:"first_byte_ms"`
+	TotalDuration     float64            `json:"total_ms"`
+	Error             string             `json:"error,omitempty"`
+	Warning           string             `json:"warning,omitempty"`
+	Protocol          string             `json:"protocol,omitempty"`
+	Details           map[string]string  `json:"details,omitempty"` // protocol-specific fields
+	Metrics           map[string]float64 `json:"metrics,omitempty"`
+}
+
+// AppendReport stores a processed report
+func (s *Store) AppendReport(record *metrics.Record) error {
+	r := record.Report
+	return s.append(reportsPrefix, record.Time, &report{
+		Time:              record.Time,
+		Url:               r.Url,
+		PollingInterval:   config.Duration(r.PollingInterval),
+		StatusCode:        r.StatusCode,
+		ConnectDuration:   milliseconds(r.ConnectDuration),
+		FirstByteDuration: milliseconds(r.FirstByteDuration),
+		TotalDuration:     milliseconds(r.TotalDuration),
+		Error:             r.Error,
+		Warning:           r.Warning,
+		Protocol:          r.Protocol,
+		Details:           r.Details,
+		Metrics:           r.Metrics,
+	})
+}
+
+// AppendEvent stores an alert transition
+func (s *Store) AppendEvent(e *metrics.Event) error {
+	return s.append(eventsPrefix, e.Time, e)
+}
+
+// append writes `v` as a JSON line to the file of `prefix` for the day of `t`
+func (s *Store) append(prefix string, t time.Time, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path(prefix, t), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		s.err = err
+	}
+	return err
+}
+
+// LastError returns the last error that occurred while writing to the store, if any
+func (s *Store) LastError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Reports calls `fn` with the stored reports between `from` and `to` (zero times are unbounded), in the order they were stored
+// it stops at the first error returned by `fn`
+func (s *Store) Reports(from, to time.Time, fn func(*metrics.Record) error) error {
+	return s.scan(reportsPrefix, from, to, func(line []byte) error {
+		record := decodeReport(line)
+		if record == nil || !within(record.Time, from, to) {
+			return nil
+		}
+		return fn(record)
+	})
+}
+
+// ReadReports calls `fn` with the reports of `r`, a newline-delimited JSON log in the format of stored reports
+// (e.g. a copy of a daily reports file), skipping lines which can't be decoded
+// it stops at the first error returned by `fn`
+func ReadReports(r io.Reader, fn func(*metrics.Record) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if record := decodeReport(scanner.Bytes()); record != nil {
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// decodeReport decodes a stored report, or returns nil if `line` can't be decoded
+func decodeReport(line []byte) *metrics.Record {
+	var r report
+	if json.Unmarshal(line, &r) != nil {
+		return nil
+	}
+	return &metrics.Record{Time: r.Time, Report: &inspect.Report{
+		Url:               r.Url,
+		PollingInterval:   time.Duration(r.PollingInterval),
+		Time:              r.Time,
+		StatusCode:        r.StatusCode,
+		ConnectDuration:   duration(r.ConnectDuration),
+		FirstByteDuration: duration(r.FirstByteDuration),
+		TotalDuration:     duration(r.TotalDuration),
+		Error:             r.Error,
+		Warning:           r.Warning,
+		Protocol:          r.Protocol,
+		Details:           r.Details,
+		Metrics:           r.Metrics,
+	}}
+}
+
+// Events returns the stored alert transitions between `from` and `to` (zero times are unbounded), sorted by time
+func (s *Store) Events(from, to time.Time) ([]*metrics.Event, error) {
+	var events []*metrics.Event
+	err := s.scan(eventsPrefix, from, to, func(line []byte) error {
+		var e metrics.Event
+		if json.Unmarshal(line, &e) != nil || !within(e.Time, from, to) {
+			return nil
+		}
+		events = append(events, &e)
+		return nil
+	})
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, err
+}
+
+// LastEvents returns the last stored transition of `alert` before `t` of each of `urls` which has one, sorted by time
+// days are read backwards from `t` until every url has one, so that only the history needed is read
+func (s *Store) LastEvents(t time.Time, alert string, urls []string) ([]*metrics.Event, error) {
+	wanted := make(map[string]bool)
+	for _, url := range urls {
+		wanted[url] = true
+	}
+	days, err := s.days(eventsPrefix, time.Time{}, t)
+	if err != nil {
+		return nil, err
+	}
+	last := make(map[string]*metrics.Event)
+	for i := len(days) - 1; i >= 0 && len(last) < len(wanted); i-- {
+		ofDay := make(map[string]*metrics.Event)
+		err := s.scanFile(s.path(eventsPrefix, days[i]), func(line []byte) error {
+			var e metrics.Event
+			if json.Unmarshal(line, &e) != nil || e.Alert != alert || !wanted[e.Url] || last[e.Url] != nil || !e.Time.Before(t) {
+				return nil
+			}
+			if previous := ofDay[e.Url]; previous == nil || !e.Time.Before(previous.Time) {
+				ofDay[e.Url] = &e
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for url, e := range ofDay {
+			last[url] = e
+		}
+	}
+	var events []*metrics.Event
+	for _, e := range last {
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, nil
+}
+
+// scan calls `fn` with each line of the files of `prefix` whose day is between `from` and `to`
+// * note `fn` skips lines which can't be decoded (e.g. truncated by a crash)
+func (s *Store) scan(prefix string, from, to time.Time, fn func(line []byte) error) error {
+	days, err := s.days(prefix, from, to)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if err := s.scanFile(s.path(prefix, day), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanFile calls `fn` with each line of the file at `path`
+func (s *Store) scanFile(path string, fn func(line []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// days returns the sorted days of the files of `prefix` which may hold entries between `from` and `to`
+func (s *Store) days(prefix string, from, to time.Time) ([]time.Time, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var days []time.Time
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, prefix) || filepath.Ext(name) != fileExt {
+			continue
+		}
+		day, err := time.Parse(dayLayout, strings.TrimSuffix(strings.TrimPrefix(name, prefix), fileExt))
+		if err != nil {
+			continue
+		}
+		if (!from.IsZero() && day.Add(24*time.Hour).Before(from)) || (!to.IsZero() && day.After(to)) {
+			continue
+		}
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+// path returns the path of the file of `prefix` for the day of `t`
+func (s *Store) path(prefix string, t time.Time) string {
+	return filepath.Join(s.dir, prefix+t.UTC().Format(dayLayout)+fileExt)
+}
+
+// within returns whether `t` is between `from` and `to`, zero times being unbounded
+func within(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+}
+
+// milliseconds converts a duration to milliseconds, keeping -1 for failed requests
+func milliseconds(d time.Duration) float64 {
+	if d == -1 {
+		return -1
+	}
+	return float64(d) / float64(time.Millisecond)
+}
+
+// duration converts milliseconds back to a duration, keeping -1 for failed requests
+func duration(ms float64) time.Duration {
+	if ms == -1 {
+		return -1
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
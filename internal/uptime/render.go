@@ -0,0 +1,224 @@
+package uptime
+
+import (
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"math"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{"markdown", "html", "json"}
+
+// Render writes the report in `format` to `w`
+func Render(w io.Writer, r *Report, format string) error {
+	switch format {
+	case "markdown":
+		return markdownTemplate.Execute(w, r)
+	case "html":
+		return htmlTemplate.Execute(w, r)
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(jsonReportOf(r))
+	}
+	return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// funcs are the template functions shared by the Markdown and HTML reports
+var funcs = map[string]interface{}{
+	"percent":  percent,
+	"duration": formatDuration,
+	"latency":  formatLatency,
+	"date":     func(t time.Time) string { return t.UTC().Format("Jan 2, 2006") },
+	"time":     func(t time.Time) string { return t.UTC().Format("Jan 2, 2006 15:04 UTC") },
+	"last":     func(t time.Time) time.Time { return t.Add(-time.Nanosecond) }, // last instant of a period
+	"cell":     func(s string) string { return strings.ReplaceAll(s, "|", `\|`) },
+}
+
+// markdownTemplate renders the report as Markdown tables, e.g. to be pasted in an issue or a wiki
+var markdownTemplate = template.Must(template.New("markdown").Funcs(funcs).Parse(`# Uptime report {{.Name}}
+
+{{date .From}} – {{date (last .To)}} (UTC){{if .Partial}}, so far{{end}}. Generated {{time .Generated}}.
+
+| Site | Uptime | Incidents | Downtime | MTTR | MTBF | Longest outage | Avg latency | p95 latency | Max latency |
+| --- | ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: | ---: |
+{{range .Sites}}| {{cell .Name}} | {{percent ($.Uptime .)}} | {{len .Outages}} | {{duration .Downtime}} | {{duration .MTTR}} | {{duration ($.MTBF .)}} | {{duration .LongestOutage}} | {{with .Latency}}{{latency .Avg}} | {{latency .P95}} | {{latency .Max}}{{else}}- | - | -{{end}} |
+{{end}}
+## Incidents
+{{if .Incidents}}{{range .Sites}}{{if .Outages}}
+### {{.Name}}
+
+| Start | End | Duration | Message |
+| --- | --- | ---: | --- |
+{{range .Outages}}| {{time .Start}} | {{if .Ongoing}}ongoing{{else}}{{time .End}}{{end}} | {{duration .Duration}} | {{cell .Message}} |
+{{end}}{{end}}{{end}}{{else}}
+No incidents.
+{{end}}`))
+
+// htmlTemplate renders the report as a self-contained HTML page (no external dependency)
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap(funcs)).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Uptime report {{.Name}}</title>
+<style>
+  body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; max-width: 70em; margin: 0 auto; padding: 1em; }
+  h1 { margin-bottom: .2em; }
+  .period { color: #555; }
+  table { border-collapse: collapse; width: 100%; margin: 1em 0; }
+  th, td { padding: .4em .6em; border-bottom: 1px solid #eee; text-align: right; }
+  th:first-child, td:first-child { text-align: left; }
+  th { border-bottom: 1px solid #ccc; }
+  td.message { text-align: left; color: #555; }
+  .ongoing { color: #e74c3c; font-weight: bold; }
+  footer { color: #888; font-size: .8em; margin-top: 2em; }
+</style>
+</head>
+<body>
+<h1>Uptime report {{.Name}}</h1>
+<p class="period">{{date .From}} – {{date (last .To)}} (UTC){{if .Partial}}, so far{{end}}</p>
+<table>
+  <tr><th>Site</th><th>Uptime</th><th>Incidents</th><th>Downtime</th><th>MTTR</th><th>MTBF</th><th>Longest outage</th><th>Avg latency</th><th>p95 latency</th><th>Max latency</th></tr>
+  {{range .Sites}}
+  <tr>
+    <td title="{{.Url}}">{{.Name}}</td><td>{{percent ($.Uptime .)}}</td><td>{{len .Outages}}</td><td>{{duration .Downtime}}</td>
+    <td>{{duration .MTTR}}</td><td>{{duration ($.MTBF .)}}</td><td>{{duration .LongestOutage}}</td>
+    {{with .Latency}}<td>{{latency .Avg}}</td><td>{{latency .P95}}</td><td>{{latency .Max}}</td>{{else}}<td>-</td><td>-</td><td>-</td>{{end}}
+  </tr>
+  {{end}}
+</table>
+<h2>Incidents</h2>
+{{if .Incidents}}{{range .Sites}}{{if .Outages}}
+<h3 title="{{.Url}}">{{.Name}}</h3>
+<table>
+  <tr><th>Start</th><th>End</th><th>Duration</th><th>Message</th></tr>
+  {{range .Outages}}
+  <tr>
+    <td>{{time .Start}}</td><td>{{if .Ongoing}}<span class="ongoing">ongoing</span>{{else}}{{time .End}}{{end}}</td>
+    <td>{{duration .Duration}}</td><td class="message">{{.Message}}</td>
+  </tr>
+  {{end}}
+</table>
+{{end}}{{end}}{{else}}
+<p>No incidents.</p>
+{{end}}
+<footer>Generated {{time .Generated}}</footer>
+</body>
+</html>
+`))
+
+// percent formats an uptime ratio, truncated rather than rounded so that uptime is never overstated
+func percent(uptime float64) string {
+	if uptime < 0 {
+		return "no data"
+	}
+	return fmt.Sprintf("%.2f%%", math.Floor(uptime*10000)/100)
+}
+
+// formatDuration formats a duration with its two most significant units, e.g. 2d 3h or 5m 30s, and - for -1
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		return "-"
+	}
+	d = d.Round(time.Second)
+	units := []struct {
+		unit   time.Duration
+		suffix string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}}
+	for i, u := range units {
+		if d < u.unit {
+			continue
+		}
+		s := fmt.Sprintf("%d%s", d/u.unit, u.suffix)
+		if i+1 < len(units) {
+			if rest := d % u.unit / units[i+1].unit; rest > 0 {
+				s += fmt.Sprintf(" %d%s", rest, units[i+1].suffix)
+			}
+		}
+		return s
+	}
+	return "0s"
+}
+
+// formatLatency formats a latency to the millisecond
+func formatLatency(d time.Duration) string {
+	return d.Round(time.Millisecond).String()
+}
+
+// jsonReport is the JSON representation of a report, with durations in seconds and latencies in milliseconds,
+// metrics which are undefined (e.g. MTTR without outages) being null
+type jsonReport struct {
+	Period    string     `json:"period"`
+	From      time.Time  `json:"from"`
+	To        time.Time  `json:"to"`
+	Generated time.Time  `json:"generated"`
+	Partial   bool       `json:"partial"`
+	Observed  float64    `json:"observed_s"`
+	Sites     []jsonSite `json:"sites"`
+}
+
+type jsonSite struct {
+	Name          string       `json:"name"`
+	Url           string       `json:"url"`
+	Probes        int          `json:"probes"`
+	Up            int          `json:"up"`
+	Uptime        *float64     `json:"uptime"`
+	Observed      float64      `json:"observed_s"`
+	Incidents     int          `json:"incidents"`
+	Downtime      float64      `json:"downtime_s"`
+	MTTR          *float64     `json:"mttr_s"`
+	MTBF          *float64     `json:"mtbf_s"`
+	LongestOutage float64      `json:"longest_outage_s"`
+	Latency       *jsonLatency `json:"latency_ms"`
+	Outages       []jsonOutage `json:"outages"`
+}
+
+type jsonLatency struct {
+	Avg float64 `json:"avg"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	P95 float64 `json:"p95"`
+}
+
+type jsonOutage struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"duration_s"`
+	Ongoing  bool      `json:"ongoing"`
+	Message  string    `json:"message"`
+}
+
+// jsonReportOf converts a report to its JSON representation
+func jsonReportOf(r *Report) *jsonReport {
+	seconds := func(d time.Duration) float64 { return d.Seconds() }
+	optional := func(v float64) *float64 {
+		if v < 0 {
+			return nil
+		}
+		return &v
+	}
+	milliseconds := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+
+	j := &jsonReport{Period: r.Name, From: r.From, To: r.To, Generated: r.Generated, Partial: r.Partial(),
+		Observed: seconds(r.Observed), Sites: []jsonSite{}}
+	for _, s := range r.Sites {
+		site := jsonSite{Name: s.Name, Url: s.Url, Probes: s.Probes, Up: s.Up, Uptime: optional(r.Uptime(s)),
+			Observed: seconds(s.Observed), Incidents: len(s.Outages), Downtime: seconds(s.Downtime()), MTTR: optional(seconds(s.MTTR())),
+			MTBF: optional(seconds(r.MTBF(s))), LongestOutage: seconds(s.LongestOutage()), Outages: []jsonOutage{}}
+		if l := s.Latency; l != nil {
+			site.Latency = &jsonLatency{Avg: milliseconds(l.Avg), Min: milliseconds(l.Min), Max: milliseconds(l.Max), P95: milliseconds(l.P95)}
+		}
+		for _, o := range s.Outages {
+			site.Outages = append(site.Outages, jsonOutage{Start: o.Start, End: o.End, Duration: seconds(o.Duration()),
+				Ongoing: o.Ongoing, Message: o.Message})
+		}
+		j.Sites = append(j.Sites, site)
+	}
+	return j
+}
@@ -0,0 +1,321 @@
+// Package uptime computes uptime reports of monitors over a calendar period from stored history: uptime percentage,
+// outages with their downtime, MTTR and MTBF, and latency summaries, rendered as Markdown, HTML or JSON
+package uptime
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+// Site is a website covered by the report
+type Site struct {
+	Url  string
+	Name string // shown instead of the url when set
+}
+
+// Period is the calendar period covered by a report (UTC)
+type Period struct {
+	Name     string // e.g. 2026-09
+	From, To time.Time
+}
+
+// ParsePeriod parses a month like 2026-09, a year like 2026 or a day like 2026-09-15
+func ParsePeriod(s string) (Period, error) {
+	for _, p := range []struct {
+		layout string
+		next   func(t time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	} {
+		if from, err := time.Parse(p.layout, s); err == nil {
+			return Period{Name: s, From: from, To: p.next(from)}, nil
+		}
+	}
+	return Period{}, fmt.Errorf("invalid period %q, expected a month like 2026-09, a year or a day", s)
+}
+
+// LastMonth returns the last complete month at `now`
+func LastMonth(now time.Time) Period {
+	now = now.UTC()
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, -1, 0)
+	return Period{Name: from.Format("2006-01"), From: from, To: to}
+}
+
+// Outage is a period during which a site was down, i.e. its availability alert was critical,
+// clipped to the period of the report
+type Outage struct {
+	Start, End time.Time
+	Ongoing    bool // still down when the report was generated, only in reports of the current period
+	Message    string
+}
+
+// Duration returns how long the outage lasted within the period
+func (o *Outage) Duration() time.Duration {
+	return o.End.Sub(o.Start)
+}
+
+// Latency summarizes the total durations of the requests to a site
+type Latency struct {
+	Avg, Min, Max time.Duration
+	P95           time.Duration // estimated from histogram buckets
+}
+
+// SiteReport is the uptime of a site over the period
+type SiteReport struct {
+	Site
+	Probes   int
+	Up       int           // probes with a 200 status code, uptime being computed from outages (see Report.Uptime)
+	Observed time.Duration // part of the period covered by its history, from its first rollup or outage in the period
+	Latency  *Latency      // nil without latencies
+	Outages  []*Outage
+}
+
+// Downtime returns the total duration of outages
+func (s *SiteReport) Downtime() time.Duration {
+	var downtime time.Duration
+	for _, o := range s.Outages {
+		downtime += o.Duration()
+	}
+	return downtime
+}
+
+// LongestOutage returns the duration of the longest outage, 0 without outages
+func (s *SiteReport) LongestOutage() time.Duration {
+	var longest time.Duration
+	for _, o := range s.Outages {
+		if o.Duration() > longest {
+			longest = o.Duration()
+		}
+	}
+	return longest
+}
+
+// MTTR returns the mean time to recovery (the mean duration of outages), -1 without outages
+func (s *SiteReport) MTTR() time.Duration {
+	if len(s.Outages) == 0 {
+		return -1
+	}
+	return s.Downtime() / time.Duration(len(s.Outages))
+}
+
+// Report is the uptime report of sites over a period
+type Report struct {
+	Period
+	Generated time.Time
+	Observed  time.Duration // part of the period already elapsed when the report was generated
+	Sites     []*SiteReport
+}
+
+// Partial returns whether the period wasn't over when the report was generated
+func (r *Report) Partial() bool {
+	return r.Observed < r.To.Sub(r.From)
+}
+
+// Incidents returns the number of outages of all sites
+func (r *Report) Incidents() int {
+	n := 0
+	for _, s := range r.Sites {
+		n += len(s.Outages)
+	}
+	return n
+}
+
+// Uptime returns the ratio of the time observed of `s` it wasn't in an outage, so that it matches its downtime, or -1 without probes
+func (r *Report) Uptime(s *SiteReport) float64 {
+	if s.Probes == 0 || s.Observed <= 0 {
+		return -1
+	}
+	return 1 - float64(s.Downtime())/float64(s.Observed)
+}
+
+// MTBF returns the mean time between failures of `s` (the time it was up over the number of outages), -1 without outages
+func (r *Report) MTBF(s *SiteReport) time.Duration {
+	if len(s.Outages) == 0 {
+		return -1
+	}
+	return (s.Observed - s.Downtime()) / time.Duration(len(s.Outages))
+}
+
+// Build computes the report of `sites` over `period` from the rollups and alert events in `store`
+// if `sites` is empty, every website with reports over the period is included, sorted by url
+func Build(store *storage.Store, sites []Site, period Period, now time.Time) (*Report, error) {
+	now = now.UTC()
+	end := period.To
+	if now.Before(end) {
+		end = now
+	}
+	if !end.After(period.From) {
+		return nil, fmt.Errorf("period %s hasn't started yet", period.Name)
+	}
+	r := &Report{Period: period, Generated: now, Observed: end.Sub(period.From)}
+
+	reports := make(map[string]*SiteReport)
+	totals := make(map[string]*storage.Rollup)
+	addSite := func(site Site) *SiteReport {
+		if site.Name == "" {
+			site.Name = site.Url
+		}
+		s := &SiteReport{Site: site}
+		reports[site.Url] = s
+		totals[site.Url] = storage.NewRollup(site.Url, period.From, r.Observed)
+		r.Sites = append(r.Sites, s)
+		return s
+	}
+	for _, site := range sites {
+		addSite(site)
+	}
+
+	// hourly rollups, so that periods which don't start or end at midnight are precise enough
+	first := make(map[string]time.Time) // start of the first rollup of each url
+	err := store.Rollups(period.From, end.Add(-time.Nanosecond), time.Hour, func(rollup *storage.Rollup) error {
+		if _, ok := reports[rollup.Url]; !ok {
+			if len(sites) > 0 {
+				return nil
+			}
+			addSite(Site{Url: rollup.Url})
+		}
+		totals[rollup.Url].Merge(rollup)
+		if at, ok := first[rollup.Url]; !ok || rollup.Time.Before(at) {
+			first[rollup.Url] = rollup.Time
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sites) == 0 {
+		sort.Slice(r.Sites, func(i, j int) bool { return r.Sites[i].Url < r.Sites[j].Url })
+	}
+	for url, total := range totals {
+		s := reports[url]
+		s.Probes, s.Up = total.Count, total.Successes
+		if total.Latencies > 0 {
+			s.Latency = &Latency{Avg: total.AvgLatency(), Min: fromMilliseconds(total.LatencyMin),
+				Max: fromMilliseconds(total.LatencyMax), P95: total.Percentile(95)}
+		}
+	}
+
+	// sites down when the period started were so since their last availability event before it
+	var urls []string
+	for url := range reports {
+		urls = append(urls, url)
+	}
+	events, err := store.LastEvents(period.From, "availability", urls)
+	if err != nil {
+		return nil, err
+	}
+	inPeriod, err := store.Events(period.From, end)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, inPeriod...)
+
+	// outages still open when the monitor was stopped have no resolution, they end once sites are probed up again
+	resumed := make(map[string][]storage.Resumption)
+	for url, outages := range outagesOf(events, nil, time.Time{}, end, now) {
+		if _, ok := reports[url]; !ok {
+			continue
+		}
+		for _, o := range outages {
+			rs, err := store.Resumptions(url, o.Start, o.End)
+			if err != nil {
+				return nil, err
+			}
+			resumed[url] = append(resumed[url], rs...)
+		}
+	}
+	for url, outages := range outagesOf(events, resumed, period.From, end, now) {
+		if s, ok := reports[url]; ok {
+			s.Outages = outages
+		}
+	}
+
+	// sites monitored after the period started were only observed since, down or not
+	for url, s := range reports {
+		start, ok := first[url]
+		if len(s.Outages) > 0 && (!ok || s.Outages[0].Start.Before(start)) {
+			start, ok = s.Outages[0].Start, true
+		}
+		if ok {
+			if start.Before(period.From) {
+				start = period.From
+			}
+			s.Observed = end.Sub(start)
+		}
+	}
+	return r, nil
+}
+
+// outagesOf returns the outages of each url between `from` (unbounded if zero) and `to`: an outage starts with
+// an availability alert going critical, and ends with the next availability event (its resolution, or it going back
+// to a lower severity), or else once the url was probed up after a resumption of its reports with no event since
+// outages not over at `to` end there, and are ongoing if it's `now`
+func outagesOf(events []*metrics.Event, resumed map[string][]storage.Resumption, from, to, now time.Time) map[string][]*Outage {
+	outages := make(map[string][]*Outage)
+	down := make(map[string]*Outage)
+	end := func(url string, o *Outage, at time.Time) {
+		delete(down, url)
+		o.End = at
+		if (!from.IsZero() && !o.End.After(from)) || !o.Start.Before(to) {
+			return
+		}
+		if o.Start.Before(from) {
+			o.Start = from
+		}
+		if o.End.After(to) {
+			o.End = to
+		}
+		outages[url] = append(outages[url], o)
+	}
+	last := make(map[string]time.Time) // time of the last availability event of each url
+	// recovered ends the outage of `url` if it was probed up after a resumption with no event since, before `next`
+	recovered := func(url string, next *metrics.Event) {
+		o, isDown := down[url]
+		if !isDown {
+			return
+		}
+		for _, r := range resumed[url] {
+			if r.At.After(last[url]) && (next == nil || r.Up.Before(next.Time)) {
+				end(url, o, r.Up)
+				return
+			}
+		}
+	}
+
+	for _, e := range events {
+		if e.Alert != "availability" {
+			continue
+		}
+		recovered(e.Url, e)
+		last[e.Url] = e.Time
+		// events stored before severities were recorded were all critical
+		critical := !e.Resolved && (e.Severity == "critical" || e.Severity == "")
+		o, isDown := down[e.Url]
+		switch {
+		case critical && !isDown:
+			down[e.Url] = &Outage{Start: e.Time, Message: e.Message}
+		case !critical && isDown:
+			end(e.Url, o, e.Time)
+		}
+	}
+	for url := range down {
+		recovered(url, nil)
+	}
+	for url, o := range down {
+		o.Ongoing = to.Equal(now)
+		end(url, o, to)
+	}
+	return outages
+}
+
+// fromMilliseconds converts milliseconds of rollups to a duration
+func fromMilliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,245 @@
+// Package monitor embeds iseeu's website monitoring in Go programs: websites are probed every polling interval,
+// their reports aggregated over windows, and alerts fire (and are notified) when they're down, slow or flapping,
+// or when user-defined alert rules hold.
+//
+//	m, err := monitor.New(
+//		monitor.WithTargets(monitor.Target{URL: "example.com", Interval: 5 * time.Second}),
+//		monitor.WithRules(monitor.Rule{Name: "slow", Expr: "p95(ttfb, 1m) > 800ms"}),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	m.SubscribeAlerts(func(a monitor.Alert) { log.Println(a.Message) })
+//	if err := m.Start(ctx); err != nil {
+//		return err
+//	}
+//	defer m.Stop(context.Background())
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/core"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/notify"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+)
+
+// Monitor monitors websites, it's safe for concurrent use
+type Monitor struct {
+	// settings, see options
+	targets    []Target
+	windows    Windows
+	alerting   Alerting
+	rules      []Rule
+	channels   map[string]Channel
+	escalation Escalation
+	stateFile  string
+	dataDir    string
+	retention  Retention
+
+	core     *core.Monitor
+	settings *metrics.Settings // windows and alert settings of the metrics of monitors
+
+	mu                sync.RWMutex
+	reportSubscribers []func(Report)
+	alertSubscribers  []func(Alert)
+}
+
+// New inits a Monitor configured by `opts`, which starts monitoring with Start
+func New(opts ...Option) (*Monitor, error) {
+	m := &Monitor{windows: DefaultWindows(), alerting: DefaultAlerting(), retention: DefaultRetention()}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if err := m.configure(); err != nil {
+		return nil, err
+	}
+
+	var ruleConfigs []config.RuleConfig
+	for _, r := range m.rules {
+		ruleConfigs = append(ruleConfigs, config.RuleConfig{Name: r.Name, Expr: r.Expr, Severity: r.Severity,
+			For: config.Duration(r.For), Labels: r.Labels, Annotations: r.Annotations})
+	}
+	ruleset, err := rules.Compile(ruleConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	notifierConfigs := make(map[string]config.NotifierConfig, len(m.channels))
+	for name, c := range m.channels {
+		notifierConfigs[name] = config.NotifierConfig{Type: c.Type, URL: c.URL, Command: c.Command, Path: c.Path}
+	}
+	notifiers, err := notify.FromConfig(notifierConfigs)
+	if err != nil {
+		return nil, err
+	}
+	policy := config.EscalationConfig{Primary: m.escalation.Primary, RepeatInterval: config.Duration(m.escalation.RepeatInterval),
+		Secondary: m.escalation.Secondary, EscalateAfter: config.Duration(m.escalation.EscalateAfter), Routes: m.escalation.Routes}
+
+	targets := make([]core.Target, 0, len(m.targets))
+	for _, t := range m.targets {
+		targets = append(targets, core.Target(t))
+	}
+	m.core, err = core.New(core.Config{
+		Targets:    targets,
+		Settings:   m.settings,
+		Rules:      ruleset,
+		Notifiers:  notifiers,
+		Escalation: policy,
+		StateFile:  m.stateFile,
+		DataDir:    m.dataDir,
+		Retention:  config.Retention(m.retention),
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.core.Watch(m.added, nil)
+	return m, nil
+}
+
+// configure validates the windows and alert settings, which are those of the metrics of its monitors
+func (m *Monitor) configure() error {
+	defaults, w := DefaultWindows(), &m.windows
+	if len(w.Stats) == 0 {
+		w.Stats = defaults.Stats
+	}
+	stats := make(config.Windows, 0, len(w.Stats))
+	for _, s := range w.Stats {
+		stats = append(stats, config.Window{Name: s.Name, Duration: s.Duration})
+	}
+	if err := stats.Validate(); err != nil {
+		return err
+	}
+	for _, d := range []struct{ value, def *time.Duration }{
+		{&w.Alert, &defaults.Alert}, {&w.Flap, &defaults.Flap}, {&w.History, &defaults.History},
+	} {
+		if *d.value == 0 {
+			*d.value = *d.def
+		}
+		if *d.value < 0 {
+			return fmt.Errorf("invalid window %v", *d.value)
+		}
+	}
+	a, defaultAlerting := &m.alerting, DefaultAlerting()
+	if a.CriticalAvailability == 0 {
+		a.CriticalAvailability = defaultAlerting.CriticalAvailability
+	}
+	if a.LatencyAggregate == "" {
+		a.LatencyAggregate = defaultAlerting.LatencyAggregate
+	}
+	if a.LatencyPhase == "" {
+		a.LatencyPhase = defaultAlerting.LatencyPhase
+	}
+	if err := metrics.ValidateThresholds(a.CriticalAvailability, a.WarningAvailability, a.LatencyThreshold, a.LatencyWarning); err != nil {
+		return err
+	}
+	if err := metrics.ValidateLatencyAlert(a.LatencyPhase, a.LatencyAggregate); err != nil {
+		return err
+	}
+	if a.FlapLowThreshold > a.FlapHighThreshold {
+		return errors.New("flap low threshold must not be above flap high threshold")
+	}
+
+	m.settings = &metrics.Settings{
+		StatsWindows:            stats,
+		AlertWindow:             w.Alert,
+		FlapWindow:              w.Flap,
+		HistoryRetention:        w.History,
+		CriticalAvailability:    a.CriticalAvailability,
+		WarningAvailability:     a.WarningAvailability,
+		LatencyThreshold:        a.LatencyThreshold,
+		LatencyWarningThreshold: a.LatencyWarning,
+		LatencyAggregate:        a.LatencyAggregate,
+		LatencyPhase:            a.LatencyPhase,
+		FlapHighThreshold:       a.FlapHighThreshold,
+		FlapLowThreshold:        a.FlapLowThreshold,
+	}
+	return nil
+}
+
+// Start starts monitoring the targets, until Stop is called
+func (m *Monitor) Start(ctx context.Context) error {
+	return m.core.Start(ctx)
+}
+
+// Stop stops probing, and waits until in-flight requests are processed and notifications are sent, or `ctx` is done
+func (m *Monitor) Stop(ctx context.Context) error {
+	return m.core.Stop(ctx)
+}
+
+// Add starts monitoring a target, its dependencies must already be monitored
+func (m *Monitor) Add(t Target) error {
+	return m.core.Add(core.Target(t))
+}
+
+// Remove stops monitoring the website identified by its id or url
+func (m *Monitor) Remove(id string) error {
+	return m.core.Registry.Remove(id)
+}
+
+// SubscribeReports registers `fn` to be called with every report, from the goroutines processing reports,
+// so it must not block
+func (m *Monitor) SubscribeReports(fn func(Report)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reportSubscribers = append(m.reportSubscribers, fn)
+}
+
+// SubscribeAlerts registers `fn` to be called with every alert transition, from the goroutines processing reports,
+// so it must not block
+func (m *Monitor) SubscribeAlerts(fn func(Alert)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alertSubscribers = append(m.alertSubscribers, fn)
+}
+
+// Snapshots returns the current state of the monitored websites, in the order they were added
+func (m *Monitor) Snapshots() []Snapshot {
+	monitors := m.core.Registry.Monitors()
+	snapshots := make([]Snapshot, 0, len(monitors))
+	for _, mon := range monitors {
+		snapshots = append(snapshots, newSnapshot(mon))
+	}
+	return snapshots
+}
+
+// Snapshot returns the current state of the website identified by its id or url
+func (m *Monitor) Snapshot(id string) (Snapshot, bool) {
+	mon := m.core.Registry.Get(id)
+	if mon == nil {
+		return Snapshot{}, false
+	}
+	return newSnapshot(mon), true
+}
+
+// added sends the reports and alert transitions of a new monitor to subscribers
+func (m *Monitor) added(mon *registry.Monitor) {
+	mon.Metrics.SubscribeReports(func(r *metrics.Record) {
+		m.mu.RLock()
+		subscribers := m.reportSubscribers
+		m.mu.RUnlock()
+		if len(subscribers) == 0 {
+			return
+		}
+		report := newReport(mon, r)
+		for _, fn := range subscribers {
+			fn(report)
+		}
+	})
+	mon.Metrics.Subscribe(func(e *metrics.Event) {
+		m.mu.RLock()
+		subscribers := m.alertSubscribers
+		m.mu.RUnlock()
+		alert := newAlert(mon, e)
+		for _, fn := range subscribers {
+			fn(alert)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package monitor
+
+import (
+	"time"
+)
+
+// Option configures a Monitor, see New
+type Option func(*Monitor)
+
+// Target is a website to monitor
+type Target struct {
+	URL       string        // normalized like on the command line, e.g. "example.com" is "https://example.com"
+	Interval  time.Duration // polling interval
+	Name      string        // optional name, used as id when set
+	Tags      []string      // optional free-form tags
+	DependsOn []string      // names or urls of targets this one depends on, whose outages suppress its alerts
+}
+
+// Windows defines over which durations reports are aggregated, they must be at least as long as polling intervals
+// zero fields default to those of DefaultWindows
+type Windows struct {
+	Stats   []Window      // stats of snapshots, e.g. over 1m, 5m, 1h and 24h
+	Alert   time.Duration // availability and latency alerts
+	Flap    time.Duration // state changes tracked for flap detection
+	History time.Duration // reports kept in memory
+}
+
+// Window is a named window stats of snapshots are aggregated over
+type Window struct {
+	Name     string // unique name, e.g. "5m"
+	Duration time.Duration
+}
+
+// DefaultWindows returns the windows of the iseeu command
+func DefaultWindows() Windows {
+	return Windows{
+		Stats:   []Window{{Name: "short", Duration: 10 * time.Second}, {Name: "long", Duration: time.Minute}},
+		Alert:   10 * time.Second,
+		Flap:    20 * time.Second,
+		History: time.Hour,
+	}
+}
+
+// Alerting defines when built-in alerts fire
+// zero fields default to those of DefaultAlerting, except those whose zero disables an alert
+type Alerting struct {
+	CriticalAvailability float64       // availability over the alert window below which a website is down
+	WarningAvailability  float64       // availability over the alert window below which a website is degraded (0 disables availability warnings)
+	LatencyThreshold     time.Duration // latency above which a website is slow (0 disables latency alerts)
+	LatencyWarning       time.Duration // latency above which a website is slow, with a warning severity (0 disables latency warnings)
+	LatencyAggregate     string        // how latency is aggregated over the alert window: avg, max or a percentile like p95
+	LatencyPhase         string        // latency of the first byte (ttfb) or of the total request duration (total)
+	FlapHighThreshold    float64       // percent state change above which a website is flapping (0 disables flap detection)
+	FlapLowThreshold     float64       // percent state change below which a website stops flapping
+}
+
+// DefaultAlerting returns the alert settings of the iseeu command
+func DefaultAlerting() Alerting {
+	return Alerting{
+		CriticalAvailability: 0.8,
+		LatencyAggregate:     "avg",
+		LatencyPhase:         "ttfb",
+		FlapHighThreshold:    0.5,
+		FlapLowThreshold:     0.25,
+	}
+}
+
+// Rule is an alert rule evaluated against every website, e.g. "availability(5m) < 0.95 and p95(ttfb, 5m) > 800ms"
+type Rule struct {
+	Name        string
+	Expr        string
+	Severity    string        // info, warning or critical (default)
+	For         time.Duration // how long `Expr` must hold before the rule fires
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// Channel is a notification channel of incidents
+type Channel struct {
+	Type    string   // webhook, exec or file
+	URL     string   // url notifications are POSTed to (webhook)
+	Command []string // command and arguments receiving notifications on stdin (exec)
+	Path    string   // file notifications are appended to (file)
+}
+
+// Escalation defines how incidents are notified and escalated until they are acknowledged or resolved
+type Escalation struct {
+	Primary        string        // channel notified as soon as an incident opens
+	RepeatInterval time.Duration // unacknowledged incidents are re-notified every `RepeatInterval` (0 disables)
+	Secondary      string        // channel notified once an incident is unacknowledged for `EscalateAfter`
+	EscalateAfter  time.Duration
+	Routes         map[string]string // maps severities (info, warning or critical) to the channel notified instead of `Primary`
+}
+
+// Sink receives every report and alert transition, e.g. to forward them to another system
+// its methods are called from the goroutines processing reports, so they must not block
+type Sink interface {
+	Report(Report)
+	Alert(Alert)
+}
+
+// WithTargets adds websites monitored once the Monitor starts
+func WithTargets(targets ...Target) Option {
+	return func(m *Monitor) {
+		m.targets = append(m.targets, targets...)
+	}
+}
+
+// WithWindows sets the aggregation windows
+func WithWindows(windows Windows) Option {
+	return func(m *Monitor) {
+		m.windows = windows
+	}
+}
+
+// WithAlerting sets when built-in alerts fire
+func WithAlerting(alerting Alerting) Option {
+	return func(m *Monitor) {
+		m.alerting = alerting
+	}
+}
+
+// WithRules adds alert rules
+func WithRules(rules ...Rule) Option {
+	return func(m *Monitor) {
+		m.rules = append(m.rules, rules...)
+	}
+}
+
+// WithNotifications notifies incidents on `channels` following the escalation `policy`
+// open incidents are persisted in `stateFile` (if not empty) so that they outlive the process
+func WithNotifications(channels map[string]Channel, policy Escalation, stateFile string) Option {
+	return func(m *Monitor) {
+		m.channels = channels
+		m.escalation = policy
+		m.stateFile = stateFile
+	}
+}
+
+// Retention is how long stored reports and their per-minute, per-hour and per-day rollups are kept, 0 keeps them forever
+// coarser tiers must be kept at least as long as finer ones
+type Retention struct {
+	Raw, Minute, Hour, Day time.Duration
+}
+
+// DefaultRetention returns the retention of the iseeu command
+func DefaultRetention() Retention {
+	return Retention{Raw: 7 * 24 * time.Hour, Minute: 30 * 24 * time.Hour, Hour: 90 * 24 * time.Hour}
+}
+
+// WithRetention sets how long stored reports and their rollups are kept, see WithDataDir
+func WithRetention(retention Retention) Option {
+	return func(m *Monitor) {
+		m.retention = retention
+	}
+}
+
+// WithDataDir stores reports and alert transitions in `dir`, as the iseeu command does with `-data`
+// reports are rolled up by minute, hour and day once their day is over, and deleted after their retention
+func WithDataDir(dir string) Option {
+	return func(m *Monitor) {
+		m.dataDir = dir
+	}
+}
+
+// WithSink sends every report and alert transition to `sink`
+func WithSink(sink Sink) Option {
+	return func(m *Monitor) {
+		m.reportSubscribers = append(m.reportSubscribers, sink.Report)
+		m.alertSubscribers = append(m.alertSubscribers, sink.Alert)
+	}
+}
@@ -0,0 +1,178 @@
+package monitor
+
+import (
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+)
+
+// Report is the result of a probe of a website, durations are -1 when the request failed
+type Report struct {
+	ID                string // id of the monitor: its name if it has one, its url otherwise
+	URL               string
+	Time              time.Time
+	StatusCode        int // 0 when no response was received, checks of other protocols than HTTP report 200 when they succeed
+	ConnectDuration   time.Duration
+	FirstByteDuration time.Duration
+	TotalDuration     time.Duration
+	Error             string             // why the request failed, if it did
+	Warning           string             // why the check is degraded although it succeeded, e.g. an exec check exiting with 1
+	Protocol          string             // protocol of the check, e.g. http
+	Details           map[string]string  // protocol-specific fields
+	Metrics           map[string]float64 // protocol-specific named values, e.g. performance data of exec checks
+}
+
+// Alert is an alert transition of a website
+type Alert struct {
+	ID       string // id of the monitor: its name if it has one, its url otherwise
+	URL      string
+	Alert    string // availability, latency, flapping or rule:<name>
+	Resolved bool   // whether the alert stopped (true) or started (false)
+	Severity string // info, warning or critical
+	Message  string
+	Time     time.Time
+}
+
+// Snapshot is the current state of a monitored website
+type Snapshot struct {
+	ID              string
+	URL             string
+	Name            string
+	Tags            []string
+	PollingInterval time.Duration
+	Paused          bool
+	LastUpdate      time.Time     // time of the last processed report
+	Availability    float64       // over the alert window
+	Down            bool          // the last probe failed (no 200 status code), false while flapping, see Level for availability
+	Level           string        // ok, warning or critical: the worst level of availability, latency and flapping
+	Latency         time.Duration // latency aggregated over the alert window, used in latency alerts
+	LatencyHigh     bool
+	Flapping        bool
+	Stats           []Stats      // stats aggregated over each window, in the order of Windows.Stats
+	Rules           []RuleStatus // state of alert rules for the website
+}
+
+// Window returns the stats aggregated over the window named `name`
+func (s Snapshot) Window(name string) (Stats, bool) {
+	for _, stats := range s.Stats {
+		if stats.Name == name {
+			return stats, true
+		}
+	}
+	return Stats{}, false
+}
+
+// Stats are stats aggregated over a window
+type Stats struct {
+	Name              string // name of the window
+	Window            time.Duration
+	Availability      float64
+	StatusCodes       map[int]int // count of each status code (0 for failed requests)
+	ConnectDuration   AvgMax
+	FirstByteDuration AvgMax
+	TotalDuration     AvgMax
+}
+
+// AvgMax are the average and maximum of durations of successful requests
+type AvgMax struct {
+	Avg, Max time.Duration
+}
+
+// RuleStatus is the state of an alert rule for a website
+type RuleStatus struct {
+	Name        string
+	Severity    string
+	State       string    // inactive, pending or firing
+	ActiveSince time.Time // zero when inactive
+}
+
+func newReport(m *registry.Monitor, record *metrics.Record) Report {
+	r := record.Report
+	return Report{
+		ID:                m.ID(),
+		URL:               r.Url,
+		Time:              record.Time,
+		StatusCode:        r.StatusCode,
+		ConnectDuration:   r.ConnectDuration,
+		FirstByteDuration: r.FirstByteDuration,
+		TotalDuration:     r.TotalDuration,
+		Error:             r.Error,
+		Warning:           r.Warning,
+		Protocol:          r.Protocol,
+		Details:           r.Details,
+		Metrics:           r.Metrics,
+	}
+}
+
+func newAlert(m *registry.Monitor, e *metrics.Event) Alert {
+	return Alert{
+		ID:       m.ID(),
+		URL:      e.Url,
+		Alert:    e.Alert,
+		Resolved: e.Resolved,
+		Severity: e.Severity,
+		Message:  e.Message,
+		Time:     e.Time,
+	}
+}
+
+// newSnapshot snapshots the state of `m` (locks its metrics for reading)
+func newSnapshot(m *registry.Monitor) Snapshot {
+	met := m.Metrics
+	met.Mu.RLock()
+	defer met.Mu.RUnlock()
+	s := Snapshot{
+		ID:              m.ID(),
+		URL:             m.Url,
+		Name:            m.Name,
+		Tags:            append([]string(nil), m.Tags...),
+		PollingInterval: m.PollingInterval,
+		Paused:          m.Inspector.Paused(),
+		LastUpdate:      met.LastTimestamp,
+		Availability:    met.Alert.Availability,
+		Down:            met.Alert.WebsiteWasDown,
+		Level:           met.Alert.Level().String(),
+		Latency:         met.Alert.Latency,
+		LatencyHigh:     met.Alert.LatencyIsHigh,
+		Flapping:        met.Alert.Flapping,
+	}
+	for _, agg := range met.AggData.Windows {
+		s.Stats = append(s.Stats, newStats(agg))
+	}
+	if met.Rules != nil {
+		for _, a := range met.Rules.Alerts {
+			status := RuleStatus{Name: a.Rule.Name, Severity: a.Rule.Severity, State: a.State.String()}
+			if a.State != rules.Inactive {
+				status.ActiveSince = a.ActiveSince
+			}
+			s.Rules = append(s.Rules, status)
+		}
+	}
+	return s
+}
+
+// newStats copies the stats of `agg`, it must be called with the metrics locked
+func newStats(agg *metrics.IntervalAggData) Stats {
+	statusCodes := make(map[int]int, len(agg.StatusCodesCount))
+	for code, count := range agg.StatusCodesCount {
+		if count > 0 {
+			statusCodes[code] = count
+		}
+	}
+	return Stats{
+		Name:              agg.Name(),
+		Window:            agg.HistoryInterval(),
+		Availability:      agg.Availability,
+		StatusCodes:       statusCodes,
+		ConnectDuration:   newAvgMax(agg.ConnectDuration),
+		FirstByteDuration: newAvgMax(agg.FirstByteDuration),
+		TotalDuration:     newAvgMax(agg.TotalDuration),
+	}
+}
+
+// newAvgMax converts [avg, max] in milliseconds
+func newAvgMax(ms [2]int) AvgMax {
+	return AvgMax{Avg: time.Duration(ms[0]) * time.Millisecond, Max: time.Duration(ms[1]) * time.Millisecond}
+}
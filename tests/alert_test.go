@@ -4,19 +4,39 @@ import (
 	"testing"
 	"time"
 
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
 	"github.com/NouamaneTazi/website-monitor/internal/config"
 	"github.com/NouamaneTazi/website-monitor/internal/inspect"
 	"github.com/NouamaneTazi/website-monitor/internal/metrics"
 )
 
 func initConfig() {
-	config.ShortUIRefreshInterval = 2 * time.Second
-	config.LongUIRefreshInterval = 10 * time.Second
-	config.ShortStatsHistoryInterval = 10 * time.Second
-	config.LongStatsHistoryInterval = 60 * time.Second
+	config.UIRefreshInterval = 2 * time.Second
+	config.StatsWindows = config.Windows{{Name: "short", Duration: 10 * time.Second}, {Name: "long", Duration: 60 * time.Second}}
 	config.WebsiteAlertInterval = 10 * time.Second
 	config.CriticalAvailability = 0.8
 }
+
+// processedReports returns a channel receiving each report once `met` has processed it, to sequence tests without sleeping
+func processedReports(met *metrics.Metrics) <-chan *metrics.Record {
+	processed := make(chan *metrics.Record)
+	met.SubscribeReports(func(r *metrics.Record) { processed <- r })
+	return processed
+}
+
+// pacedReports is like processedReports, but reports are timestamped `pollingInterval` apart by a fake clock,
+// as windows hold the reports probed in their duration
+func pacedReports(met *metrics.Metrics, pollingInterval time.Duration) <-chan *metrics.Record {
+	clk := clock.NewFake(time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC))
+	met.Clock = clk
+	processed := make(chan *metrics.Record)
+	met.SubscribeReports(func(r *metrics.Record) {
+		clk.Add(pollingInterval)
+		processed <- r
+	})
+	return processed
+}
+
 func TestAlerting(t *testing.T) {
 	initConfig()
 	reportc := make(chan *inspect.Report, 5)
@@ -36,7 +56,8 @@ func TestAlerting(t *testing.T) {
 		FirstByteDuration: 5,
 	}
 
-	met := metrics.NewMetrics(reportc, pollingInterval)
+	met := metrics.NewMetrics(reportc, pollingInterval, metrics.ConfigSettings())
+	processed := pacedReports(met, pollingInterval)
 	go met.ListenAndProcess() // listens for incoming reports
 	alert := met.Alert
 
@@ -51,7 +72,7 @@ func TestAlerting(t *testing.T) {
 		// website doing BAD
 		for i := 0; i < 10; i++ {
 			reportc <- errReport
-			time.Sleep(time.Millisecond) // Simulate pollinginterval, and forces writer to start before reader
+			<-processed // wait for the report to be processed
 			met.Mu.RLock()
 			if alert.WebsiteHasRecovered {
 				t.Error("Phase 1: Website hasn't recovered yet")
@@ -65,7 +86,7 @@ func TestAlerting(t *testing.T) {
 		// website recovering
 		for i := 0; i < 7; i++ {
 			reportc <- availableReport
-			time.Sleep(time.Millisecond) // Simulate pollinginterval, and forces writer to start before reader
+			<-processed // wait for the report to be processed
 			met.Mu.RLock()
 			if alert.WebsiteHasRecovered {
 				t.Error("Phase 2: Website hasn't recovered yet")
@@ -78,7 +99,7 @@ func TestAlerting(t *testing.T) {
 
 		// website has recovered
 		reportc <- availableReport
-		time.Sleep(time.Millisecond) // Simulate pollinginterval, and forces writer to start before reader
+		<-processed // wait for the report to be processed
 		met.Mu.RLock()
 		if !alert.WebsiteHasRecovered {
 			t.Error("Phase 3: Website has recovered")
@@ -91,7 +112,7 @@ func TestAlerting(t *testing.T) {
 		// website in good shape
 		for i := 0; i < 10; i++ {
 			reportc <- availableReport
-			time.Sleep(time.Millisecond) // Simulate pollinginterval, and forces writer to start before reader
+			<-processed // wait for the report to be processed
 			met.Mu.RLock()
 			if alert.WebsiteHasRecovered {
 				t.Error("Phase 4: Website hasn't recovered")
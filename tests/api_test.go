@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/api"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+)
+
+// request sends a request with a JSON `body` and the API token to `server` and decodes the JSON response into `v`
+func request(t *testing.T, server http.Handler, method, path string, body, v interface{}) int {
+	t.Helper()
+	var reqBody bytes.Buffer
+	req := httptest.NewRequest(method, path, &reqBody)
+	if body != nil {
+		json.NewEncoder(&reqBody).Encode(body)
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if config.APIToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.APIToken)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: invalid JSON: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+// probe probes a paused monitor `n` times, waiting for each report to be processed
+func probe(t *testing.T, m *registry.Monitor, n int) {
+	t.Helper()
+	processed := make(chan struct{}, n)
+	m.Metrics.SubscribeReports(func(*metrics.Record) {
+		select {
+		case processed <- struct{}{}:
+		default: // reports of later probes
+		}
+	})
+	for i := 0; i < n; i++ {
+		m.Inspector.ProbeNow()
+		select {
+		case <-processed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("probe of %s wasn't processed", m.Url)
+		}
+	}
+}
+
+func TestAPI(t *testing.T) {
+	initConfig()
+	config.HistoryRetention = time.Hour
+	config.APIToken = "secret"
+	defer func() { config.APIToken = "" }()
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer website.Close()
+
+	incidents, err := incident.NewManager(config.EscalationConfig{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitors := registry.New(func(m *registry.Monitor) {
+		m.Inspector.Pause() // only probe on demand
+		m.Metrics.Subscribe(incidents.Handle)
+	}, func(m *registry.Monitor) {
+		incidents.Remove(m.Url)
+	})
+	defer monitors.Close(context.Background())
+	lb, err := monitors.Add(website.URL+"/lb", time.Second, "lb-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe(t, lb, 3)
+	server := api.NewServer(monitors, incidents, nil)
+
+	// add a monitor at runtime
+	var monitor map[string]interface{}
+	body := map[string]string{"url": website.URL + "/v1", "interval": "1s"}
+	if code := request(t, server, "POST", "/api/v1/monitors", body, &monitor); code != http.StatusCreated || monitor["id"] != website.URL+"/v1" {
+		t.Fatalf("POST monitors: got %d %v", code, monitor)
+	}
+	if code := request(t, server, "POST", "/api/v1/monitors", body, &monitor); code != http.StatusBadRequest {
+		t.Errorf("POST duplicate monitor: got %d", code)
+	}
+	if code := request(t, server, "POST", "/api/v1/monitors", map[string]string{"url": "x", "interval": "0s"}, &monitor); code != http.StatusBadRequest {
+		t.Errorf("POST monitor without interval: got %d", code)
+	}
+	if code := request(t, server, "POST", "/api/v1/monitors", map[string]string{"url": website.URL + "/v2", "interval": "1m"}, &monitor); code != http.StatusBadRequest {
+		t.Errorf("POST monitor polled less often than the alert window: got %d", code)
+	}
+
+	// write endpoints require the token and a JSON body, and only add http(s) monitors
+	if code := request(t, server, "POST", "/api/v1/monitors", map[string]string{"url": "exec:true", "interval": "1s"}, &monitor); code != http.StatusBadRequest {
+		t.Errorf("POST exec monitor: got %d", code)
+	}
+	form := httptest.NewRequest("POST", "/api/v1/monitors", strings.NewReader(`{"url": "example.com", "interval": "1s"}`))
+	form.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	form.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	if server.ServeHTTP(rec, form); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("POST form monitor: got %d", rec.Code)
+	}
+	for _, header := range []string{"", "Bearer wrong", "secret"} {
+		probe := httptest.NewRequest("POST", "/api/v1/monitors/lb-health/probe", nil)
+		probe.Header.Set("Authorization", header)
+		rec = httptest.NewRecorder()
+		if server.ServeHTTP(rec, probe); rec.Code != http.StatusUnauthorized {
+			t.Errorf("POST probe with authorization %q: got %d", header, rec.Code)
+		}
+	}
+	config.APIToken = ""
+	if code := request(t, server, "POST", "/api/v1/monitors/lb-health/probe", nil, &monitor); code != http.StatusForbidden {
+		t.Errorf("POST probe without configured token: got %d", code)
+	}
+	config.APIToken = "secret"
+	unauthorized := httptest.NewRequest("DELETE", "/api/v1/monitors/lb-health", nil)
+	rec = httptest.NewRecorder()
+	if server.ServeHTTP(rec, unauthorized); rec.Code != http.StatusUnauthorized || monitors.Get("lb-health") == nil {
+		t.Errorf("DELETE monitor without token: got %d", rec.Code)
+	}
+
+	var monitorsList []map[string]interface{}
+	if code := request(t, server, "GET", "/api/v1/monitors", nil, &monitorsList); code != http.StatusOK || len(monitorsList) != 2 {
+		t.Fatalf("GET monitors: got %d %v", code, monitorsList)
+	}
+	if monitorsList[1]["id"] != "lb-health" || monitorsList[1]["paused"] != true {
+		t.Errorf("GET monitors: monitors must be identified by name, got %v", monitorsList[1])
+	}
+
+	// read history by name and by escaped url
+	var history []map[string]interface{}
+	if code := request(t, server, "GET", "/api/v1/monitors/lb-health/history", nil, &history); code != http.StatusOK || len(history) != 3 {
+		t.Errorf("GET history by name: got %d with %d reports", code, len(history))
+	} else if history[0]["status_code"] != 200.0 {
+		t.Errorf("GET history by name: expected status 200, got %v", history[0])
+	}
+	path := "/api/v1/monitors/" + url.PathEscape(website.URL+"/lb") + "/history?to=" + time.Now().Add(-time.Hour).Format(time.RFC3339)
+	if code := request(t, server, "GET", path, nil, &history); code != http.StatusOK || len(history) != 0 {
+		t.Errorf("GET history by url before reports: got %d with %d reports", code, len(history))
+	}
+
+	// pause, resume and probe
+	if code := request(t, server, "POST", "/api/v1/monitors/lb-health/resume", nil, &monitor); code != http.StatusOK || monitor["paused"] != false {
+		t.Errorf("POST resume: got %d %v", code, monitor)
+	}
+	if code := request(t, server, "POST", "/api/v1/monitors/lb-health/pause", nil, &monitor); code != http.StatusOK || monitor["paused"] != true {
+		t.Errorf("POST pause: got %d %v", code, monitor)
+	}
+	if code := request(t, server, "POST", "/api/v1/monitors/lb-health/probe", nil, &monitor); code != http.StatusAccepted {
+		t.Errorf("POST probe: got %d", code)
+	}
+
+	var alerts map[string]interface{}
+	if code := request(t, server, "GET", "/api/v1/alerts", nil, &alerts); code != http.StatusOK {
+		t.Errorf("GET alerts: got %d", code)
+	}
+
+	// remove a monitor at runtime, its inspector is stopped
+	if code := request(t, server, "DELETE", "/api/v1/monitors/lb-health", nil, nil); code != http.StatusNoContent {
+		t.Errorf("DELETE monitor: got %d", code)
+	}
+	if monitors.Get("lb-health") != nil {
+		t.Error("DELETE monitor: monitor must be removed")
+	}
+	select {
+	case _, open := <-lb.Inspector.Reports():
+		for open {
+			_, open = <-lb.Inspector.Reports()
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("DELETE monitor: reports channel must be closed")
+	}
+
+	var apiErr map[string]string
+	if code := request(t, server, "GET", "/api/v1/monitors/lb-health", nil, &apiErr); code != http.StatusNotFound {
+		t.Errorf("GET removed monitor: got %d", code)
+	}
+	if code := request(t, server, "GET", "/api/v1/monitors/"+url.PathEscape(website.URL+"/v1")+"/history?from=yesterday", nil, &apiErr); code != http.StatusBadRequest {
+		t.Errorf("GET history with invalid from: got %d", code)
+	}
+	if code := request(t, server, "PUT", "/api/v1/alerts", nil, &apiErr); code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT alerts: got %d", code)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/api"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+func TestBadges(t *testing.T) {
+	initConfig()
+	dir, err := ioutil.TempDir("", "iseeu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer website.Close()
+
+	incidents, err := incident.NewManager(config.EscalationConfig{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitors := registry.New(func(m *registry.Monitor) {
+		m.Inspector.Pause() // only probe on demand
+		m.Metrics.SubscribeReports(func(r *metrics.Record) { store.AppendReport(r) })
+	}, nil)
+	defer monitors.Close(context.Background())
+	m, err := monitors.Add(website.URL, time.Second, "website")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := api.NewServer(monitors, incidents, store)
+
+	badge := func(kind string) (int, string) {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/monitors/website/badges/"+kind, nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	// Phase 1: without reports, badges show no data
+	if code, svg := badge("uptime-24h.svg"); code != http.StatusOK || !strings.Contains(svg, "uptime 24h: no data") {
+		t.Fatalf("Phase 1: Expected uptime badge without data, got %d %s", code, svg)
+	}
+	if code, _ := badge("unknown.svg"); code != http.StatusNotFound {
+		t.Fatalf("Phase 1: Expected unknown badge to be not found, got %d", code)
+	}
+
+	// Phase 2: uptimes are computed from the stored history, status and response time from live metrics
+	for i := 0; i < 3; i++ {
+		store.AppendReport(&metrics.Record{Time: time.Now().Add(-3 * 24 * time.Hour), Report: &inspect.Report{
+			Url: m.Url, StatusCode: 500, ConnectDuration: -1, FirstByteDuration: -1, TotalDuration: -1,
+		}})
+	}
+	probe(t, m, 1)
+	expected := map[string]string{
+		"status":        "status: paused",
+		"uptime-24h":    "uptime 24h: 100.00%",
+		"uptime-7d":     "uptime 7d: 25.00%",
+		"response-time": "response time: ",
+	}
+	for kind, text := range expected {
+		code, svg := badge(kind + ".svg")
+		if code != http.StatusOK || !strings.Contains(svg, "<title>"+text) {
+			t.Errorf("Phase 2: Expected %s badge %q, got %d %s", kind, text, code, svg)
+		}
+	}
+	m.Inspector.Resume()
+	if _, svg := badge("status.svg"); !strings.Contains(svg, "status: up") {
+		t.Errorf("Phase 2: Expected status badge to be up, got %s", svg)
+	}
+	if _, svg := badge("response-time.svg?label=latency"); !strings.Contains(svg, "<title>latency: ") || strings.Contains(svg, "no data") {
+		t.Errorf("Phase 2: Expected response time badge with custom label, got %s", svg)
+	}
+
+	// Phase 3: without storage, uptimes are computed from the history kept in memory, only over periods it covers
+	retention := config.HistoryRetention
+	config.HistoryRetention = 24 * time.Hour
+	defer func() { config.HistoryRetention = retention }()
+	live, err := monitors.Add(website.URL+"/live", time.Second, "live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe(t, live, 1)
+	server = api.NewServer(monitors, incidents, nil)
+	for kind, text := range map[string]string{"uptime-24h": "uptime 24h: 100.00%", "uptime-7d": "uptime 7d: no data"} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/monitors/live/badges/"+kind+".svg", nil))
+		if !strings.Contains(rec.Body.String(), "<title>"+text) {
+			t.Errorf("Phase 3: Expected %s badge %q, got %s", kind, text, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/check"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+)
+
+func TestCheck(t *testing.T) {
+	requests := 0
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/flaky":
+			// every other request fails
+			requests++
+			if requests%2 == 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}
+	}))
+	defer website.Close()
+	opts := check.Options{Probes: 1, Timeout: time.Second, MinSuccess: 1}
+
+	// Phase 1: probes pass assertions on status codes and latency
+	results := check.Run([]check.Target{
+		{Url: website.URL},
+		{Url: website.URL + "/missing"},
+		{Url: website.URL + "/missing", Check: config.CheckConfig{Status: []int{404}}},
+		{Url: website.URL, Check: config.CheckConfig{MaxLatency: config.Duration(time.Nanosecond)}},
+		{Url: "http://localhost:1"},
+	}, opts)
+	for i, expected := range []bool{true, false, true, false, false} {
+		if results[i].Passed != expected {
+			t.Errorf("Phase 1: Expected check of %s to pass=%v, got %+v", results[i].Url, expected, results[i].Probes[0])
+		}
+	}
+	if reason := results[1].Probes[0].Reason; !strings.Contains(reason, "status code 404") {
+		t.Errorf("Phase 1: Expected failure reason about the status code, got %q", reason)
+	}
+	if reason := results[3].Probes[0].Reason; !strings.Contains(reason, "latency") {
+		t.Errorf("Phase 1: Expected failure reason about latency, got %q", reason)
+	}
+	if results[0].Probes[0].Report.TotalDuration <= 0 {
+		t.Errorf("Phase 1: Expected timings of successful probes, got %v", results[0].Probes[0].Report.TotalDuration)
+	}
+
+	// Phase 2: checks probed several times pass if enough probes pass
+	opts.Probes = 4
+	if r := check.Run([]check.Target{{Url: website.URL + "/flaky"}}, opts)[0]; r.Passed || r.Successes() != 2 {
+		t.Errorf("Phase 2: Expected flaky check to fail with 2 successes, got %v with %d", r.Passed, r.Successes())
+	}
+	opts.MinSuccess = 0.5
+	if r := check.Run([]check.Target{{Url: website.URL + "/flaky"}}, opts)[0]; !r.Passed {
+		t.Errorf("Phase 2: Expected flaky check to pass with half of probes passing, got %d successes", r.Successes())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	ticker := clk.NewTicker(time.Second)
+
+	// Phase 1: ticks are only sent once the clock moves past them
+	clk.Add(999 * time.Millisecond)
+	select {
+	case tick := <-ticker.C:
+		t.Fatalf("Phase 1: Unexpected tick at %v", tick)
+	default:
+	}
+	clk.Add(time.Millisecond)
+	if tick := <-ticker.C; !tick.Equal(start.Add(time.Second)) {
+		t.Errorf("Phase 1: Expected tick after a second, got %v", tick)
+	}
+
+	// Phase 2: ticks are dropped for slow receivers, and the clock doesn't go back in time
+	clk.Add(10 * time.Second)
+	if tick := <-ticker.C; !tick.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("Phase 2: Expected the first missed tick, got %v", tick)
+	}
+	clk.Set(start)
+	if now := clk.Now(); !now.Equal(start.Add(11 * time.Second)) {
+		t.Errorf("Phase 2: Expected clock not to go back, got %v", now)
+	}
+
+	// Phase 3: stopped tickers don't tick anymore
+	ticker.Stop()
+	clk.Add(time.Minute)
+	select {
+	case tick := <-ticker.C:
+		t.Errorf("Phase 3: Unexpected tick of a stopped ticker at %v", tick)
+	default:
+	}
+}
+
+func TestMonitorOnFakeClock(t *testing.T) {
+	initConfig()
+	config.HistoryRetention = time.Hour
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer website.Close()
+	start := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	monitors := registry.New(nil, nil)
+	monitors.Clock = clk
+	defer monitors.Close(context.Background())
+	m, err := monitors.Add(website.URL, time.Second, "website")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitors.Remove("website")
+	processed := processedReports(m.Metrics)
+
+	// Phase 1: the website is probed on the ticks of the clock, and its reports are timestamped by it
+	for i := 1; i <= 3; i++ {
+		clk.Add(time.Second)
+		record := <-processed
+		if expected := start.Add(time.Duration(i) * time.Second); !record.Time.Equal(expected) {
+			t.Errorf("Phase 1: Expected report at %v, got %v", expected, record.Time)
+		}
+	}
+	if history := m.Metrics.History(start, start.Add(time.Hour)); len(history) != 3 {
+		t.Errorf("Phase 1: Expected 3 reports in history, got %d", len(history))
+	}
+}
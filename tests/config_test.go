@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+)
+
+func TestConfigErrorLocation(t *testing.T) {
+	file, err := ioutil.TempFile("", "iseeu-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	load := func(content string) error {
+		if err := ioutil.WriteFile(file.Name(), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return config.Load(file.Name())
+	}
+
+	// Phase 1: syntax errors are located in the file
+	if err := load("{\n  \"monitors\": [\n    {\"url\": \"example.com\",}\n  ]\n}"); err == nil || !strings.Contains(err.Error(), file.Name()+":3:") {
+		t.Errorf("Phase 1: Expected syntax error on line 3, got %v", err)
+	}
+
+	// Phase 2: type errors are located in the file
+	if err := load("{\n  \"monitors\": [\n    {\"url\": \"example.com\", \"interval\": \"2s\"},\n    {\"url\": 42}\n  ]\n}"); err == nil || !strings.Contains(err.Error(), file.Name()+":4:") {
+		t.Errorf("Phase 2: Expected type error on line 4, got %v", err)
+	}
+
+	// Phase 3: valid files are loaded
+	if err := load("{\"monitors\": [{\"url\": \"example.com\", \"interval\": \"2s\"}]}"); err != nil || len(config.Monitors) != 1 {
+		t.Errorf("Phase 3: Expected 1 monitor, got %v %v", config.Monitors, err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/api"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+)
+
+// readEvent reads the next Server-Sent Event from `stream`, skipping heartbeat comments
+func readEvent(t *testing.T, stream *bufio.Reader) (event string, data []byte) {
+	t.Helper()
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = []byte(strings.TrimPrefix(line, "data: "))
+		case line == "" && event != "":
+			return event, data
+		}
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	initConfig()
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer website.Close()
+
+	incidents, err := incident.NewManager(config.EscalationConfig{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server *api.Server
+	monitors := registry.New(func(m *registry.Monitor) {
+		m.Inspector.Pause() // only probe on demand
+		server.Watch(m)
+	}, func(m *registry.Monitor) {
+		server.Unwatch(m)
+	})
+	defer monitors.Close(context.Background())
+	server = api.NewServer(monitors, incidents, nil)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	// the dashboard page is served at the root
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "/dashboard/stream") {
+		t.Fatalf("GET /: got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/dashboard/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("stream content type: got %s", ct)
+	}
+	stream := bufio.NewReader(resp.Body)
+
+	// Phase 1: each processed report is streamed with the monitor status
+	m, err := monitors.Add(website.URL, time.Second, "website")
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe(t, m, 1)
+	event, data := readEvent(t, stream)
+	var update struct {
+		Monitor struct {
+			ID string `json:"id"`
+		} `json:"monitor"`
+		Report struct {
+			StatusCode int `json:"status_code"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal(data, &update); err != nil {
+		t.Fatal(err)
+	}
+	if event != "monitor" || update.Monitor.ID != "website" || update.Report.StatusCode != http.StatusOK {
+		t.Fatalf("Phase 1: Expected a monitor update of website with status 200, got %s %s", event, data)
+	}
+
+	// Phase 2: removed monitors are streamed
+	if err := monitors.Remove("website"); err != nil {
+		t.Fatal(err)
+	}
+	event, data = readEvent(t, stream)
+	if event != "removed" || !strings.Contains(string(data), `"id":"website"`) {
+		t.Fatalf("Phase 2: Expected website to be removed, got %s %s", event, data)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/notify"
+)
+
+func TestDependencySuppression(t *testing.T) {
+	primary := make(chanNotifier, 10)
+	policy := config.EscalationConfig{Primary: "chat", RepeatInterval: config.Duration(5 * time.Minute)}
+	manager, err := incident.NewManager(policy, map[string]notify.Notifier{"chat": primary}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.DependsOn("https://api.example.com", "https://lb.example.com")
+	manager.DependsOn("https://www.example.com", "https://api.example.com")
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	down := func(url string, at time.Duration) {
+		manager.Handle(&metrics.Event{Url: url, Alert: "availability", Severity: "critical", Time: start.Add(at)})
+	}
+	recovered := func(url string, at time.Duration) {
+		manager.Handle(&metrics.Event{Url: url, Alert: "availability", Resolved: true, Severity: "critical", Time: start.Add(at)})
+	}
+
+	// load balancer down: its dependencies (direct and transitive) alerts are suppressed
+	down("https://lb.example.com", 0)
+	expectNotification(t, primary, "Phase 1")
+	down("https://api.example.com", time.Second)
+	down("https://www.example.com", 2*time.Second)
+	expectNoNotification(t, primary, "Phase 1")
+	if parent := manager.SuppressedBy("https://www.example.com"); parent != "https://lb.example.com" {
+		t.Errorf("Phase 1: www must be suppressed by lb, got %q", parent)
+	}
+	if children := manager.Suppressing("https://lb.example.com"); len(children) != 2 {
+		t.Errorf("Phase 1: lb must suppress api and www, got %v", children)
+	}
+
+	// repeated notifications of the parent list suppressed websites
+	manager.Tick(start.Add(5 * time.Minute))
+	if n := expectNotification(t, primary, "Phase 2"); len(n.Suppressed) != 2 {
+		t.Errorf("Phase 2: notification must group suppressed websites, got %+v", n)
+	}
+	expectNoNotification(t, primary, "Phase 2")
+
+	// suppressed website recovering isn't notified
+	recovered("https://www.example.com", 6*time.Minute)
+	expectNoNotification(t, primary, "Phase 3")
+
+	// load balancer recovering releases the websites that are still down
+	// * note notifications are sent asynchronously so their order isn't guaranteed
+	recovered("https://lb.example.com", 7*time.Minute)
+	notifications := map[string]*notify.Notification{}
+	for i := 0; i < 2; i++ {
+		n := expectNotification(t, primary, "Phase 4")
+		notifications[n.Url] = n
+	}
+	if n := notifications["https://lb.example.com"]; n == nil || !n.Resolved {
+		t.Errorf("Phase 4: lb must be notified as resolved, got %+v", n)
+	}
+	if n := notifications["https://api.example.com"]; n == nil || n.Resolved {
+		t.Errorf("Phase 4: api must be notified as down, got %+v", n)
+	}
+	if parent := manager.SuppressedBy("https://api.example.com"); parent != "" {
+		t.Errorf("Phase 4: api mustn't be suppressed anymore, got %q", parent)
+	}
+
+	// Phase 5: cyclic dependencies are rejected, even through other websites
+	if err := manager.DependsOn("https://lb.example.com", "https://www.example.com"); err == nil {
+		t.Error("Phase 5: Expected an error for a cyclic dependency")
+	}
+	if err := manager.DependsOn("https://lb.example.com", "https://lb.example.com"); err == nil {
+		t.Error("Phase 5: Expected an error for a website depending on itself")
+	}
+	if parent := manager.SuppressedBy("https://lb.example.com"); parent != "" {
+		t.Errorf("Phase 5: Expected rejected dependencies not to be declared, got %q", parent)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/notify"
+)
+
+// chanNotifier forwards notifications over a channel
+type chanNotifier chan *notify.Notification
+
+func (c chanNotifier) Notify(n *notify.Notification) error {
+	c <- n
+	return nil
+}
+
+// expectNotification waits for a notification on `c`
+func expectNotification(t *testing.T, c chanNotifier, phase string) *notify.Notification {
+	t.Helper()
+	select {
+	case n := <-c:
+		return n
+	case <-time.After(time.Second):
+		t.Fatalf("%s: expected a notification", phase)
+		return nil
+	}
+}
+
+// expectNoNotification checks that nothing was sent on `c`
+func expectNoNotification(t *testing.T, c chanNotifier, phase string) {
+	t.Helper()
+	select {
+	case n := <-c:
+		t.Errorf("%s: unexpected notification %+v", phase, n)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iseeu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+
+	primary, secondary := make(chanNotifier, 10), make(chanNotifier, 10)
+	notifiers := map[string]notify.Notifier{"chat": primary, "pager": secondary}
+	policy := config.EscalationConfig{
+		Primary:        "chat",
+		RepeatInterval: config.Duration(5 * time.Minute),
+		Secondary:      "pager",
+		EscalateAfter:  config.Duration(12 * time.Minute),
+	}
+	manager, err := incident.NewManager(policy, notifiers, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	manager.Handle(&metrics.Event{Url: "testurl", Alert: "availability", Severity: "critical", Time: start})
+	if n := expectNotification(t, primary, "Phase 1"); n.Resolved || n.Repeat != 0 {
+		t.Errorf("Phase 1: incident must be notified as opened, got %+v", n)
+	}
+	expectNoNotification(t, secondary, "Phase 1")
+
+	// re-notified every 5 minutes
+	manager.Tick(start.Add(4 * time.Minute))
+	expectNoNotification(t, primary, "Phase 2")
+	manager.Tick(start.Add(5 * time.Minute))
+	if n := expectNotification(t, primary, "Phase 2"); n.Repeat != 1 {
+		t.Errorf("Phase 2: incident must be repeated, got %+v", n)
+	}
+
+	// a restart doesn't reset escalation state
+	manager, err = incident.NewManager(policy, notifiers, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if incidents := manager.Incidents(); len(incidents) != 1 || incidents[0].Notifications != 2 {
+		t.Fatalf("Phase 3: incident must be restored from state file, got %+v", incidents)
+	}
+
+	// escalated to secondary after 12 minutes
+	manager.Tick(start.Add(12 * time.Minute))
+	expectNotification(t, primary, "Phase 3")
+	if n := expectNotification(t, secondary, "Phase 3"); !n.Escalated {
+		t.Errorf("Phase 3: incident must be escalated, got %+v", n)
+	}
+
+	// acknowledged incidents are neither repeated nor escalated
+	if count := manager.AcknowledgeAll(); count != 1 {
+		t.Errorf("Phase 4: expected 1 acknowledged incident, got %d", count)
+	}
+	manager.Tick(start.Add(time.Hour))
+	expectNoNotification(t, primary, "Phase 4")
+	expectNoNotification(t, secondary, "Phase 4")
+
+	// resolution is sent to both channels once escalated
+	manager.Handle(&metrics.Event{Url: "testurl", Alert: "availability", Resolved: true, Severity: "critical", Time: start.Add(time.Hour)})
+	expectNotification(t, primary, "Phase 5")
+	if n := expectNotification(t, secondary, "Phase 5"); !n.Resolved {
+		t.Errorf("Phase 5: incident must be notified as resolved, got %+v", n)
+	}
+	if incidents := manager.Incidents(); len(incidents) != 0 {
+		t.Errorf("Phase 5: incident must be closed, got %+v", incidents)
+	}
+}
+
+// slowNotifier forwards notifications over a channel, after a delay for the first notification of incidents
+type slowNotifier struct {
+	chanNotifier
+	delay time.Duration
+}
+
+func (s slowNotifier) Notify(n *notify.Notification) error {
+	if n.Repeat == 0 && !n.Resolved {
+		time.Sleep(s.delay)
+	}
+	return s.chanNotifier.Notify(n)
+}
+
+func TestNotificationOrder(t *testing.T) {
+	notifier := slowNotifier{chanNotifier: make(chanNotifier, 10), delay: 50 * time.Millisecond}
+	policy := config.EscalationConfig{Primary: "chat", RepeatInterval: config.Duration(5 * time.Minute)}
+	manager, err := incident.NewManager(policy, map[string]notify.Notifier{"chat": notifier}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// notifications of a channel arrive in order, even when the first one is slow to send
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	manager.Handle(&metrics.Event{Url: "testurl", Alert: "availability", Severity: "critical", Time: start})
+	manager.Tick(start.Add(5 * time.Minute))
+	manager.Handle(&metrics.Event{Url: "testurl", Alert: "availability", Resolved: true, Severity: "critical", Time: start.Add(6 * time.Minute)})
+	if n := expectNotification(t, notifier.chanNotifier, "Phase 1"); n.Resolved || n.Repeat != 0 {
+		t.Errorf("Phase 1: expected the incident to be notified as opened first, got %+v", n)
+	}
+	if n := expectNotification(t, notifier.chanNotifier, "Phase 1"); n.Resolved || n.Repeat != 1 {
+		t.Errorf("Phase 1: expected the incident to be repeated second, got %+v", n)
+	}
+	if n := expectNotification(t, notifier.chanNotifier, "Phase 1"); !n.Resolved {
+		t.Errorf("Phase 1: expected the incident to be notified as resolved last, got %+v", n)
+	}
+
+	// Close waits for queued notifications
+	manager.Handle(&metrics.Event{Url: "testurl", Alert: "availability", Severity: "critical", Time: start.Add(7 * time.Minute)})
+	if err := manager.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(notifier.chanNotifier) != 1 {
+		t.Errorf("Phase 2: expected Close to wait for the notification, got %d", len(notifier.chanNotifier))
+	}
+}
+
+func TestIncidentsRun(t *testing.T) {
+	primary := make(chanNotifier, 10)
+	policy := config.EscalationConfig{Primary: "chat", RepeatInterval: config.Duration(5 * time.Second)}
+	manager, err := incident.NewManager(policy, map[string]notify.Notifier{"chat": primary}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	manager.Clock = clk
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go manager.Run(ctx)
+
+	manager.Handle(&metrics.Event{Url: "testurl", Alert: "availability", Severity: "critical", Time: start})
+	expectNotification(t, primary, "Phase 1")
+
+	// incidents are repeated on ticks of the clock of the manager
+	deadline := time.After(time.Second)
+	for {
+		clk.Add(time.Second)
+		select {
+		case n := <-primary:
+			if n.Repeat != 1 || n.Time.Before(start.Add(5*time.Second)) {
+				t.Errorf("Phase 2: expected the incident to be repeated after 5s of the clock, got %+v", n)
+			}
+			return
+		case <-deadline:
+			t.Fatal("Phase 2: expected the incident to be repeated")
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
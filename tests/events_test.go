@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/api"
+	"github.com/NouamaneTazi/website-monitor/internal/broadcast"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+)
+
+func TestEventsStream(t *testing.T) {
+	initConfig()
+	config.HistoryRetention = time.Hour
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer website.Close()
+
+	incidents, err := incident.NewManager(config.EscalationConfig{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var server *api.Server
+	monitors := registry.New(func(m *registry.Monitor) {
+		m.Inspector.Pause() // only probe on demand
+		server.Watch(m)
+	}, nil)
+	defer monitors.Close(context.Background())
+	server = api.NewServer(monitors, incidents, nil)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	www, err := monitors.Add(website.URL+"/www", time.Second, "www", "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := monitors.Add(website.URL+"/db", time.Second, "db", "internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var streams []io.Closer
+	defer func() {
+		for _, stream := range streams {
+			stream.Close()
+		}
+	}()
+	connect := func(path string) *bufio.Reader {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: got %d", path, resp.StatusCode)
+		}
+		streams = append(streams, resp.Body)
+		return bufio.NewReader(resp.Body)
+	}
+	var report struct {
+		ID         string `json:"id"`
+		StatusCode int    `json:"status_code"`
+	}
+
+	// Phase 1: streams only get reports of the monitors they filter on, and are also served at /events
+	byTag, byMonitor := connect("/api/v1/events?tag=internal"), connect("/events?monitor=www")
+	connect("/api/v1/events") // never read
+	probe(t, www, 1)
+	probe(t, db, 1)
+	event, data := readEvent(t, byTag)
+	json.Unmarshal(data, &report)
+	if event != "report" || report.ID != "db" || report.StatusCode != http.StatusOK {
+		t.Fatalf("Phase 1: Expected a report of db, got %s %s", event, data)
+	}
+	event, data = readEvent(t, byMonitor)
+	json.Unmarshal(data, &report)
+	if event != "report" || report.ID != "www" {
+		t.Fatalf("Phase 1: Expected a report of www, got %s %s", event, data)
+	}
+
+	// Phase 2: probing isn't blocked by clients which don't read their stream (their buffer is full after 256 messages)
+	probe(t, db, 300)
+	event, data = readEvent(t, byTag)
+	json.Unmarshal(data, &report)
+	if event != "report" || report.ID != "db" {
+		t.Fatalf("Phase 2: Expected reports of db to keep streaming, got %s %s", event, data)
+	}
+
+	// Phase 3: reports filtered out of a stream don't fill its buffer
+	probe(t, www, 1)
+	event, data = readEvent(t, byMonitor)
+	json.Unmarshal(data, &report)
+	if event != "report" || report.ID != "www" {
+		t.Fatalf("Phase 3: Expected a report of www after 300 reports of db, got %s %s", event, data)
+	}
+}
+
+func TestHubWants(t *testing.T) {
+	hub := broadcast.NewHub()
+	report, monitor := &broadcast.Message{Event: "report", ID: "www"}, &broadcast.Message{Event: "monitor", ID: "www"}
+	if hub.Wants(report) {
+		t.Error("Phase 1: Expected no message to be wanted without subscribers")
+	}
+
+	// messages are only wanted by subscribers keeping them, so that dashboard updates aren't built for event streams
+	events := hub.Subscribe(1, func(msg *broadcast.Message) bool { return msg.Event == "report" })
+	if !hub.Wants(report) || hub.Wants(monitor) {
+		t.Error("Phase 2: Expected only reports to be wanted by an event stream")
+	}
+	all := hub.Subscribe(1, nil)
+	if !hub.Wants(monitor) {
+		t.Error("Phase 2: Expected every message to be wanted by a subscriber without filter")
+	}
+	hub.Unsubscribe(all)
+	hub.Unsubscribe(events)
+	if hub.Wants(report) {
+		t.Error("Phase 3: Expected no message to be wanted once subscribers left")
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+)
+
+// plugin writes a Nagios plugin script printing `output` and exiting with `code`, and returns the url of its exec check
+func plugin(t *testing.T, dir, name, output string, code int) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	script := fmt.Sprintf("#!/bin/sh\ncat <<'EOF'\n%s\nEOF\nexit %d\n", output, code)
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return "exec:" + path
+}
+
+func TestExecChecks(t *testing.T) {
+	initConfig()
+	config.HistoryRetention = time.Hour
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("exec checks need /bin/sh")
+	}
+	dir, err := ioutil.TempDir("", "iseeu-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Phase 1: exec urls of the configuration file are kept as given, they're rejected elsewhere, and their command must exist
+	okURL := plugin(t, dir, "check_ok", "LOAD OK - load average: 0.50 | load1=0.5;5;10;0 load5=0.25;4;8;0 'disk used'=42.5%;80;90", 0)
+	if url, err := inspect.ParseConfigURL(okURL + " -w 5"); err != nil || url != okURL+" -w 5" {
+		t.Errorf("Phase 1: Expected exec url to be kept, got %s %v", url, err)
+	}
+	if _, err := inspect.ParseURL(okURL); err == nil {
+		t.Error("Phase 1: Expected exec urls to be rejected outside of the configuration file")
+	}
+	if _, err := inspect.NewProber("exec:"+filepath.Join(dir, "missing"), time.Second); err == nil {
+		t.Error("Phase 1: Expected an error for a missing command")
+	}
+	if _, err := inspect.NewProber(okURL+" 'unterminated", time.Second); err == nil {
+		t.Error("Phase 1: Expected an error for an unterminated quote")
+	}
+
+	// Phase 2: exit codes are mapped to states, OK checks being up, WARNING ones up with a warning, and perfdata parsed into metrics
+	report := inspect.Probe(okURL, time.Second)
+	if report.Protocol != "exec" || report.StatusCode != 200 || report.Warning != "" || report.Details["state"] != "OK" || report.TotalDuration <= 0 {
+		t.Errorf("Phase 2: Expected OK check, got %+v", report)
+	}
+	if report.Details["output"] != "LOAD OK - load average: 0.50" {
+		t.Errorf("Phase 2: Expected output without perfdata, got %q", report.Details["output"])
+	}
+	if m := report.Metrics; m["load1"] != 0.5 || m["load5"] != 0.25 || m["disk used"] != 42.5 || m["state"] != 0 {
+		t.Errorf("Phase 2: Expected perfdata metrics, got %v", m)
+	}
+	report = inspect.Probe(plugin(t, dir, "check_warning", "LOAD WARNING | load1=6", 1), time.Second)
+	if report.StatusCode != 200 || report.Warning != "WARNING: LOAD WARNING" || report.Details["state"] != "WARNING" || report.Metrics["state"] != 1 {
+		t.Errorf("Phase 2: Expected WARNING check with a warning, got %+v", report)
+	}
+	report = inspect.Probe(plugin(t, dir, "check_critical", "LOAD CRITICAL", 2), time.Second)
+	if report.StatusCode != 0 || report.Details["exit_code"] != "2" || report.Error != "CRITICAL: LOAD CRITICAL" {
+		t.Errorf("Phase 2: Expected down CRITICAL check, got %+v", report)
+	}
+	report = inspect.Probe(plugin(t, dir, "check_unknown", "oops", 7), time.Second)
+	if report.StatusCode != 0 || report.Details["state"] != "UNKNOWN" || report.Metrics["state"] != 3 {
+		t.Errorf("Phase 2: Expected down UNKNOWN check, got %+v", report)
+	}
+
+	// Phase 3: commands running longer than the timeout are killed
+	start := time.Now()
+	report = inspect.Probe("exec:sleep 5", 100*time.Millisecond)
+	if report.Error == "" || report.TotalDuration != -1 || time.Since(start) > 2*time.Second {
+		t.Errorf("Phase 3: Expected timed out check, got %+v after %v", report, time.Since(start))
+	}
+	// even when the processes it started keep stdout open, and with the timeout of the prober
+	prober, err := inspect.NewProber(`exec:sh -c "sleep 5; true"`, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	report = prober.Probe(context.Background())
+	if report.Error == "" || time.Since(start) > 2*time.Second {
+		t.Errorf("Phase 3: Expected check timed out by its prober, got %+v after %v", report, time.Since(start))
+	}
+
+	// Phase 4: exec checks are monitored like websites, and alert rules use their metrics
+	monitors := registry.New(func(m *registry.Monitor) { m.Inspector.Pause() }, nil)
+	defer monitors.Close(context.Background())
+	m, err := monitors.Add(plugin(t, dir, "check_load", "LOAD WARNING | load1=6;5;10", 1), time.Second, "load")
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe(t, m, 2)
+	ruleset, err := rules.Compile([]config.RuleConfig{{Name: "high-load", Expr: "metric(load1, 1m) > 5 and metric(state, 1m) >= 1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := rules.NewEvaluator(ruleset)
+	for _, record := range m.Metrics.History(time.Time{}, time.Now()) {
+		ev.Update(record.Time, record.Report)
+	}
+	if ev.Alerts[0].State != rules.Firing {
+		t.Errorf("Phase 4: Expected rule on exec metrics to fire, got %v", ev.Alerts[0].State)
+	}
+	m.Metrics.Mu.RLock()
+	if !strings.HasPrefix(m.Url, "exec:") || m.Metrics.AggData.Window("short").StatusCodesCount[200] != 2 {
+		t.Errorf("Phase 4: Expected 2 up checks of %s, got %v", m.Url, m.Metrics.AggData.Window("short").StatusCodesCount)
+	}
+	if m.Metrics.Alert.Level() != metrics.Warning || m.Metrics.Alert.Warning != "WARNING: LOAD WARNING" {
+		t.Errorf("Phase 4: Expected a warning level for a WARNING check, got %v", m.Metrics.Alert.Level())
+	}
+	m.Metrics.Mu.RUnlock()
+	events := m.Metrics.Events()
+	if len(events) != 1 || events[0].Severity != "warning" || !strings.Contains(events[0].Message, "is degraded") {
+		t.Errorf("Phase 4: Expected a degraded event, got %+v", events)
+	}
+}
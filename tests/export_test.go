@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/export"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iseeu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.Open(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	for i, code := range []int{200, 200, 500, 200} {
+		report := &inspect.Report{Url: "https://a.com", PollingInterval: 30 * time.Minute, StatusCode: code,
+			ConnectDuration: 10 * time.Millisecond, FirstByteDuration: 20 * time.Millisecond, TotalDuration: 30 * time.Millisecond}
+		if code != 200 {
+			report.ConnectDuration, report.FirstByteDuration, report.TotalDuration = -1, -1, -1
+		}
+		store.AppendReport(&metrics.Record{Time: start.Add(time.Duration(i) * 30 * time.Minute), Report: report})
+	}
+	store.AppendReport(&metrics.Record{Time: start, Report: &inspect.Report{Url: "https://b.com", StatusCode: 200}})
+	store.AppendEvent(&metrics.Event{Url: "https://a.com", Alert: "availability", Severity: "critical", Message: "down", Time: start.Add(time.Hour)})
+
+	// Phase 1: CSV tables have a header and rows of the selected monitors
+	opts := export.Options{Interval: time.Hour, Monitors: []export.Monitor{{Url: "https://a.com", Name: "a"}}}
+	if err := export.Export(store, dir, "csv", opts); err != nil {
+		t.Fatal(err)
+	}
+	read := func(table string) [][]string {
+		f, err := os.Open(filepath.Join(dir, table+".csv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return records
+	}
+	reports := read("reports")
+	if len(reports) != 5 || !reflect.DeepEqual(reports[0], export.ReportColumns) {
+		t.Fatalf("Phase 1: Expected header and 4 reports, got %v", reports)
+	}
+	if strings.Join(reports[3], ",") != "2026-09-01T11:00:00Z,a,https://a.com,1800,500,-1,-1,-1" {
+		t.Errorf("Phase 1: Unexpected failed report row %v", reports[3])
+	}
+	rollups := read("rollups")
+	if len(rollups) != 3 {
+		t.Fatalf("Phase 1: Expected header and 2 hourly rollups, got %v", rollups)
+	}
+	if strings.Join(rollups[2], ",") != "2026-09-01T11:00:00Z,2026-09-01T12:00:00Z,a,https://a.com,2,1,0.5,200:1 500:1,10,20,30,30" {
+		t.Errorf("Phase 1: Unexpected rollup row %v", rollups[2])
+	}
+	if events := read("events"); len(events) != 2 || events[1][4] != "firing" {
+		t.Errorf("Phase 1: Expected the alert event, got %v", events)
+	}
+
+	// Phase 2: JSON tables hold every stored website by default, with typed values
+	if err := export.Export(store, dir, "json", export.Options{Interval: 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "rollups.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var days []map[string]interface{}
+	if err := json.Unmarshal(data, &days); err != nil {
+		t.Fatalf("Phase 2: Invalid JSON %s: %v", data, err)
+	}
+	if len(days) != 2 || days[0]["url"] != "https://a.com" || days[0]["probes"] != 4.0 || days[1]["url"] != "https://b.com" {
+		t.Errorf("Phase 2: Expected a daily rollup per website, got %v", days)
+	}
+	if strings.Index(string(data), `"start"`) > strings.Index(string(data), `"end"`) {
+		t.Errorf("Phase 2: Expected keys in column order, got %s", data)
+	}
+
+	// Phase 3: unknown formats are rejected
+	if err := export.Export(store, dir, "xlsx", opts); err == nil {
+		t.Errorf("Phase 3: Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+)
+
+func TestFlapping(t *testing.T) {
+	initConfig()
+	config.FlapDetectionInterval = 20 * time.Second
+	config.FlapHighThreshold = 0.5
+	config.FlapLowThreshold = 0.25
+	defer func() { config.FlapHighThreshold = 0 }()
+
+	reportc := make(chan *inspect.Report, 5)
+	pollingInterval := 1 * time.Second
+	errReport := &inspect.Report{Url: "testurl", PollingInterval: pollingInterval, StatusCode: 500,
+		ConnectDuration: -1, FirstByteDuration: -1, TotalDuration: -1}
+	availableReport := &inspect.Report{Url: "testurl", PollingInterval: pollingInterval, StatusCode: 200,
+		ConnectDuration: 10, FirstByteDuration: 5, TotalDuration: 20}
+
+	met := metrics.NewMetrics(reportc, pollingInterval, metrics.ConfigSettings())
+	processed := pacedReports(met, pollingInterval)
+	go met.ListenAndProcess() // listens for incoming reports
+	alert := met.Alert
+
+	// website oscillating between up and down
+	started := 0
+	for i := 0; i < 20; i++ {
+		if i%2 == 0 {
+			reportc <- errReport
+		} else {
+			reportc <- availableReport
+		}
+		<-processed // wait for the report to be processed
+		met.Mu.RLock()
+		if alert.FlappingStarted {
+			started++
+		}
+		if alert.Flapping && (alert.WebsiteWasDown || alert.WebsiteHasRecovered) {
+			t.Error("Phase 1: transitions must be suppressed while flapping")
+		}
+		met.Mu.RUnlock()
+	}
+	if started != 1 {
+		t.Errorf("Phase 1: website must start flapping exactly once, started %d times", started)
+	}
+
+	// website stabilizes
+	stopped := 0
+	for i := 0; i < 20; i++ {
+		reportc <- availableReport
+		<-processed // wait for the report to be processed
+		met.Mu.RLock()
+		if alert.FlappingStopped {
+			stopped++
+		}
+		met.Mu.RUnlock()
+	}
+	met.Mu.RLock()
+	defer met.Mu.RUnlock()
+	if stopped != 1 || alert.Flapping {
+		t.Errorf("Phase 2: website must stop flapping exactly once, stopped %d times", stopped)
+	}
+}
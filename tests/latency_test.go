@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+)
+
+func TestLatencyAlerting(t *testing.T) {
+	initConfig()
+	config.LatencyThreshold = 500 * time.Millisecond
+	config.LatencyAggregate = "avg"
+	config.LatencyPhase = "total"
+	defer func() { config.LatencyThreshold = 0 }()
+
+	reportc := make(chan *inspect.Report, 5)
+	pollingInterval := 1 * time.Second
+	slowReport := &inspect.Report{
+		Url:               "testurl",
+		PollingInterval:   pollingInterval,
+		StatusCode:        200,
+		ConnectDuration:   10 * time.Millisecond,
+		FirstByteDuration: 20 * time.Millisecond,
+		TotalDuration:     9 * time.Second,
+	}
+	fastReport := &inspect.Report{
+		Url:               "testurl",
+		PollingInterval:   pollingInterval,
+		StatusCode:        200,
+		ConnectDuration:   10 * time.Millisecond,
+		FirstByteDuration: 20 * time.Millisecond,
+		TotalDuration:     30 * time.Millisecond,
+	}
+
+	met := metrics.NewMetrics(reportc, pollingInterval, metrics.ConfigSettings())
+	processed := pacedReports(met, pollingInterval)
+	go met.ListenAndProcess() // listens for incoming reports
+	alert := met.Alert
+
+	// website slow although available
+	reportc <- slowReport
+	<-processed // wait for the report to be processed
+	met.Mu.RLock()
+	if !alert.LatencyIsHigh {
+		t.Error("Phase 1: Website latency is high")
+	}
+	if alert.WebsiteWasDown {
+		t.Error("Phase 1: Website wasn't down")
+	}
+	met.Mu.RUnlock()
+
+	// window still dominated by the slow report (avg of 10 reports > 500ms until 9s report leaves)
+	for i := 0; i < 9; i++ {
+		reportc <- fastReport
+		<-processed // wait for the report to be processed
+		met.Mu.RLock()
+		if !alert.LatencyIsHigh || alert.LatencyHasRecovered {
+			t.Errorf("Phase 2: Website latency is still high (latency=%v)", alert.Latency)
+		}
+		met.Mu.RUnlock()
+	}
+
+	// slow report leaves the window
+	reportc <- fastReport
+	<-processed // wait for the report to be processed
+	met.Mu.RLock()
+	if alert.LatencyIsHigh || !alert.LatencyHasRecovered {
+		t.Errorf("Phase 3: Website latency has recovered (latency=%v)", alert.Latency)
+	}
+	met.Mu.RUnlock()
+
+	reportc <- fastReport
+	<-processed // wait for the report to be processed
+	met.Mu.RLock()
+	if alert.LatencyHasRecovered {
+		t.Error("Phase 4: Website latency recovery is only reported once")
+	}
+	met.Mu.RUnlock()
+}
+
+func TestLatencyAggregates(t *testing.T) {
+	for _, tc := range []struct {
+		phase, aggregate string
+		valid            bool
+	}{
+		{"ttfb", "avg", true},
+		{"total", "max", true},
+		{"ttfb", "p95", true},
+		{"ttfb", "p0", false},
+		{"ttfb", "median", false},
+		{"connect", "avg", false},
+	} {
+		err := metrics.ValidateLatencyAlert(tc.phase, tc.aggregate)
+		if (err == nil) != tc.valid {
+			t.Errorf("ValidateLatencyAlert(%q, %q) = %v", tc.phase, tc.aggregate, err)
+		}
+	}
+}
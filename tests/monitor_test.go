@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/pkg/monitor"
+)
+
+// sinkRecorder records reports and alerts it receives as a monitor.Sink
+type sinkRecorder struct {
+	reports chan monitor.Report
+	alerts  chan monitor.Alert
+}
+
+func (s *sinkRecorder) Report(r monitor.Report) {
+	select {
+	case s.reports <- r:
+	default: // reports after the first ones aren't checked
+	}
+}
+
+func (s *sinkRecorder) Alert(a monitor.Alert) {
+	s.alerts <- a
+}
+
+func TestMonitorLibrary(t *testing.T) {
+	var failing int32
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer website.Close()
+	alerting := monitor.DefaultAlerting()
+	alerting.FlapHighThreshold, alerting.FlapLowThreshold = 0, 0
+	sink := &sinkRecorder{reports: make(chan monitor.Report, 4), alerts: make(chan monitor.Alert, 100)}
+
+	// Phase 1: invalid settings are rejected
+	if _, err := monitor.New(monitor.WithRules(monitor.Rule{Name: "bad", Expr: "availability(1m) <"})); err == nil {
+		t.Error("Phase 1: Expected an error for an invalid rule")
+	}
+	if _, err := monitor.New(monitor.WithAlerting(monitor.Alerting{CriticalAvailability: 2, LatencyAggregate: "avg", LatencyPhase: "ttfb"})); err == nil {
+		t.Error("Phase 1: Expected an error for an invalid critical availability")
+	}
+	if _, err := monitor.New(monitor.WithAlerting(monitor.Alerting{LatencyThreshold: time.Second})); err != nil {
+		t.Errorf("Phase 1: Expected unset alert settings to default, got %v", err)
+	}
+	cyclic, err := monitor.New(monitor.WithTargets(
+		monitor.Target{URL: website.URL + "/a", Interval: time.Second, Name: "a", DependsOn: []string{"b"}},
+		monitor.Target{URL: website.URL + "/b", Interval: time.Second, Name: "b", DependsOn: []string{"a"}},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cyclic.Start(context.Background()); err == nil {
+		t.Error("Phase 1: Expected an error for cyclic dependencies")
+	}
+	if snapshots := cyclic.Snapshots(); len(snapshots) != 0 {
+		t.Errorf("Phase 1: Expected a failed start to remove its monitors, got %+v", snapshots)
+	}
+	if err := cyclic.Start(context.Background()); err == nil || err.Error() == "monitor already started" {
+		t.Errorf("Phase 1: Expected a failed start to be retried, got %v", err)
+	}
+	cyclic.Stop(context.Background())
+
+	m, err := monitor.New(
+		monitor.WithTargets(
+			monitor.Target{URL: website.URL, Interval: 20 * time.Millisecond, Name: "www", Tags: []string{"public"}},
+			monitor.Target{URL: website.URL + "/api", Interval: 20 * time.Millisecond, Name: "api", DependsOn: []string{"www"}},
+		),
+		monitor.WithWindows(monitor.Windows{Stats: []monitor.Window{{Name: "short", Duration: 100 * time.Millisecond}, {Name: "long", Duration: time.Second}},
+			Alert: 40 * time.Millisecond}),
+		monitor.WithAlerting(alerting),
+		monitor.WithSink(sink),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// settings belong to each monitor, those of another one don't change them
+	other, err := monitor.New(monitor.WithWindows(monitor.Windows{Stats: []monitor.Window{{Name: "day", Duration: 24 * time.Hour}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Stop(context.Background())
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop(context.Background())
+
+	// Phase 2: targets are probed and their reports sent to sinks
+	timeout := time.After(5 * time.Second)
+	for n := 0; n < cap(sink.reports); n++ {
+		select {
+		case <-sink.reports:
+		case <-timeout:
+			t.Fatalf("Phase 2: Expected reports, got %d", n)
+		}
+	}
+	s, ok := m.Snapshot("www")
+	if !ok || s.URL != website.URL || s.Availability != 1 || len(s.Stats) != 2 || s.Stats[0].StatusCodes[200] == 0 || s.Down {
+		t.Errorf("Phase 2: Expected www to be up, got %+v", s)
+	}
+	if snapshots := m.Snapshots(); len(snapshots) != 2 || snapshots[1].ID != "api" {
+		t.Errorf("Phase 2: Expected snapshots of both targets, got %+v", snapshots)
+	}
+
+	// Phase 3: alerts are sent to subscribers, with the id of their monitor
+	alerts := make(chan monitor.Alert, 100)
+	m.SubscribeAlerts(func(a monitor.Alert) { alerts <- a })
+	atomic.StoreInt32(&failing, 1)
+	for {
+		select {
+		case a := <-alerts:
+			if a.ID != "www" || a.Alert != "availability" || a.Resolved {
+				continue
+			}
+			if a.URL != website.URL || a.Severity != "critical" {
+				t.Errorf("Phase 3: Unexpected alert %+v", a)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Phase 3: Expected an availability alert")
+		}
+		break
+	}
+	if s, _ := m.Snapshot("www"); !s.Down || s.Availability == 1 {
+		t.Errorf("Phase 3: Expected www to be down, got %+v", s)
+	}
+
+	// Phase 4: targets whose polling interval doesn't fit in windows are rejected, and stopping stops probing
+	if err := m.Add(monitor.Target{URL: website.URL + "/slow", Interval: time.Second}); err == nil {
+		t.Error("Phase 4: Expected an error for a polling interval longer than windows")
+	}
+	if err := m.Stop(context.Background()); err != nil {
+		t.Errorf("Phase 4: Expected monitor to stop, got %v", err)
+	}
+	if err := m.Add(monitor.Target{URL: website.URL + "/other", Interval: 20 * time.Millisecond}); err == nil {
+		t.Error("Phase 4: Expected an error adding a target to a stopped monitor")
+	}
+}
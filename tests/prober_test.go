@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+)
+
+// echoProber is a check type which succeeds unless its url has a "fail" query
+type echoProber struct {
+	url string
+}
+
+func (p echoProber) Probe(ctx context.Context) *inspect.Report {
+	report := &inspect.Report{Url: p.url, Protocol: "echo", StatusCode: 200, ConnectDuration: -1, FirstByteDuration: -1,
+		TotalDuration: time.Millisecond, Details: map[string]string{"echo": p.url}}
+	if p.url == "echo://target?fail" {
+		report.StatusCode, report.Error = 0, "failed"
+	}
+	return report
+}
+
+func TestProbers(t *testing.T) {
+	initConfig()
+	config.HistoryRetention = time.Hour
+	inspect.Register("echo", func(url string, timeout time.Duration) (inspect.Prober, error) {
+		if timeout <= 0 {
+			return nil, errors.New("timeout must be positive")
+		}
+		return echoProber{url}, nil
+	})
+
+	// Phase 1: urls of unregistered schemes are rejected
+	if _, err := inspect.ParseURL("gopher://example.com"); err == nil {
+		t.Error("Phase 1: Expected an error for an unsupported scheme")
+	}
+	if url, err := inspect.ParseURL("echo://target"); err != nil || url != "echo://target" {
+		t.Errorf("Phase 1: Expected registered scheme to be kept, got %s %v", url, err)
+	}
+	if report := inspect.Probe("gopher://example.com", time.Second); report.Error == "" || report.TotalDuration != -1 {
+		t.Errorf("Phase 1: Expected a failed report, got %+v", report)
+	}
+
+	// Phase 2: monitors of registered schemes are scheduled and processed like websites
+	monitors := registry.New(func(m *registry.Monitor) { m.Inspector.Pause() }, nil)
+	defer monitors.Close(context.Background())
+	if _, err := monitors.Add("gopher://example.com", time.Second, ""); err == nil {
+		t.Error("Phase 2: Expected an error adding a monitor of an unsupported scheme")
+	}
+	up, err := monitors.Add("echo://target", time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down, err := monitors.Add("echo://target?fail", time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe(t, up, 2)
+	probe(t, down, 1)
+	history := up.Metrics.History(time.Time{}, time.Now())
+	if r := history[0].Report; r.Protocol != "echo" || r.Details["echo"] != "echo://target" || r.PollingInterval != time.Second {
+		t.Errorf("Phase 2: Expected echo report, got %+v", r)
+	}
+	up.Metrics.Mu.RLock()
+	if up.Metrics.AggData.Window("short").StatusCodesCount[200] != 2 {
+		t.Errorf("Phase 2: Expected 2 successful checks, got %v", up.Metrics.AggData.Window("short").StatusCodesCount)
+	}
+	up.Metrics.Mu.RUnlock()
+	if r := down.Metrics.History(time.Time{}, time.Now())[0].Report; r.StatusCode != 0 || r.Error != "failed" {
+		t.Errorf("Phase 2: Expected failed report, got %+v", r)
+	}
+
+	// Phase 3: HTTP checks report their protocol, and give up when their context is done
+	release := make(chan struct{}) // slow requests hang until the end of the test, or until they're canceled
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer website.Close()
+	defer close(release)
+	if report := inspect.Probe(website.URL, time.Second); report.Protocol != "http" || report.StatusCode != 200 || report.TotalDuration <= 0 {
+		t.Errorf("Phase 3: Expected successful HTTP report, got %+v", report)
+	}
+	prober, err := inspect.NewProber(website.URL+"/slow", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if report := prober.Probe(ctx); report.Error == "" || report.TotalDuration != -1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Phase 3: Expected HTTP check to give up on cancellation, got %+v after %v", report, time.Since(start))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/replay"
+)
+
+func TestReplay(t *testing.T) {
+	initConfig()
+	config.FlapHighThreshold = 0
+	config.LatencyThreshold = 0
+	start := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	var records []*metrics.Record
+	for i := 0; i < 60; i++ {
+		for _, url := range []string{"https://a.com", "https://b.com"} {
+			report := &inspect.Report{Url: url, PollingInterval: 5 * time.Second, StatusCode: 200}
+			if url == "https://a.com" && i >= 20 && i < 30 {
+				report.StatusCode, report.ConnectDuration, report.FirstByteDuration, report.TotalDuration = 500, -1, -1, -1
+			}
+			records = append(records, &metrics.Record{Time: start.Add(time.Duration(i) * 5 * time.Second), Report: report})
+		}
+	}
+
+	// Phase 1: alerts fire at the time of recorded reports, an hour of reports being replayed at once
+	began := time.Now()
+	result, err := replay.Run(records, replay.Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(began) > 5*time.Second {
+		t.Errorf("Phase 1: Expected replay to be faster than real time, took %v", time.Since(began))
+	}
+	if result.Reports != 120 || len(result.Urls) != 2 {
+		t.Fatalf("Phase 1: Expected 120 reports of 2 websites, got %d of %v", result.Reports, result.Urls)
+	}
+	if len(result.Alerts) != 1 || result.Alerts[0].Url != "https://a.com" || result.Alerts[0].Fired != 1 || result.Alerts[0].Ongoing {
+		t.Fatalf("Phase 1: Expected a.com to go down once, got %+v", result.Alerts)
+	}
+	// the alert interval holds 2 reports: a.com is down from its 1st error to its 2nd success
+	if firing := result.Alerts[0].Firing; firing != 55*time.Second {
+		t.Errorf("Phase 1: Expected a.com to be down for 55s, got %v", firing)
+	}
+	for _, e := range result.Events {
+		if e.Url == "https://a.com" && !e.Resolved && !e.Time.Equal(start.Add(100*time.Second)) {
+			t.Errorf("Phase 1: Expected a.com to go down at its 1st error, got %v", e.Time)
+		}
+	}
+
+	// Phase 2: a lower critical availability doesn't alert on the same outage
+	config.CriticalAvailability = 0
+	result, err = replay.Run(records, replay.Options{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Alerts) != 0 {
+		t.Errorf("Phase 2: Expected no alert, got %+v", result.Alerts)
+	}
+
+	// Phase 3: reports without polling interval can't be replayed
+	records[0].Report.PollingInterval = 0
+	if _, err := replay.Run(records, replay.Options{}, nil); err == nil {
+		t.Errorf("Phase 3: Expected an error for a report without polling interval")
+	}
+
+	// Phase 4: alert transitions are passed to the callback in the order of time, across websites
+	records[0].Report.PollingInterval = 5 * time.Second
+	config.CriticalAvailability = 0.8
+	for _, r := range records {
+		if r.Report.Url == "https://b.com" && r.Time.Sub(start)/(5*time.Second)%4 == 0 {
+			r.Report.StatusCode, r.Report.ConnectDuration, r.Report.FirstByteDuration, r.Report.TotalDuration = 500, -1, -1, -1
+		}
+	}
+	var last time.Time
+	transitions := 0
+	_, err = replay.Run(records, replay.Options{}, func(e *metrics.Event) {
+		if e.Time.Before(last) {
+			t.Errorf("Phase 4: Expected transitions in the order of time, got %v after %v", e.Time, last)
+		}
+		last = e.Time
+		transitions++
+		time.Sleep(time.Millisecond) // slow callbacks must not let other websites' transitions overtake
+
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transitions < 4 {
+		t.Errorf("Phase 4: Expected both websites to go down and recover, got %d transitions", transitions)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+	"github.com/NouamaneTazi/website-monitor/internal/uptime"
+)
+
+func TestUptimeReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iseeu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := func(url string, at time.Time, statusCode int, duration time.Duration) {
+		if statusCode != 200 {
+			duration = -1
+		}
+		err := store.AppendReport(&metrics.Record{Time: at, Report: &inspect.Report{
+			Url: url, PollingInterval: time.Hour, StatusCode: statusCode,
+			ConnectDuration: duration, FirstByteDuration: duration, TotalDuration: duration,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	event := func(url, alert, severity string, resolved bool, at time.Time) {
+		err := store.AppendEvent(&metrics.Event{Url: url, Alert: alert, Resolved: resolved, Severity: severity, Message: "Website " + url + " | " + alert, Time: at})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	api, www := "https://api.example.com", "https://www.example.com"
+	september := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	// Phase 1: periods are calendar months, years or days
+	period, err := uptime.ParsePeriod("2026-09")
+	if err != nil || !period.From.Equal(september) || !period.To.Equal(september.AddDate(0, 1, 0)) {
+		t.Fatalf("Phase 1: Expected september 2026, got %+v (%v)", period, err)
+	}
+	if p, err := uptime.ParsePeriod("2026"); err != nil || !p.To.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Phase 1: Expected the year 2026, got %+v (%v)", p, err)
+	}
+	if _, err := uptime.ParsePeriod("2026-13"); err == nil {
+		t.Error("Phase 1: Expected an error for an invalid month")
+	}
+	if p := uptime.LastMonth(now); p != period {
+		t.Errorf("Phase 1: Expected the last month to be september, got %+v", p)
+	}
+
+	// hourly reports over september, and just around it: www is always up, api fails 36 times
+	report(api, september.Add(-time.Hour), 500, 0)
+	report(api, september.AddDate(0, 1, 0), 500, 0)
+	for i := 0; i < 30*24; i++ {
+		at := september.Add(time.Duration(i) * time.Hour)
+		report(www, at, 200, 20*time.Millisecond)
+		switch {
+		case i%20 == 0:
+			report(api, at, 500, 0)
+		case i == 1:
+			report(api, at, 200, 100*time.Millisecond)
+		default:
+			report(api, at, 200, 20*time.Millisecond)
+		}
+	}
+	// api outages: one started before september, one was a warning going critical, one was resolved after september
+	event(api, "availability", "critical", false, september.Add(-10*time.Minute))
+	event(api, "availability", "critical", true, september.Add(10*time.Minute))
+	event(api, "latency", "critical", false, september.AddDate(0, 0, 5))
+	event(api, "availability", "warning", false, september.AddDate(0, 0, 9).Add(10*time.Hour))
+	event(api, "availability", "critical", false, september.AddDate(0, 0, 9).Add(10*time.Hour+5*time.Minute))
+	event(api, "availability", "warning", false, september.AddDate(0, 0, 9).Add(10*time.Hour+35*time.Minute))
+	event(api, "availability", "warning", true, september.AddDate(0, 0, 9).Add(10*time.Hour+40*time.Minute))
+	event(api, "availability", "critical", false, september.AddDate(0, 1, 0).Add(-30*time.Minute))
+	event(api, "availability", "critical", true, september.AddDate(0, 1, 0).Add(30*time.Minute))
+
+	// Phase 2: uptime, outages and their MTTR and MTBF are computed over the period
+	check := func(phase string) {
+		r, err := uptime.Build(store, []uptime.Site{{Url: api, Name: "api"}, {Url: www}}, period, now)
+		if err != nil {
+			t.Fatalf("%s: %v", phase, err)
+		}
+		if len(r.Sites) != 2 || r.Partial() {
+			t.Fatalf("%s: Expected a complete report of 2 sites, got %+v", phase, r)
+		}
+		a, w := r.Sites[0], r.Sites[1]
+		if a.Probes != 720 || a.Up != 684 || r.Uptime(a) != 1-float64(70*time.Minute)/float64(30*24*time.Hour) || r.Uptime(w) != 1 || w.Name != www {
+			t.Errorf("%s: Expected 720 probes and the uptime of api to exclude its downtime, 100%% for www, got %d, %v and %v", phase, a.Probes, r.Uptime(a), r.Uptime(w))
+		}
+		if a.Latency == nil || a.Latency.Min != 20*time.Millisecond || a.Latency.Max != 100*time.Millisecond {
+			t.Errorf("%s: Expected latencies between 20ms and 100ms, got %+v", phase, a.Latency)
+		}
+		if len(a.Outages) != 3 || a.Downtime() != 70*time.Minute || a.LongestOutage() != 30*time.Minute || a.MTTR() != 70*time.Minute/3 {
+			t.Fatalf("%s: Expected 3 outages lasting 70m, got %d lasting %v", phase, len(a.Outages), a.Downtime())
+		}
+		if !a.Outages[0].Start.Equal(september) || !a.Outages[2].End.Equal(period.To) || a.Outages[2].Ongoing {
+			t.Errorf("%s: Expected outages to be clipped to the period, got %+v and %+v", phase, a.Outages[0], a.Outages[2])
+		}
+		if mtbf := r.MTBF(a); mtbf != (30*24*time.Hour-70*time.Minute)/3 {
+			t.Errorf("%s: Expected the uptime divided by the 3 outages, got %v", phase, mtbf)
+		}
+		if len(w.Outages) != 0 || w.MTTR() != -1 || r.MTBF(w) != -1 {
+			t.Errorf("%s: Expected no outage for www, got %+v", phase, w.Outages)
+		}
+	}
+	check("Phase 2")
+
+	// Phase 3: the report is the same once reports are rolled up and raw reports removed
+	if err := store.Compact(now, config.Retention{Raw: 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	check("Phase 3")
+
+	// Phase 4: the current period is partial, with ongoing outages, and future periods are rejected
+	event(www, "availability", "critical", false, now.Add(-time.Hour))
+	october, _ := uptime.ParsePeriod("2026-10")
+	r, err := uptime.Build(store, nil, october, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Partial() || r.Observed != now.Sub(october.From) || len(r.Sites) != 1 || r.Sites[0].Url != api {
+		t.Fatalf("Phase 4: Expected a partial report of the stored websites, got %+v", r)
+	}
+	if r, _ := uptime.Build(store, []uptime.Site{{Url: www}}, october, now); len(r.Sites[0].Outages) != 1 || !r.Sites[0].Outages[0].Ongoing || r.Sites[0].Downtime() != time.Hour {
+		t.Errorf("Phase 4: Expected an ongoing outage of an hour, got %+v", r.Sites[0].Outages)
+	}
+	if _, err := uptime.Build(store, nil, uptime.Period{Name: "2027", From: now.AddDate(1, 0, 0), To: now.AddDate(2, 0, 0)}, now); err == nil {
+		t.Error("Phase 4: Expected an error for a period which hasn't started")
+	}
+
+	// Phase 5: reports are rendered as Markdown, HTML or JSON
+	r, err = uptime.Build(store, []uptime.Site{{Url: api, Name: "api"}, {Url: www, Name: "www"}}, period, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var markdown, html, js bytes.Buffer
+	for format, buf := range map[string]*bytes.Buffer{"markdown": &markdown, "html": &html, "json": &js} {
+		if err := uptime.Render(buf, r, format); err != nil {
+			t.Fatalf("Phase 5: %v", err)
+		}
+	}
+	for _, expected := range []string{"# Uptime report 2026-09", "| api | 99.83% | 3 | 1h 10m | 23m 20s | 9d 23h | 30m |", "| www | 100.00% | 0 | 0s | - | - | 0s |", `api.example.com \| availability`} {
+		if !strings.Contains(markdown.String(), expected) {
+			t.Errorf("Phase 5: Expected %q in the markdown report:\n%s", expected, markdown.String())
+		}
+	}
+	if !strings.Contains(html.String(), "<td>99.83%</td>") || !strings.Contains(html.String(), "api.example.com | availability") {
+		t.Errorf("Phase 5: Expected uptimes and incidents in the html report:\n%s", html.String())
+	}
+	var decoded struct {
+		Sites []struct {
+			Uptime  *float64 `json:"uptime"`
+			MTTR    *float64 `json:"mttr_s"`
+			Outages []struct {
+				Duration float64 `json:"duration_s"`
+			} `json:"outages"`
+		} `json:"sites"`
+	}
+	if err := json.Unmarshal(js.Bytes(), &decoded); err != nil || len(decoded.Sites) != 2 {
+		t.Fatalf("Phase 5: Expected a json report of 2 sites, got %v: %s", err, js.String())
+	}
+	if a, w := decoded.Sites[0], decoded.Sites[1]; a.MTTR == nil || *a.MTTR != 1400 || len(a.Outages) != 3 || a.Outages[0].Duration != 600 || w.MTTR != nil {
+		t.Errorf("Phase 5: Expected api MTTR in seconds and none for www, got %s", js.String())
+	}
+	if err := uptime.Render(&bytes.Buffer{}, r, "pdf"); err == nil {
+		t.Error("Phase 5: Expected an error for an unknown format")
+	}
+
+	// Phase 6: outages still open when the monitor was stopped end once the site is probed up after its restart,
+	// unless it was still down then, the restarted monitor raising the alert again
+	shop, blog := "https://shop.example.com", "https://blog.example.com"
+	august := time.Date(2026, 8, 10, 0, 0, 0, 0, time.UTC)
+	minutely := func(url string, from, to time.Time, statusCode int) {
+		for at := from; at.Before(to); at = at.Add(time.Minute) {
+			err := store.AppendReport(&metrics.Record{Time: at, Report: &inspect.Report{Url: url, PollingInterval: time.Minute,
+				StatusCode: statusCode, ConnectDuration: -1, FirstByteDuration: -1, TotalDuration: -1}})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, url := range []string{shop, blog} {
+		minutely(url, august, august.Add(30*time.Minute), 200)
+		minutely(url, august.Add(30*time.Minute), august.Add(45*time.Minute), 500)
+		event(url, "availability", "critical", false, august.Add(40*time.Minute))
+	}
+	minutely(shop, august.Add(3*time.Hour), august.Add(4*time.Hour), 200)
+	minutely(blog, august.Add(3*time.Hour), august.Add(3*time.Hour+10*time.Minute), 500)
+	minutely(blog, august.Add(3*time.Hour+10*time.Minute), august.Add(4*time.Hour), 200)
+	event(blog, "availability", "critical", false, august.Add(3*time.Hour+time.Minute))
+	event(blog, "availability", "critical", true, august.Add(3*time.Hour+15*time.Minute))
+	day, _ := uptime.ParsePeriod("2026-08-10")
+	for _, phase := range []string{"raw reports", "rollups"} {
+		r, err := uptime.Build(store, []uptime.Site{{Url: shop}, {Url: blog}}, day, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, b := r.Sites[0], r.Sites[1]
+		if len(s.Outages) != 1 || s.Outages[0].Ongoing || !s.Outages[0].End.Equal(august.Add(3*time.Hour)) {
+			t.Errorf("Phase 6: Expected the outage of shop to end once it was up after the restart (%s), got %+v", phase, s.Outages)
+		}
+		if len(b.Outages) != 1 || !b.Outages[0].End.Equal(august.Add(3*time.Hour+15*time.Minute)) {
+			t.Errorf("Phase 6: Expected the outage of blog to end with its resolution (%s), got %+v", phase, b.Outages)
+		}
+		if err := store.Compact(now, config.Retention{Raw: 24 * time.Hour}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Phase 7: sites monitored after the period started are observed since their first report
+	if store, err = storage.Open(filepath.Join(dir, "status")); err != nil {
+		t.Fatal(err)
+	}
+	status := "https://status.example.com"
+	for i := 15 * 24; i < 30*24; i++ {
+		report(status, september.Add(time.Duration(i)*time.Hour), 200, 20*time.Millisecond)
+	}
+	event(status, "availability", "critical", false, september.AddDate(0, 0, 20))
+	event(status, "availability", "critical", true, september.AddDate(0, 0, 20).Add(time.Hour))
+	r, err = uptime.Build(store, []uptime.Site{{Url: status}}, period, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := r.Sites[0]; s.Observed != 15*24*time.Hour || r.Uptime(s) != 1-float64(time.Hour)/float64(15*24*time.Hour) || r.MTBF(s) != 15*24*time.Hour-time.Hour {
+		t.Errorf("Phase 7: Expected the uptime and MTBF of status over the 15 days it was observed, got %v, %v and %v", s.Observed, r.Uptime(s), r.MTBF(s))
+	}
+}
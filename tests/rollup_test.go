@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+func TestRollups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iseeu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "https://www.example.com"
+	report := func(at time.Time, statusCode int, total time.Duration) {
+		if err := store.AppendReport(&metrics.Record{Time: at, Report: &inspect.Report{Url: url, PollingInterval: time.Second,
+			StatusCode: statusCode, ConnectDuration: -1, FirstByteDuration: -1, TotalDuration: total}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rollups := func(from, to time.Time, step time.Duration) []*storage.Rollup {
+		var rollups []*storage.Rollup
+		if err := store.Rollups(from, to, step, func(r *storage.Rollup) error {
+			rollups = append(rollups, r)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return rollups
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	// two days ago: 3 reports in the same minute, then one failure an hour later; yesterday: 2 reports; today: 1 report
+	now := time.Date(2026, 9, 10, 12, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 9, 8, 0, 0, 0, 0, time.UTC)
+	report(day.Add(10*time.Second), 200, 40*time.Millisecond)
+	report(day.Add(20*time.Second), 200, 300*time.Millisecond)
+	report(day.Add(30*time.Second), 301, 3*time.Second)
+	report(day.Add(time.Hour), 0, -1)
+	report(day.AddDate(0, 0, 1).Add(time.Hour), 200, 10*time.Millisecond)
+	report(day.AddDate(0, 0, 1).Add(2*time.Hour), 200, 10*time.Millisecond)
+	report(now, 200, 10*time.Millisecond)
+
+	// Phase 1: before compaction, rollups are computed from raw reports
+	minutes := rollups(day, day.Add(24*time.Hour-time.Nanosecond), time.Minute)
+	if len(minutes) != 2 || minutes[0].Count != 3 || minutes[0].Successes != 2 || minutes[1].Count != 1 || minutes[1].Latencies != 0 {
+		t.Fatalf("Phase 1: Expected 2 minutes of 3 and 1 reports, got %+v", minutes)
+	}
+	m := minutes[0]
+	if m.LatencyMin != 40 || m.LatencyMax != 3000 || m.LatencySum != 3340 || m.StatusCodes[301] != 1 || m.Buckets[0] != 1 ||
+		m.Buckets[3] != 1 || m.Buckets[6] != 1 || m.Last != day.Add(30*time.Second) || m.LastStatusCode != 301 {
+		t.Errorf("Phase 1: Unexpected aggregates %+v", m)
+	}
+	if m.Percentile(50) != 500*time.Millisecond || m.Percentile(100) != 3*time.Second || m.AvgLatency() != 3340*time.Millisecond/3 {
+		t.Errorf("Phase 1: Unexpected latency estimates p50=%v p100=%v avg=%v", m.Percentile(50), m.Percentile(100), m.AvgLatency())
+	}
+
+	// Phase 2: compaction rolls up the days which are over, and deletes raw reports older than their retention
+	retention, err := config.ParseRetention("raw=1d,minute=2d", config.Retention{Hour: 90 * 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Compact(now, retention); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]bool{
+		"reports-2026-09-08.ndjson": false, "rollups-minute-2026-09-08.ndjson": true, "rollups-hour-2026-09-08.ndjson": true,
+		"rollups-day-2026-09-08.ndjson": true, "reports-2026-09-09.ndjson": true, "rollups-day-2026-09-09.ndjson": true,
+		"reports-2026-09-10.ndjson": true, "rollups-day-2026-09-10.ndjson": false,
+	} {
+		if exists(name) != expected {
+			t.Errorf("Phase 2: Expected %s to exist: %v", name, expected)
+		}
+	}
+	if err := store.Compact(now, retention); err != nil {
+		t.Errorf("Phase 2: Compaction must be idempotent, got %v", err)
+	}
+
+	// Phase 3: queries pick the resolution, and read each day from the coarsest tier fine enough
+	days := rollups(day, now, 24*time.Hour)
+	if len(days) != 3 || days[0].Count != 4 || days[0].Successes != 2 || days[1].Count != 2 || days[2].Count != 1 || days[0].Time != day {
+		t.Fatalf("Phase 3: Expected 3 days of 4, 2 and 1 reports, got %+v", days)
+	}
+	if days[0].LatencyMax != 3000 || days[0].Buckets[6] != 1 || days[0].StatusCodes[0] != 1 {
+		t.Errorf("Phase 3: Expected aggregates to be rolled up, got %+v", days[0])
+	}
+	hours := rollups(day, day.Add(24*time.Hour-time.Nanosecond), 0)
+	if len(hours) != 2 || hours[0].Count != 3 || time.Duration(hours[0].Step) != time.Hour {
+		t.Errorf("Phase 3: Expected hourly rollups of a day, got %+v", hours)
+	}
+	if minutes := rollups(day, day.Add(time.Minute), time.Minute); len(minutes) != 1 || minutes[0].Count != 3 {
+		t.Errorf("Phase 3: Expected minutes to be read from the minute tier, got %+v", minutes)
+	}
+
+	// Phase 4: once the finer tiers are deleted, coarser tiers are used
+	if err := store.Compact(now.AddDate(0, 0, 2), retention); err != nil {
+		t.Fatal(err)
+	}
+	if exists("rollups-minute-2026-09-08.ndjson") || !exists("rollups-hour-2026-09-08.ndjson") {
+		t.Error("Phase 4: Expected minute rollups to be deleted after their retention")
+	}
+	if minutes := rollups(day, day.Add(time.Minute), time.Minute); len(minutes) != 1 || minutes[0].Count != 3 ||
+		time.Duration(minutes[0].Step) != time.Hour {
+		t.Errorf("Phase 4: Expected hourly rollups instead of minutes, got %+v", minutes)
+	}
+
+	// Phase 5: retentions must not be negative, nor shorter for coarser tiers
+	for _, s := range []string{"raw=-1h", "raw=30d,minute=7d", "raw=0,minute=7d", "week=7d", "raw"} {
+		if _, err := config.ParseRetention(s, config.Retention{}); err == nil {
+			t.Errorf("Phase 5: Expected %q to be invalid", s)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/rules"
+)
+
+func TestRulesCompile(t *testing.T) {
+	for _, tc := range []struct {
+		expr  string
+		valid bool
+	}{
+		{"availability(5m) < 0.95 and p95(ttfb, 5m) > 800ms", true},
+		{"not (error_rate(1m) >= 5%) || max(total, 30s) > 2s", true},
+		{"count(1m) == 0", true},
+		{"availability(5m)", false},              // not a comparison
+		{"availability(5m) < 0.95 and 1", false}, // operand of and is not a comparison
+		{"p95(dns, 5m) > 800ms", false},          // unknown phase
+		{"median(ttfb, 5m) > 800ms", false},      // unknown function
+		{"availability(5m) < 0.95 and", false},   // missing operand
+		{"availability(5) < 0.95", false},        // window without unit
+		{"(availability(5m) < 0.95", false},      // missing parenthesis
+		{"availability(5m) < 0.95 @ 1", false},   // unknown character
+		{"(availability(5m) < 0.95) < 1", false}, // comparing a boolean
+		{"avg(ttfb 5m) > 800ms", false},          // missing comma
+		{"p101(ttfb, 5m) > 800ms", false},        // invalid percentile
+		{"availability(5m) = 0.95", false},       // unknown operator
+		{"availability(5m) < 0.95 0.95", false},  // trailing token
+		{"availability(-5m) < 0.95", false},      // negative window
+		{"availability(5m) <= 0.95 or not p50(connect, 1m) != 1", true},
+		{"metric(load1, 5m) > 4 and metric(state, 1m) >= 1", true},
+		{"metric(5m) > 4", false},    // missing metric name
+		{"metric(load1) > 4", false}, // missing window
+		{"availability(1h30m) < 0.95 and p95(ttfb, 2m30s) > 1.5s", true},
+		{"availability(1h30) < 0.95", false}, // compound window without unit
+	} {
+		_, err := rules.Compile([]config.RuleConfig{{Name: "rule", Expr: tc.expr}})
+		if (err == nil) != tc.valid {
+			t.Errorf("Compile(%q) = %v", tc.expr, err)
+		}
+	}
+
+	if _, err := rules.Compile([]config.RuleConfig{{Name: "a", Expr: "count(1m) > 0"}, {Name: "a", Expr: "count(1m) > 0"}}); err == nil {
+		t.Error("Compile must reject duplicate rule names")
+	}
+	if _, err := rules.Compile([]config.RuleConfig{{Name: "a", Expr: "count(1m) > 0", Severity: "fatal"}}); err == nil {
+		t.Error("Compile must reject unknown severities")
+	}
+}
+
+func TestRulesEvaluator(t *testing.T) {
+	ruleset, err := rules.Compile([]config.RuleConfig{{
+		Name:     "slow-and-down",
+		Expr:     "availability(10s) < 0.95 and p95(ttfb, 10s) > 800ms",
+		Severity: "warning",
+		For:      config.Duration(3 * time.Second),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := rules.NewEvaluator(ruleset)
+	alert := ev.Alerts[0]
+
+	slowReport := &inspect.Report{Url: "testurl", StatusCode: 200, FirstByteDuration: time.Second}
+	errReport := &inspect.Report{Url: "testurl", StatusCode: 500, ConnectDuration: -1, FirstByteDuration: -1, TotalDuration: -1}
+	fastReport := &inspect.Report{Url: "testurl", StatusCode: 200, FirstByteDuration: 10 * time.Millisecond}
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	step := func(report *inspect.Report) {
+		now = now.Add(time.Second)
+		ev.Update(now, report)
+	}
+
+	// slow but available: rule doesn't hold
+	step(slowReport)
+	if alert.State != rules.Inactive {
+		t.Errorf("Phase 1: rule must be inactive, got %v", alert.State)
+	}
+
+	// slow and failing: rule holds, pending for 3s then firing
+	step(errReport)
+	if alert.State != rules.Pending {
+		t.Errorf("Phase 2: rule must be pending, got %v", alert.State)
+	}
+	step(slowReport)
+	step(errReport)
+	if alert.State != rules.Pending || alert.HasFired {
+		t.Errorf("Phase 2: rule must still be pending, got %v", alert.State)
+	}
+	step(slowReport)
+	if alert.State != rules.Firing || !alert.HasFired {
+		t.Errorf("Phase 3: rule must be firing, got %v", alert.State)
+	}
+	step(slowReport)
+	if alert.State != rules.Firing || alert.HasFired {
+		t.Errorf("Phase 3: rule must fire only once, got %v", alert.State)
+	}
+
+	// fast reports push the p95 below threshold after slow reports leave the 10s window
+	resolved := 0
+	for i := 0; i < 10; i++ {
+		step(fastReport)
+		if alert.HasResolved {
+			resolved++
+		}
+	}
+	if alert.State != rules.Inactive || resolved != 1 {
+		t.Errorf("Phase 4: rule must be resolved once, got %v resolved %d times", alert.State, resolved)
+	}
+}
+
+func TestRulesMissingData(t *testing.T) {
+	ruleset, err := rules.Compile([]config.RuleConfig{
+		{Name: "not-equal", Expr: "p95(ttfb, 10s) != 0"},
+		{Name: "negated", Expr: "not p95(ttfb, 10s) > 1s"},
+		{Name: "negated-and", Expr: "not (availability(10s) < 0.5 and p95(ttfb, 10s) > 1s)"},
+		{Name: "decided-or", Expr: "availability(10s) < 0.5 or p95(ttfb, 10s) > 1s"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := rules.NewEvaluator(ruleset)
+
+	// failed requests have no latency: comparisons with it never hold, even negated, unless decided by other operands
+	errReport := &inspect.Report{Url: "testurl", StatusCode: 500, ConnectDuration: -1, FirstByteDuration: -1, TotalDuration: -1}
+	ev.Update(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), errReport)
+	expected := map[string]rules.State{"not-equal": rules.Inactive, "negated": rules.Inactive, "negated-and": rules.Inactive, "decided-or": rules.Firing}
+	for _, alert := range ev.Alerts {
+		if alert.State != expected[alert.Rule.Name] {
+			t.Errorf("rule %s must be %v without latency, got %v", alert.Rule.Name, expected[alert.Rule.Name], alert.State)
+		}
+	}
+}
+
+func TestRulesSampleOrder(t *testing.T) {
+	ruleset, err := rules.Compile([]config.RuleConfig{
+		{Name: "busy", Expr: "count(10s) >= 3"},
+		{Name: "compound", Expr: "count(1h30m) >= 4"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev := rules.NewEvaluator(ruleset)
+	busy, compound := ev.Alerts[0], ev.Alerts[1]
+	report := &inspect.Report{Url: "testurl", StatusCode: 200, FirstByteDuration: 10 * time.Millisecond}
+
+	// a slow probe reported after a later one is evicted once out of the window, like the other samples
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ev.Update(start.Add(20*time.Second), report)
+	ev.Update(start.Add(time.Second), report)
+	ev.Update(start.Add(25*time.Second), report)
+	if busy.State != rules.Inactive {
+		t.Errorf("Phase 1: rule must be inactive with 2 samples in its window, got %v", busy.State)
+	}
+
+	// compound durations are windows of their total
+	ev.Update(start.Add(80*time.Minute), report)
+	if compound.State != rules.Firing {
+		t.Errorf("Phase 2: rule must fire with 4 samples in 1h30m, got %v", compound.State)
+	}
+	ev.Update(start.Add(91*time.Minute), report)
+	if compound.State != rules.Inactive {
+		t.Errorf("Phase 2: rule must be resolved once samples leave 1h30m, got %v", compound.State)
+	}
+}
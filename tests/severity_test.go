@@ -0,0 +1,142 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/notify"
+)
+
+func TestSeverityLevels(t *testing.T) {
+	initConfig()
+	config.CriticalAvailability, config.WarningAvailability = 0.5, 0.9
+	config.LatencyThreshold, config.LatencyWarningThreshold = 0, 0
+	config.FlapHighThreshold = 0
+	defer func() { config.WarningAvailability = 0 }()
+	pollingInterval := time.Second
+	errReport := &inspect.Report{Url: "testurl", StatusCode: 500, ConnectDuration: -1, FirstByteDuration: -1, TotalDuration: -1}
+	availableReport := &inspect.Report{Url: "testurl", StatusCode: 200, ConnectDuration: 10, FirstByteDuration: 5, TotalDuration: 20}
+
+	reportc := make(chan *inspect.Report)
+	met := metrics.NewMetrics(reportc, pollingInterval, metrics.ConfigSettings())
+	processed := pacedReports(met, pollingInterval)
+	go met.ListenAndProcess()
+	defer close(reportc)
+	// events returns the alert transitions since the last call
+	seen := 0
+	events := func() []*metrics.Event {
+		all := met.Events()
+		defer func() { seen = len(all) }()
+		return all[seen:]
+	}
+	send := func(report *inspect.Report, n int) {
+		for i := 0; i < n; i++ {
+			reportc <- report
+			<-processed
+		}
+	}
+
+	// Phase 1: availability is computed over the reports in the alert window, so it's ok from the first available one
+	send(availableReport, 1)
+	if events := events(); len(events) != 0 || met.Alert.AvailabilityLevel != metrics.OK || met.Alert.Level() != metrics.OK {
+		t.Fatalf("Phase 1: Expected ok level without alerts, got %v and %+v", met.Alert.AvailabilityLevel, events)
+	}
+	send(availableReport, 9)
+
+	// Phase 2: availability below the warning threshold is a warning
+	send(errReport, 2)
+	if events := events(); len(events) != 1 || events[0].Severity != "warning" || events[0].Resolved || met.Alert.WebsiteWentDown {
+		t.Fatalf("Phase 2: Expected a warning, got %+v", events)
+	}
+	send(availableReport, 1) // not down anymore, but still degraded
+	if met.Alert.Level() != metrics.Warning {
+		t.Errorf("Phase 2: Expected warning level, got %v", met.Alert.Level())
+	}
+
+	// Phase 3: availability below the critical threshold starts the alert again as critical
+	send(errReport, 4)
+	if events := events(); len(events) != 1 || events[0].Severity != "critical" || !met.Alert.WebsiteWentDown || met.Alert.Level() != metrics.Critical {
+		t.Fatalf("Phase 3: Expected a critical alert, got %+v", events)
+	}
+
+	// Phase 4: recovering goes back to a warning, then resolves the alert with the last severity
+	send(availableReport, 5)
+	if events := events(); len(events) != 1 || events[0].Severity != "warning" || events[0].Resolved {
+		t.Fatalf("Phase 4: Expected a warning again, got %+v", events)
+	}
+	send(availableReport, 5)
+	if events := events(); len(events) != 1 || !events[0].Resolved || events[0].Severity != "warning" || met.Alert.Level() != metrics.OK {
+		t.Errorf("Phase 4: Expected warning to be resolved, got %+v", events)
+	}
+
+	// Phase 5: thresholds are validated
+	for _, tc := range []struct {
+		crit, warn      float64
+		latency, latwar time.Duration
+		valid           bool
+	}{
+		{0.8, 0, 0, 0, true},
+		{0.8, 0.95, time.Second, 500 * time.Millisecond, true},
+		{0.8, 0.5, 0, 0, false},                         // warning below critical
+		{0.8, 1.5, 0, 0, false},                         // warning above 1
+		{0.8, 0.9, time.Second, 2 * time.Second, false}, // latency warning above critical
+		{0.8, 0.9, 0, -time.Second, false},              // negative latency warning
+	} {
+		if err := metrics.ValidateThresholds(tc.crit, tc.warn, tc.latency, tc.latwar); (err == nil) != tc.valid {
+			t.Errorf("Phase 5: ValidateThresholds(%v, %v, %v, %v) = %v", tc.crit, tc.warn, tc.latency, tc.latwar, err)
+		}
+	}
+}
+
+func TestSeverityRoutes(t *testing.T) {
+	chat, pager := make(chanNotifier, 10), make(chanNotifier, 10)
+	notifiers := map[string]notify.Notifier{"chat": chat, "pager": pager}
+	if _, err := incident.NewManager(config.EscalationConfig{Primary: "chat", Routes: map[string]string{"fatal": "pager"}}, notifiers, ""); err == nil {
+		t.Error("Phase 1: Expected an error for a route of an unknown severity")
+	}
+	if _, err := incident.NewManager(config.EscalationConfig{Primary: "chat", Routes: map[string]string{"critical": "sms"}}, notifiers, ""); err == nil {
+		t.Error("Phase 1: Expected an error for a route to an undefined notifier")
+	}
+	incidents, err := incident.NewManager(config.EscalationConfig{Primary: "chat", Routes: map[string]string{"critical": "pager"}}, notifiers, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	event := func(severity string, resolved bool) *metrics.Event {
+		now = now.Add(time.Second)
+		return &metrics.Event{Url: "https://a.com", Alert: "availability", Severity: severity, Resolved: resolved, Time: now}
+	}
+
+	// Phase 2: warnings go to the primary channel
+	incidents.Handle(event("warning", false))
+	if n := expectNotification(t, chat, "Phase 2"); n.Severity != "warning" {
+		t.Errorf("Phase 2: Expected a warning, got %+v", n)
+	}
+	expectNoNotification(t, pager, "Phase 2")
+	incidents.AcknowledgeAll()
+
+	// Phase 3: a warning going critical is notified again to the critical route, and acknowledged again
+	incidents.Handle(event("critical", false))
+	if n := expectNotification(t, pager, "Phase 3"); n.Severity != "critical" {
+		t.Errorf("Phase 3: Expected a critical notification, got %+v", n)
+	}
+	expectNoNotification(t, chat, "Phase 3")
+	if open := incidents.Incidents(); len(open) != 1 || open[0].Severity != "critical" || open[0].Acknowledged {
+		t.Errorf("Phase 3: Expected an unacknowledged critical incident, got %+v", open)
+	}
+	incidents.Handle(event("critical", false)) // same level, already open
+	expectNoNotification(t, pager, "Phase 3")
+
+	// Phase 4: resolutions go to the channel of the last severity
+	incidents.Handle(event("critical", true))
+	if n := expectNotification(t, pager, "Phase 4"); !n.Resolved {
+		t.Errorf("Phase 4: Expected a resolution, got %+v", n)
+	}
+	if open := incidents.Incidents(); len(open) != 0 {
+		t.Errorf("Phase 4: Expected no open incident, got %+v", open)
+	}
+}
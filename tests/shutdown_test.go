@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/notify"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+)
+
+func TestRegistryShutdown(t *testing.T) {
+	initConfig()
+	config.HistoryRetention = time.Hour
+	started, release, canceled := make(chan struct{}, 1), make(chan struct{}), make(chan struct{}, 1)
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		if r.URL.Path == "/hanging" {
+			<-r.Context().Done()
+			canceled <- struct{}{}
+			return
+		}
+		<-release
+	}))
+	defer website.Close()
+	monitors := registry.New(func(m *registry.Monitor) { m.Inspector.Pause() }, nil)
+	m, err := monitors.Add(website.URL, time.Second, "website")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Phase 1: in-flight requests are processed before the registry is closed
+	m.Inspector.ProbeNow()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	closed := make(chan error)
+	go func() { closed <- monitors.Close(ctx) }()
+	close(release)
+	if err := <-closed; err != nil {
+		t.Fatalf("Phase 1: Expected registry to close, got %v", err)
+	}
+	if history := m.Metrics.History(time.Time{}, time.Now()); len(history) != 1 || history[0].Report.StatusCode != 200 {
+		t.Errorf("Phase 1: Expected the in-flight request to be processed, got %d reports", len(history))
+	}
+
+	// Phase 2: monitors can't be added to a closed registry
+	if _, err := monitors.Add(website.URL+"/other", time.Second, ""); err == nil {
+		t.Error("Phase 2: Expected an error adding a monitor to a closed registry")
+	}
+
+	// Phase 3: removing a monitor cancels its in-flight requests, which aren't reported,
+	// and calls its hook once the registry can be used again
+	remaining := -1
+	monitors = registry.New(func(m *registry.Monitor) { m.Inspector.Pause() }, func(*registry.Monitor) { remaining = len(monitors.Monitors()) })
+	m, err = monitors.Add(website.URL+"/hanging", 10*time.Second, "hanging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Inspector.ProbeNow()
+	<-started
+	removed := make(chan error)
+	go func() { removed <- monitors.Remove("hanging") }()
+	select {
+	case err := <-removed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Phase 3: Expected the monitor to be removed")
+	}
+	if remaining != 0 {
+		t.Errorf("Phase 3: Expected no monitor left when the hook is called, got %d", remaining)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Phase 3: Expected the in-flight request to be canceled")
+	}
+	if err := monitors.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if history := m.Metrics.History(time.Time{}, time.Now()); len(history) != 0 {
+		t.Errorf("Phase 3: Expected the canceled request not to be reported, got %+v", history[0].Report)
+	}
+}
+
+func TestIncidentsShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iseeu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "state.json")
+	slow := make(chanNotifier) // blocks until notifications are read
+	incidents, err := incident.NewManager(config.EscalationConfig{Primary: "chat"}, map[string]notify.Notifier{"chat": slow}, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	ran := make(chan struct{})
+	go func() {
+		incidents.Run(ctx)
+		close(ran)
+	}()
+	incidents.Handle(&metrics.Event{Url: "https://a.com", Alert: "availability", Severity: "critical", Time: time.Now()})
+
+	// Phase 1: ticking stops once the context is done
+	stop()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("Phase 1: Expected Run to return once its context is done")
+	}
+
+	// Phase 2: closing waits for in-flight notifications, until its deadline
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := incidents.Close(short); err == nil {
+		t.Error("Phase 2: Expected closing to time out while a notification is in flight")
+	}
+	expectNotification(t, slow, "Phase 2")
+	if err := incidents.Close(context.Background()); err != nil {
+		t.Errorf("Phase 2: Expected incidents to close, got %v", err)
+	}
+
+	// Phase 3: open incidents are persisted
+	restored, err := incident.NewManager(config.EscalationConfig{}, nil, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open := restored.Incidents(); len(open) != 1 || open[0].Url != "https://a.com" {
+		t.Errorf("Phase 3: Expected the open incident to be persisted, got %+v", open)
+	}
+
+	// Phase 4: restored incidents of websites which are no longer monitored are dropped, and those of websites which
+	// recovered by their first evaluation are resolved
+	restored.Handle(&metrics.Event{Url: "https://b.com", Alert: "latency", Severity: "warning", Time: time.Now()})
+	restored.Handle(&metrics.Event{Url: "https://c.com", Alert: "availability", Severity: "critical", Time: time.Now()})
+	if err := restored.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	chat := make(chanNotifier, 10)
+	restored, err = incident.NewManager(config.EscalationConfig{Primary: "chat"}, map[string]notify.Notifier{"chat": chat}, stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	restored.Clock = clock.NewFake(now)
+	restored.Retain("https://a.com", "https://c.com")
+	restored.Reconcile("https://a.com", map[string]string{})
+	restored.Reconcile("https://c.com", map[string]string{"availability": "critical"})
+	if n := expectNotification(t, chat, "Phase 4"); !n.Resolved || n.Url != "https://a.com" || !n.Time.Equal(now) {
+		t.Errorf("Phase 4: Expected the recovered incident to be resolved, got %+v", n)
+	}
+	expectNoNotification(t, chat, "Phase 4")
+	if open := restored.Incidents(); len(open) != 1 || open[0].Url != "https://c.com" {
+		t.Errorf("Phase 4: Expected only the incident of the website still down to be open, got %+v", open)
+	}
+}
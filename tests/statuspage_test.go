@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/statuspage"
+	"github.com/NouamaneTazi/website-monitor/internal/storage"
+)
+
+func TestStatusPage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "iseeu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := storage.Open(filepath.Join(dir, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	report := func(url string, at time.Time, statusCode int) {
+		duration := 20 * time.Millisecond
+		if statusCode != 200 {
+			duration = -1
+		}
+		err := store.AppendReport(&metrics.Record{Time: at, Report: &inspect.Report{
+			Url: url, PollingInterval: time.Second, StatusCode: statusCode,
+			ConnectDuration: duration, FirstByteDuration: duration, TotalDuration: duration,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	event := func(url, alert string, resolved bool, at time.Time) {
+		err := store.AppendEvent(&metrics.Event{Url: url, Alert: alert, Resolved: resolved, Severity: "critical", Message: "Website " + url + " " + alert, Time: at})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Phase 1: reports and events are stored by day and read back
+	// api was down two days ago (resolved) and is down again now, www is up
+	for i := 0; i < 10; i++ {
+		report("https://www.example.com", now.Add(-time.Duration(i)*time.Hour), 200)
+		report("https://api.example.com", now.AddDate(0, 0, -2).Add(time.Duration(i)*time.Minute), 500)
+	}
+	report("https://api.example.com", now, 500)
+	event("https://api.example.com", "availability", false, now.AddDate(0, 0, -2))
+	event("https://api.example.com", "availability", true, now.AddDate(0, 0, -2).Add(10*time.Minute))
+	event("https://api.example.com", "availability", false, now.Add(-time.Minute))
+
+	var count int
+	store.Reports(now.AddDate(0, 0, -1), now, func(r *metrics.Record) error {
+		if r.Report.StatusCode == 200 && r.Report.FirstByteDuration != 20*time.Millisecond {
+			t.Errorf("Phase 1: Expected stored durations to be kept, got %v", r.Report.FirstByteDuration)
+		}
+		count++
+		return nil
+	})
+	if count != 11 {
+		t.Fatalf("Phase 1: Expected 11 reports in the past day, got %d", count)
+	}
+	if events, _ := store.Events(time.Time{}, now); len(events) != 3 {
+		t.Fatalf("Phase 1: Expected 3 events, got %d", len(events))
+	}
+
+	// Phase 2: the status page shows grouped sites, their state, and incidents
+	sites := []statuspage.Site{
+		{Url: "https://www.example.com", Name: "website", Group: "Public"},
+		{Url: "https://api.example.com", Name: "api", Group: "Public"},
+	}
+	out := filepath.Join(dir, "public")
+	if err := statuspage.Generate(store, sites, out, statuspage.Options{Title: "Example status", Days: 90}, now); err != nil {
+		t.Fatal(err)
+	}
+	html, err := ioutil.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(html)
+	for _, expected := range []string{"Major outage", "Public", "website", "[Ongoing] api down", "[Resolved] api down", "(10m0s)", "100.00% uptime"} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("Phase 2: Expected status page to contain %q", expected)
+		}
+	}
+	if bars := strings.Count(page, `title="`); bars < 2*90 {
+		t.Errorf("Phase 2: Expected 90 uptime bars per site, got %d bars", bars)
+	}
+
+	// Phase 3: feeds list the incidents, most recent first
+	var atom struct {
+		Entries []struct {
+			Title string `xml:"title"`
+		} `xml:"entry"`
+	}
+	b, err := ioutil.ReadFile(filepath.Join(out, "feed.atom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(b, &atom); err != nil {
+		t.Fatal(err)
+	}
+	if len(atom.Entries) != 2 || atom.Entries[0].Title != "[Ongoing] api down" {
+		t.Fatalf("Phase 3: Expected 2 incidents in the Atom feed, got %+v", atom.Entries)
+	}
+	var rss struct {
+		Items []struct {
+			Title string `xml:"title"`
+		} `xml:"channel>item"`
+	}
+	b, err = ioutil.ReadFile(filepath.Join(out, "feed.rss"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(b, &rss); err != nil {
+		t.Fatal(err)
+	}
+	if len(rss.Items) != 2 || rss.Items[1].Title != "[Resolved] api down" {
+		t.Fatalf("Phase 3: Expected 2 incidents in the RSS feed, got %+v", rss.Items)
+	}
+
+	// Phase 4: an incident left open by a stopped monitor ends once the site is probed up again,
+	// even when it started before the shown days
+	for i := 100; i > 0; i-- {
+		report("https://old.example.com", now.Add(-time.Duration(i)*time.Hour), 200)
+	}
+	event("https://old.example.com", "availability", false, now.AddDate(0, 0, -5))
+	out = filepath.Join(dir, "old")
+	sites = []statuspage.Site{{Url: "https://old.example.com", Name: "old"}}
+	if err := statuspage.Generate(store, sites, out, statuspage.Options{Title: "Old status", Days: 5}, now); err != nil {
+		t.Fatal(err)
+	}
+	html, err = ioutil.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page = string(html)
+	if !strings.Contains(page, "All systems operational") || !strings.Contains(page, "[Resolved] old down") {
+		t.Errorf("Phase 4: Expected the incident to be resolved once the site was probed up")
+	}
+	if strings.Contains(page, "[Ongoing]") {
+		t.Errorf("Phase 4: Expected no ongoing incident")
+	}
+}
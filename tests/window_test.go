@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NouamaneTazi/website-monitor/internal/api"
+	"github.com/NouamaneTazi/website-monitor/internal/clock"
+	"github.com/NouamaneTazi/website-monitor/internal/config"
+	"github.com/NouamaneTazi/website-monitor/internal/incident"
+	"github.com/NouamaneTazi/website-monitor/internal/inspect"
+	"github.com/NouamaneTazi/website-monitor/internal/metrics"
+	"github.com/NouamaneTazi/website-monitor/internal/registry"
+)
+
+func TestTimeWindows(t *testing.T) {
+	initConfig()
+	pollingInterval := time.Second
+	start := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	reportc := make(chan *inspect.Report)
+	met := metrics.NewMetrics(reportc, pollingInterval, metrics.ConfigSettings())
+	met.Clock = clk
+	processed := processedReports(met)
+	go met.ListenAndProcess()
+	defer close(reportc)
+	// send sends a report probed `at` seconds after start, and processed at the current time of the clock
+	send := func(statusCode int, at time.Duration) *metrics.Record {
+		report := &inspect.Report{Url: "testurl", PollingInterval: pollingInterval, StatusCode: statusCode,
+			ConnectDuration: -1, FirstByteDuration: -1, TotalDuration: -1, Time: start.Add(at * time.Second)}
+		if statusCode == 200 {
+			report.ConnectDuration, report.FirstByteDuration, report.TotalDuration = 10*time.Millisecond, 20*time.Millisecond, 40*time.Millisecond
+		}
+		reportc <- report
+		return <-processed
+	}
+	short := met.AggData.Window("short")
+
+	// Phase 1: reports are timestamped at probe time, and availability is computed over the reports in the window
+	clk.Add(time.Minute)
+	if record := send(200, 1); !record.Time.Equal(start.Add(time.Second)) {
+		t.Errorf("Phase 1: Expected report timestamped at probe time, got %v", record.Time)
+	}
+	send(200, 2)
+	send(500, 3)
+	send(200, 4)
+	if short.Len() != 4 || short.Availability != 0.75 || met.Alert.Availability != 0.75 {
+		t.Errorf("Phase 1: Expected availability 0.75 over 4 reports, got %v over %d", short.Availability, short.Len())
+	}
+	if short.StatusCodesCount[200] != 3 || short.StatusCodesCount[500] != 1 {
+		t.Errorf("Phase 1: Unexpected status codes %v", short.StatusCodesCount)
+	}
+	if short.TotalDuration != [2]int{40, 40} {
+		t.Errorf("Phase 1: Expected avg and max over available reports, got %v", short.TotalDuration)
+	}
+
+	// Phase 2: a report probed late (slow probe) is aggregated by its probe time, whatever the order of processing
+	send(500, 9)
+	send(200, 8)
+	if short.Len() != 6 || short.Availability != 0.67 {
+		t.Errorf("Phase 2: Expected availability 0.67 over 6 reports, got %v over %d", short.Availability, short.Len())
+	}
+
+	// Phase 3: reports are evicted by age, whatever the polling interval: a pause empties the window
+	send(200, 30)
+	if short.Len() != 1 || short.Availability != 1 || short.StatusCodesCount[500] != 0 {
+		t.Errorf("Phase 3: Expected a single report left, got %d (%v)", short.Len(), short.StatusCodesCount)
+	}
+	if _, ok := short.StatusCodesCount[500]; ok {
+		t.Error("Phase 3: Evicted status codes must not be counted")
+	}
+
+	// Phase 4: irregular intervals are weighted by the reports actually present
+	send(200, 35)
+	send(500, 36)
+	send(500, 41)
+	if short.Len() != 3 || short.Availability != 0.33 {
+		t.Errorf("Phase 4: Expected availability 0.33 over 3 reports, got %v over %d", short.Availability, short.Len())
+	}
+	if met.Alert.Level() != metrics.Critical || !met.Alert.WebsiteWasDown {
+		t.Errorf("Phase 4: Expected website down, got %v", met.Alert.Level())
+	}
+
+	// Phase 5: reports are evicted by their age at refresh, even when no report is processed since
+	met.Expire(start.Add(45 * time.Second))
+	if short.Len() != 2 || short.Availability != 0 || short.StatusCodesCount[500] != 2 {
+		t.Errorf("Phase 5: Expected 2 failed reports left, got %d (%v)", short.Len(), short.StatusCodesCount)
+	}
+	met.Expire(start.Add(time.Minute))
+	if short.Len() != 0 || len(short.StatusCodesCount) != 0 || short.ConnectDuration != [2]int{} {
+		t.Errorf("Phase 5: Expected an empty window, got %d reports (%v)", short.Len(), short.StatusCodesCount)
+	}
+}
+
+func TestNamedWindows(t *testing.T) {
+	initConfig()
+	config.HistoryRetention = time.Hour
+	defer initConfig()
+
+	// Phase 1: windows are parsed from a list of durations, optionally named
+	for s, valid := range map[string]bool{"1m,5m,1h,24h": true, "short=10s, long=1m": true, "": false, "1m,1m": false,
+		"=1m": false, "1m,x": false, "short=-1s": false} {
+		if _, err := config.ParseWindows(s); (err == nil) != valid {
+			t.Errorf("Phase 1: Expected %q to be valid: %v, got %v", s, valid, err)
+		}
+	}
+	windows, err := config.ParseWindows("1m,5m,1h,24h")
+	if err != nil || len(windows) != 4 || windows[2].Name != "1h" || windows[2].Duration != time.Hour || windows.Longest() != 24*time.Hour {
+		t.Fatalf("Phase 1: Unexpected windows %v (%v)", windows, err)
+	}
+	config.StatsWindows = windows
+
+	// Phase 2: each window has its own aggregates
+	website := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer website.Close()
+	incidents, err := incident.NewManager(config.EscalationConfig{}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	monitors := registry.New(func(m *registry.Monitor) { m.Inspector.Pause() }, nil)
+	defer monitors.Close(context.Background())
+	m, err := monitors.Add(website.URL, time.Second, "website")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitors.Remove("website")
+	probe(t, m, 2)
+	m.Metrics.Mu.RLock()
+	if len(m.Metrics.AggData.Windows) != 4 || m.Metrics.AggData.Window("24h").HistoryInterval() != 24*time.Hour ||
+		m.Metrics.AggData.Window("5m").StatusCodesCount[200] != 2 || m.Metrics.AggData.Longest().Name() != "24h" {
+		t.Errorf("Phase 2: Expected 4 windows with 2 reports each, got %d windows", len(m.Metrics.AggData.Windows))
+	}
+	m.Metrics.Mu.RUnlock()
+
+	// Phase 3: windows are listed in order, and monitors export the stats of every window by name
+	server := api.NewServer(monitors, incidents, nil)
+	var definitions []map[string]string
+	if code := request(t, server, "GET", "/api/v1/windows", nil, &definitions); code != http.StatusOK || len(definitions) != 4 ||
+		definitions[0]["name"] != "1m" || definitions[3]["interval"] != "24h0m0s" {
+		t.Errorf("Phase 3: GET windows: got %d %v", code, definitions)
+	}
+	var monitor struct {
+		Windows map[string]struct {
+			Interval    string         `json:"interval"`
+			StatusCodes map[string]int `json:"status_codes"`
+		} `json:"windows"`
+	}
+	if code := request(t, server, "GET", "/api/v1/monitors/website", nil, &monitor); code != http.StatusOK || len(monitor.Windows) != 4 ||
+		monitor.Windows["1h"].Interval != "1h0m0s" || monitor.Windows["1h"].StatusCodes["200"] != 2 {
+		t.Errorf("Phase 3: GET monitor: got %d %+v", code, monitor)
+	}
+}